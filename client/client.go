@@ -0,0 +1,712 @@
+// Package client talks to a gpio-json-server over its websocket.
+//
+// A Client keeps a single connection open, reconnecting automatically if it
+// drops, decodes every message the server sends and hands pin events to
+// subscribers.
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+	"github.com/benjamind/gpio-json-server/sensor"
+	"github.com/gorilla/websocket"
+)
+
+// DefaultTimeout is how long the Get methods wait for a reply by default.
+const DefaultTimeout = 5 * time.Second
+
+const (
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+var (
+	ErrNotConnected = errors.New("not connected to server")
+	ErrClosed       = errors.New("client closed")
+	ErrTimeout      = errors.New("timed out waiting for server")
+)
+
+// Client is a connection to a gpio-json-server. It is safe for concurrent use.
+type Client struct {
+	// Timeout bounds how long the Get methods wait for the server to reply.
+	Timeout time.Duration
+
+	url string
+
+	mu       sync.Mutex
+	ws       *websocket.Conn
+	version  string
+	commands []string
+	schema   []protocol.CommandSchema
+	snapshot *protocol.Snapshot
+	filters  []string
+	waiters  map[string][]chan *protocol.Message
+	subs     map[<-chan *protocol.Message]chan *protocol.Message
+	closed   bool
+	done     chan struct{}
+}
+
+// Dial connects to the server at addr, which is either host:port or a full
+// ws:// url.
+func Dial(addr string) (*Client, error) {
+	c := &Client{
+		Timeout: DefaultTimeout,
+		url:     wsURL(addr),
+		waiters: make(map[string][]chan *protocol.Message),
+		subs:    make(map[<-chan *protocol.Message]chan *protocol.Message),
+		done:    make(chan struct{}),
+	}
+	ws, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	go c.run(ws)
+	return c, nil
+}
+
+func wsURL(addr string) string {
+	if strings.HasPrefix(addr, "ws://") || strings.HasPrefix(addr, "wss://") {
+		return addr
+	}
+	return "ws://" + addr + "/ws"
+}
+
+// Version returns the server version reported on the current connection.
+func (c *Client) Version() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+// Commands returns the commands the server advertised on the current
+// connection.
+func (c *Client) Commands() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.commands
+}
+
+// Schema returns the schema of every command the server advertised on the
+// current connection.
+func (c *Client) Schema() []protocol.CommandSchema {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.schema
+}
+
+// Snapshot returns the state the server sent when the current connection was
+// made. Pin events received since then have a larger Seq.
+func (c *Client) Snapshot() *protocol.Snapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.snapshot
+}
+
+// Subscribe returns a channel receiving every PinState, PinAdded, PinRemoved
+// and Error message, and the Snapshot sent each time the client connects. Messages are dropped if the channel isn't drained. The
+// channel is closed when the client is closed.
+func (c *Client) Subscribe() <-chan *protocol.Message {
+	ch := make(chan *protocol.Message, 64)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		close(ch)
+	} else {
+		c.subs[ch] = ch
+	}
+	return ch
+}
+
+// Unsubscribe stops delivery to a channel returned by Subscribe and closes it.
+func (c *Client) Unsubscribe(sub <-chan *protocol.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ch, ok := c.subs[sub]; ok {
+		delete(c.subs, sub)
+		close(ch)
+	}
+}
+
+// Watch asks the server to only send pin events matching filters: pin ids,
+// name globs like "fan*", or event types like "PinState", optionally prefixed
+// with pin:, name: or type:. Filters accumulate across calls and are restored
+// when the client reconnects.
+func (c *Client) Watch(filters ...string) error {
+	c.mu.Lock()
+	c.filters = append(c.filters, filters...)
+	c.mu.Unlock()
+	return c.Send(strings.Join(append([]string{protocol.CmdSubscribe}, filters...), " "))
+}
+
+// Unwatch removes filters added by Watch. With no filters it removes them
+// all, and the server sends every pin event again.
+func (c *Client) Unwatch(filters ...string) error {
+	c.mu.Lock()
+	if len(filters) == 0 {
+		c.filters = nil
+	} else {
+		kept := c.filters[:0]
+		for _, f := range c.filters {
+			remove := false
+			for _, r := range filters {
+				remove = remove || f == r
+			}
+			if !remove {
+				kept = append(kept, f)
+			}
+		}
+		c.filters = kept
+	}
+	c.mu.Unlock()
+	return c.Send(strings.Join(append([]string{protocol.CmdUnsubscribe}, filters...), " "))
+}
+
+// Send sends a raw command line to the server.
+func (c *Client) Send(cmd string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	if c.ws == nil {
+		return ErrNotConnected
+	}
+	return c.ws.WriteMessage(websocket.TextMessage, []byte(cmd))
+}
+
+// InitPin configures a pin. The server answers with a PinAdded event.
+func (c *Client) InitPin(pinId string, dir gpio.Direction, pullup gpio.PullUp, name string) error {
+	if name == "" {
+		name = pinId
+	}
+	var dirStr string
+	switch dir {
+	case gpio.In:
+		dirStr = "in"
+	case gpio.Out:
+		dirStr = "out"
+	case gpio.PWM:
+		dirStr = "pwm"
+	case gpio.Servo:
+		dirStr = "servo"
+	case gpio.Analog:
+		dirStr = "analog"
+	case gpio.Counter:
+		dirStr = "counter"
+	case gpio.Encoder:
+		dirStr = "encoder"
+	default:
+		return fmt.Errorf("unknown direction %d", dir)
+	}
+	pullStr := "none"
+	switch pullup {
+	case gpio.Pull_Up:
+		pullStr = "up"
+	case gpio.Pull_Down:
+		pullStr = "down"
+	}
+	return c.Send(strings.Join([]string{protocol.CmdInitPin, pinId, dirStr, pullStr, name}, " "))
+}
+
+// SetPin sets a pin's state, 0 or 1 for digital pins, 0-255 for PWM or an
+// angle of 0-180 for servos. The server answers with a PinState event.
+func (c *Client) SetPin(pinId string, value byte) error {
+	return c.Send(fmt.Sprintf("%s %s %d", protocol.CmdSetPin, pinId, value))
+}
+
+// RemovePin releases a pin. The server answers with a PinRemoved event.
+func (c *Client) RemovePin(pinId string) error {
+	return c.Send(protocol.CmdRemovePin + " " + pinId)
+}
+
+// DefineGroup defines a group of pins, the first being bit 0 of bitmasks
+// given to SetGroup. The server answers with a Groups message.
+func (c *Client) DefineGroup(group string, pins ...string) error {
+	return c.Send(strings.Join(append([]string{protocol.CmdDefGroup, group}, pins...), " "))
+}
+
+// DeleteGroup deletes a group of pins. The server answers with a Groups
+// message.
+func (c *Client) DeleteGroup(group string) error {
+	return c.Send(protocol.CmdDelGroup + " " + group)
+}
+
+// SetGroup sets every pin of a group, to value as for SetPin or to the bits
+// of a bitmask prefixed with 0b or 0x. The server answers with a single
+// PinsChanged event.
+func (c *Client) SetGroup(group string, value string) error {
+	return c.Send(protocol.CmdSetGroup + " " + group + " " + value)
+}
+
+// SetPins sets several pins, keyed by pin id, alias or name, as one
+// operation. The server answers with a single PinsChanged event.
+func (c *Client) SetPins(values map[string]byte) error {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	return c.Send(protocol.CmdSetPins + " " + string(data))
+}
+
+// GetGroups returns every group and its pins.
+func (c *Client) GetGroups() (map[string][]string, error) {
+	msg, err := c.request(protocol.CmdGetGroups, protocol.TypeGroups)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Groups, nil
+}
+
+// SaveScene saves the current state of the given pins as a scene, or of
+// every output and PWM pin if none are given. The server answers with a
+// Scenes message.
+func (c *Client) SaveScene(scene string, pins ...string) error {
+	return c.Send(strings.Join(append([]string{protocol.CmdSaveScene, scene}, pins...), " "))
+}
+
+// ApplyScene sets every pin of a scene as one operation. The server answers
+// with a SceneApplied event.
+func (c *Client) ApplyScene(scene string) error {
+	return c.Send(protocol.CmdApplyScene + " " + scene)
+}
+
+// DeleteScene deletes a scene. The server answers with a Scenes message.
+func (c *Client) DeleteScene(scene string) error {
+	return c.Send(protocol.CmdDelScene + " " + scene)
+}
+
+// GetScenes returns every scene and its pin values.
+func (c *Client) GetScenes() (map[string]protocol.Scene, error) {
+	msg, err := c.request(protocol.CmdGetScenes, protocol.TypeScenes)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Scenes, nil
+}
+
+// AddJob schedules an action, such as "pulse pump 5s", on a cron schedule
+// like "0 7 * * *" or an interval like "@every 30m". The server answers with
+// a Jobs message, and sends a JobFired event every time the job runs.
+func (c *Client) AddJob(name string, schedule string, action string) error {
+	return c.Send(strings.Join([]string{protocol.CmdAddJob, name, schedule, action}, " "))
+}
+
+// DeleteJob deletes a scheduled job. The server answers with a Jobs message.
+func (c *Client) DeleteJob(name string) error {
+	return c.Send(protocol.CmdDelJob + " " + name)
+}
+
+// GetJobs returns every scheduled job and when it runs next.
+func (c *Client) GetJobs() (map[string]protocol.Job, error) {
+	msg, err := c.request(protocol.CmdGetJobs, protocol.TypeJobs)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Jobs, nil
+}
+
+// SetSampling sets how an analog pin is sampled. The server answers with a
+// PinState event.
+func (c *Client) SetSampling(pin string, config gpio.AnalogConfig) error {
+	interval := config.Interval
+	if interval == "" {
+		interval = gpio.DefaultAnalogInterval.String()
+	}
+	cmd := protocol.CmdSetSampling + " " + pin + " " + interval
+	if config.Samples > 0 || config.Threshold > 0 {
+		samples := config.Samples
+		if samples == 0 {
+			samples = gpio.DefaultAnalogSamples
+		}
+		cmd += " " + strconv.Itoa(samples)
+	}
+	if config.Threshold > 0 {
+		cmd += " " + strconv.Itoa(config.Threshold)
+	}
+	return c.Send(cmd)
+}
+
+// SetCounter sets how a counter or encoder pin counts. The server answers
+// with a PinState event.
+func (c *Client) SetCounter(pin string, config gpio.CounterConfig) error {
+	interval := config.Interval
+	if interval == "" {
+		interval = gpio.DefaultCounterInterval.String()
+	}
+	pulses := config.PulsesPerRev
+	if pulses == 0 {
+		pulses = gpio.DefaultPulsesPerRev
+	}
+	cmd := protocol.CmdSetCounter + " " + pin + " " + interval + " " + strconv.Itoa(pulses)
+	if config.PinB != "" {
+		cmd += " " + config.PinB
+	}
+	return c.Send(cmd)
+}
+
+// ResetCounter sets the count of a counter or encoder pin back to zero. The
+// server answers with a PinState event.
+func (c *Client) ResetCounter(pin string) error {
+	return c.Send(protocol.CmdResetCounter + " " + pin)
+}
+
+// GetSensors returns the last reading of every sensor.
+func (c *Client) GetSensors() (map[string]sensor.Reading, error) {
+	msg, err := c.request(protocol.CmdGetSensors, protocol.TypeSensors)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Sensors, nil
+}
+
+// GetSensor returns the last reading of one sensor.
+func (c *Client) GetSensor(id string) (*sensor.Reading, error) {
+	msg, err := c.request(protocol.CmdGetSensor+" "+id, protocol.TypeSensor)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Sensor, nil
+}
+
+// AddSensor starts reading sensors with a driver, given options such as
+// "dir=/sys/bus/w1/devices" and "interval=5s". The server answers with a
+// SensorConfigs message, and sends a SensorReading event every time a sensor
+// is read.
+func (c *Client) AddSensor(name string, driver string, options ...string) error {
+	return c.Send(strings.Join(append([]string{protocol.CmdAddSensor, name, driver}, options...), " "))
+}
+
+// DeleteSensor stops reading sensors with a driver. The server answers with
+// SensorConfigs and Sensors messages.
+func (c *Client) DeleteSensor(name string) error {
+	return c.Send(protocol.CmdDelSensor + " " + name)
+}
+
+// Tare makes the scale read by a driver, such as an hx711, read its current
+// weight as zero. The server answers with a SensorConfigs message holding
+// its new offset.
+func (c *Client) Tare(name string) error {
+	return c.Send(protocol.CmdTare + " " + name)
+}
+
+// Calibrate makes the scale read by a driver read its current weight, over
+// the tare, as weight. The server answers with a SensorConfigs message
+// holding its new scale.
+func (c *Client) Calibrate(name string, weight float64) error {
+	return c.Send(protocol.CmdCalibrate + " " + name + " " + strconv.FormatFloat(weight, 'g', -1, 64))
+}
+
+// GetSensorConfigs returns the configuration of every sensor driver.
+func (c *Client) GetSensorConfigs() (map[string]sensor.Config, error) {
+	msg, err := c.request(protocol.CmdGetSensorConfigs, protocol.TypeSensorConfigs)
+	if err != nil {
+		return nil, err
+	}
+	return msg.SensorConfigs, nil
+}
+
+// AddStepper drives a stepper motor through the step, dir and enable pins of
+// its driver, given options such as "speed=400" or "limit=P1_13" as for the
+// addstepper command. The server answers with a Steppers message.
+func (c *Client) AddStepper(name string, step string, dir string, enable string, options ...string) error {
+	return c.Send(strings.Join(append([]string{protocol.CmdAddStepper, name, step, dir, enable}, options...), " "))
+}
+
+// DeleteStepper halts a stepper and forgets it. The server answers with a
+// Steppers message.
+func (c *Client) DeleteStepper(name string) error {
+	return c.Send(protocol.CmdDelStepper + " " + name)
+}
+
+// GetSteppers returns every stepper, with its state.
+func (c *Client) GetSteppers() (map[string]protocol.Stepper, error) {
+	msg, err := c.request(protocol.CmdGetSteppers, protocol.TypeSteppers)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Steppers, nil
+}
+
+// Move moves a stepper by steps, backwards when negative, at its own speed
+// and acceleration unless given as a speed and an acceleration. The server
+// sends Stepper events as it moves, the last once it stops.
+func (c *Client) Move(name string, steps int64, params ...int) error {
+	return c.Send(moveCmd(protocol.CmdMove, name, steps, params))
+}
+
+// MoveTo moves a stepper to position, as Move.
+func (c *Client) MoveTo(name string, position int64, params ...int) error {
+	return c.Send(moveCmd(protocol.CmdMoveTo, name, position, params))
+}
+
+func moveCmd(cmd string, name string, steps int64, params []int) string {
+	cmd += " " + name + " " + strconv.FormatInt(steps, 10)
+	for _, p := range params {
+		cmd += " " + strconv.Itoa(p)
+	}
+	return cmd
+}
+
+// Stop brings a moving stepper to a halt at its acceleration.
+func (c *Client) Stop(name string) error {
+	return c.Send(protocol.CmdStop + " " + name)
+}
+
+// Home runs a stepper to its limit switch, then backs off it to position 0.
+// The server sends Stepper events as it moves, the last with Homed set once
+// it is home.
+func (c *Client) Home(name string) error {
+	return c.Send(protocol.CmdHome + " " + name)
+}
+
+// AddRule adds a rule run whenever a pin changes, given as for the addrule
+// command after the rule's name, e.g. "door low after 100ms setpin spindle
+// low". The server answers with a Rules message, and sends a RuleFired event
+// every time the rule runs.
+func (c *Client) AddRule(name string, spec string) error {
+	return c.Send(protocol.CmdAddRule + " " + name + " " + spec)
+}
+
+// DeleteRule deletes a rule. The server answers with a Rules message.
+func (c *Client) DeleteRule(name string) error {
+	return c.Send(protocol.CmdDelRule + " " + name)
+}
+
+// EnableRule enables or disables a rule. The server answers with a Rules
+// message.
+func (c *Client) EnableRule(name string, enabled bool) error {
+	if enabled {
+		return c.Send(protocol.CmdEnableRule + " " + name)
+	}
+	return c.Send(protocol.CmdDisableRule + " " + name)
+}
+
+// GetRules returns every rule.
+func (c *Client) GetRules() (map[string]protocol.Rule, error) {
+	msg, err := c.request(protocol.CmdGetRules, protocol.TypeRules)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Rules, nil
+}
+
+// GetHost returns the name of the board the server is running on.
+func (c *Client) GetHost() (string, error) {
+	msg, err := c.request(protocol.CmdGetHost, protocol.TypeHost)
+	if err != nil {
+		return "", err
+	}
+	return msg.Host, nil
+}
+
+// GetPinMap returns every pin the board provides.
+func (c *Client) GetPinMap() ([]gpio.PinDef, error) {
+	msg, err := c.request(protocol.CmdGetPinMap, protocol.TypePinMap)
+	if err != nil {
+		return nil, err
+	}
+	return msg.PinMap, nil
+}
+
+// GetPin returns the state of one initialised pin, addressed by id, alias
+// or name.
+func (c *Client) GetPin(pin string) (*gpio.PinState, error) {
+	msg, err := c.request(protocol.CmdGetPin+" "+pin, protocol.TypePin)
+	if err != nil {
+		return nil, err
+	}
+	return msg.Pin, nil
+}
+
+// GetPinStates returns the state of every initialised pin, keyed by pin id.
+func (c *Client) GetPinStates() (map[string]gpio.PinState, error) {
+	msg, err := c.request(protocol.CmdGetPinStates, protocol.TypePinStates)
+	if err != nil {
+		return nil, err
+	}
+	return msg.PinStates, nil
+}
+
+// Close closes the connection and stops reconnecting.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	for sub, ch := range c.subs {
+		delete(c.subs, sub)
+		close(ch)
+	}
+	if c.ws != nil {
+		return c.ws.Close()
+	}
+	return nil
+}
+
+// request sends cmd and waits for the next message of type reply.
+func (c *Client) request(cmd string, reply string) (*protocol.Message, error) {
+	ch := make(chan *protocol.Message, 1)
+	c.mu.Lock()
+	c.waiters[reply] = append(c.waiters[reply], ch)
+	c.mu.Unlock()
+
+	if err := c.Send(cmd); err != nil {
+		c.cancel(reply, ch)
+		return nil, err
+	}
+
+	select {
+	case msg := <-ch:
+		return msg, nil
+	case <-time.After(c.Timeout):
+		c.cancel(reply, ch)
+		return nil, ErrTimeout
+	case <-c.done:
+		return nil, ErrClosed
+	}
+}
+
+func (c *Client) cancel(reply string, ch chan *protocol.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	waiters := c.waiters[reply]
+	for i := range waiters {
+		if waiters[i] == ch {
+			c.waiters[reply] = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+}
+
+func (c *Client) dial() (*websocket.Conn, error) {
+	ws, _, err := websocket.DefaultDialer.Dial(c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		ws.Close()
+		return nil, ErrClosed
+	}
+	c.ws = ws
+	return ws, nil
+}
+
+// run reads from ws until it fails, then reconnects, until the client is
+// closed.
+func (c *Client) run(ws *websocket.Conn) {
+	for {
+		c.read(ws)
+
+		c.mu.Lock()
+		c.ws = nil
+		c.mu.Unlock()
+
+		ws = c.reconnect()
+		if ws == nil {
+			return
+		}
+
+		c.mu.Lock()
+		filters := append([]string{}, c.filters...)
+		c.mu.Unlock()
+		if len(filters) > 0 {
+			if err := c.Send(strings.Join(append([]string{protocol.CmdSubscribe}, filters...), " ")); err != nil {
+				log.Println("Failed to restore subscriptions : " + err.Error())
+			}
+		}
+	}
+}
+
+func (c *Client) read(ws *websocket.Conn) {
+	defer ws.Close()
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		msg, err := protocol.Decode(data)
+		if err != nil {
+			log.Println("Failed to decode message : " + err.Error())
+			continue
+		}
+		c.dispatch(msg)
+	}
+}
+
+func (c *Client) dispatch(msg *protocol.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	switch msg.Type {
+	case protocol.TypeVersion:
+		c.version = msg.Version
+	case protocol.TypeCommands:
+		c.commands = msg.Commands
+		c.schema = msg.Schema
+	case protocol.TypeSnapshot:
+		c.snapshot = msg.Snapshot
+		for _, ch := range c.subs {
+			select {
+			case ch <- msg:
+			default:
+			}
+		}
+	case protocol.TypePinState, protocol.TypePinAdded, protocol.TypePinRemoved, protocol.TypePinsChanged,
+		protocol.TypeGroups, protocol.TypeSceneApplied, protocol.TypeScenes, protocol.TypeJobs, protocol.TypeJobFired,
+		protocol.TypeRules, protocol.TypeRuleFired, protocol.TypeSensorReading, protocol.TypeSensors,
+		protocol.TypeSensor, protocol.TypeSensorConfigs, protocol.TypeSteppers, protocol.TypeStepper, protocol.TypeError:
+		for _, ch := range c.subs {
+			select {
+			case ch <- msg:
+			default:
+			}
+		}
+	}
+	if waiters := c.waiters[msg.Type]; len(waiters) > 0 {
+		for _, ch := range waiters {
+			ch <- msg
+		}
+		delete(c.waiters, msg.Type)
+	}
+}
+
+// reconnect dials the server with exponential backoff until it succeeds or
+// the client is closed, in which case it returns nil.
+func (c *Client) reconnect() *websocket.Conn {
+	delay := minBackoff
+	for {
+		select {
+		case <-c.done:
+			return nil
+		case <-time.After(delay):
+		}
+		ws, err := c.dial()
+		if err == nil {
+			return ws
+		}
+		if err == ErrClosed {
+			return nil
+		}
+		log.Println("Reconnect to " + c.url + " failed : " + err.Error())
+		delay *= 2
+		if delay > maxBackoff {
+			delay = maxBackoff
+		}
+	}
+}
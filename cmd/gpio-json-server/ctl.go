@@ -0,0 +1,389 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/client"
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+	"github.com/benjamind/gpio-json-server/sensor"
+)
+
+const ctlUsage = `usage: gpio-json-server ctl <command> [args...] [flags]
+
+Commands are sent to the server exactly as a websocket client would, e.g.
+  gpio-json-server ctl initpin P1_11 out none spindle
+  gpio-json-server ctl setpin P1_11 high --server raspberrypi:8888
+  gpio-json-server ctl getpinstates --json
+  gpio-json-server ctl setpins '{"P1_11": 1, "fan": 128}'
+  gpio-json-server ctl move rotary -100
+
+Arguments starting with - that aren't flags, like negative numbers, are
+sent as they are, as is everything after --.
+
+The special command "watch" streams pin events until interrupted. It takes
+optional filters, as for the subscribe command:
+  gpio-json-server ctl watch P1_11 'fan*' type:PinState
+
+Flags:
+`
+
+// ctl runs the command-line client and returns the process exit code.
+func ctl(args []string) int {
+	fs := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	serverAddr := fs.String("server", "localhost:8888", "server address as host:port or ws:// url")
+	asJSON := fs.Bool("json", false, "print messages as JSON, one per line")
+	timeout := fs.Duration("timeout", client.DefaultTimeout, "how long to wait for the server to reply")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, ctlUsage)
+		fs.PrintDefaults()
+	}
+
+	cmdArgs, err := splitArgs(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(cmdArgs) == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	c, err := client.Dial(*serverAddr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to connect to "+*serverAddr+" : "+err.Error())
+		return 1
+	}
+	defer c.Close()
+	c.Timeout = *timeout
+
+	out := func(msg *protocol.Message) {
+		if *asJSON {
+			data, err := json.Marshal(msg)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to marshal message : "+err.Error())
+				return
+			}
+			fmt.Println(string(data))
+		} else {
+			printMessage(msg)
+		}
+	}
+
+	cmd := strings.ToLower(cmdArgs[0])
+	switch cmd {
+	case "watch":
+		events := c.Subscribe()
+		// the snapshot may have arrived before we subscribed
+		snap := c.Snapshot()
+		if snap != nil {
+			out(&protocol.Message{Type: protocol.TypeSnapshot, Snapshot: snap})
+		}
+		if len(cmdArgs) > 1 {
+			if err := c.Watch(cmdArgs[1:]...); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		}
+		for msg := range events {
+			if msg.Snapshot != nil && msg.Snapshot == snap {
+				continue
+			}
+			out(msg)
+		}
+		return 0
+	case protocol.CmdGetHost:
+		host, err := c.GetHost()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		out(&protocol.Message{Type: protocol.TypeHost, Host: host})
+		return 0
+	case protocol.CmdGetPinMap:
+		pinMap, err := c.GetPinMap()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		out(&protocol.Message{Type: protocol.TypePinMap, PinMap: pinMap})
+		return 0
+	case protocol.CmdGetPinStates:
+		pinStates, err := c.GetPinStates()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		out(&protocol.Message{Type: protocol.TypePinStates, PinStates: pinStates})
+		return 0
+	}
+
+	// anything else is sent verbatim, then we wait for the event confirming it
+	reply, hasReply := ctlReplies[cmd]
+	var pinId string
+	if len(cmdArgs) > 1 && !hasReply {
+		pinId = resolvePin(c, cmdArgs[1])
+	}
+	events := c.Subscribe()
+	if err := c.Send(strings.Join(cmdArgs, " ")); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	deadline := time.After(*timeout)
+	for {
+		select {
+		case msg, ok := <-events:
+			if !ok {
+				return 1
+			}
+			if msg.Type == protocol.TypeError {
+				out(msg)
+				return 1
+			}
+			if (hasReply && msg.Type == reply) || (!hasReply && eventPin(msg) == pinId) {
+				out(msg)
+				return 0
+			}
+		case <-deadline:
+			fmt.Fprintln(os.Stderr, "No reply from server for "+cmdArgs[0])
+			return 1
+		}
+	}
+}
+
+// splitArgs parses the flags of fs out of args, returning the command and
+// its arguments. Flags may come before, between and after the arguments, but
+// only those fs defines are taken as flags, so negative numbers like -100
+// stay arguments, as does everything after --.
+func splitArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var cmdArgs, flags []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			cmdArgs = append(cmdArgs, args[i+1:]...)
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		value := strings.Contains(name, "=")
+		name = strings.SplitN(name, "=", 2)[0]
+		f := fs.Lookup(name)
+		if name == arg || (f == nil && name != "h" && name != "help") {
+			cmdArgs = append(cmdArgs, arg)
+			continue
+		}
+		flags = append(flags, arg)
+		if f == nil || value {
+			continue
+		}
+		// a flag's value may follow it, except for booleans
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !(ok && b.IsBoolFlag()) && i+1 < len(args) {
+			i++
+			flags = append(flags, args[i])
+		}
+	}
+	return cmdArgs, fs.Parse(flags)
+}
+
+// ctlReplies are the messages confirming commands that aren't about a
+// single pin.
+var ctlReplies = map[string]string{
+	protocol.CmdDefGroup:    protocol.TypeGroups,
+	protocol.CmdDelGroup:    protocol.TypeGroups,
+	protocol.CmdGetGroups:   protocol.TypeGroups,
+	protocol.CmdSetGroup:    protocol.TypePinsChanged,
+	protocol.CmdSetPins:     protocol.TypePinsChanged,
+	protocol.CmdSaveScene:   protocol.TypeScenes,
+	protocol.CmdDelScene:    protocol.TypeScenes,
+	protocol.CmdGetScenes:   protocol.TypeScenes,
+	protocol.CmdApplyScene:  protocol.TypeSceneApplied,
+	protocol.CmdAddJob:      protocol.TypeJobs,
+	protocol.CmdDelJob:      protocol.TypeJobs,
+	protocol.CmdGetJobs:     protocol.TypeJobs,
+	protocol.CmdAddRule:     protocol.TypeRules,
+	protocol.CmdDelRule:     protocol.TypeRules,
+	protocol.CmdEnableRule:  protocol.TypeRules,
+	protocol.CmdDisableRule: protocol.TypeRules,
+	protocol.CmdGetRules:    protocol.TypeRules,
+	protocol.CmdGetSensors:  protocol.TypeSensors,
+	protocol.CmdGetSensor:   protocol.TypeSensor,
+	protocol.CmdAddSensor:   protocol.TypeSensorConfigs,
+	protocol.CmdDelSensor:   protocol.TypeSensorConfigs,
+	protocol.CmdTare:        protocol.TypeSensorConfigs,
+	protocol.CmdCalibrate:   protocol.TypeSensorConfigs,
+	protocol.CmdAddStepper:  protocol.TypeSteppers,
+	protocol.CmdDelStepper:  protocol.TypeSteppers,
+	protocol.CmdGetSteppers: protocol.TypeSteppers,
+	protocol.CmdMove:        protocol.TypeStepper,
+	protocol.CmdMoveTo:      protocol.TypeStepper,
+	protocol.CmdStop:        protocol.TypeStepper,
+	protocol.CmdHome:        protocol.TypeStepper,
+
+	protocol.CmdGetSensorConfigs: protocol.TypeSensorConfigs,
+}
+
+// resolvePin finds the canonical id of a pin given by alias or name, so we
+// can recognise the events about it.
+func resolvePin(c *client.Client, key string) string {
+	if pinMap, err := c.GetPinMap(); err == nil {
+		if pd, ok := gpio.Lookup(pinMap, key); ok {
+			return pd.ID
+		}
+	}
+	if ps, err := c.GetPin(key); err == nil && ps != nil {
+		return ps.PinId
+	}
+	return key
+}
+
+// eventPin returns the pin id a pin event refers to.
+func eventPin(msg *protocol.Message) string {
+	switch msg.Type {
+	case protocol.TypePinState:
+		return msg.PinState.PinId
+	case protocol.TypePinAdded:
+		return msg.PinAdded.PinId
+	case protocol.TypePinRemoved:
+		return msg.PinRemoved
+	}
+	return ""
+}
+
+func printMessage(msg *protocol.Message) {
+	switch msg.Type {
+	case protocol.TypeHost:
+		fmt.Println(msg.Host)
+	case protocol.TypePinMap:
+		for _, pd := range msg.PinMap {
+			fmt.Println(pd.ID, strings.Join(pd.Aliases, ","), strings.Join(pd.Capabilities, ","))
+		}
+	case protocol.TypePinStates:
+		for _, ps := range msg.PinStates {
+			printPinState("", ps)
+		}
+	case protocol.TypePinState, protocol.TypePinAdded:
+		ps := msg.PinState
+		if msg.Type == protocol.TypePinAdded {
+			ps = msg.PinAdded
+		}
+		printPinState(msg.Type+" ", *ps)
+	case protocol.TypePinRemoved:
+		fmt.Println(msg.Type, msg.PinRemoved)
+	case protocol.TypePinsChanged, protocol.TypeSceneApplied:
+		changed := msg.PinsChanged
+		if msg.Type == protocol.TypeSceneApplied {
+			changed = msg.SceneApplied
+		}
+		for _, ps := range changed.PinStates {
+			printPinState(msg.Type+" ", ps)
+		}
+	case protocol.TypeGroups:
+		for group, pins := range msg.Groups {
+			fmt.Println(group, strings.Join(pins, ","))
+		}
+	case protocol.TypeScenes:
+		for scene, values := range msg.Scenes {
+			pins := make([]string, 0, len(values))
+			for pin, value := range values {
+				pins = append(pins, fmt.Sprintf("%s=%d", pin, value))
+			}
+			sort.Strings(pins)
+			fmt.Println(scene, strings.Join(pins, ","))
+		}
+	case protocol.TypeJobs:
+		for name, j := range msg.Jobs {
+			next := "never"
+			if j.Next != nil {
+				next = j.Next.Format(time.RFC3339)
+			}
+			fmt.Printf("%s schedule=%q action=%q next=%s\n", name, j.Schedule, j.Action, next)
+		}
+	case protocol.TypeJobFired:
+		fmt.Println(msg.Type, msg.JobFired.Job, msg.JobFired.Action)
+		if msg.JobFired.Error != nil {
+			fmt.Println(protocol.TypeError, msg.JobFired.Error.Code, msg.JobFired.Error.Message)
+		}
+	case protocol.TypeRules:
+		for name, r := range msg.Rules {
+			when := r.Pin + " " + r.When
+			for _, c := range r.If {
+				when += " if " + c.Pin + " " + c.When
+			}
+			if r.Delay != "" {
+				when += " after " + r.Delay
+			}
+			fmt.Printf("%s when=%q action=%q disabled=%t\n", name, when, r.Action, r.Disabled)
+		}
+	case protocol.TypeRuleFired:
+		fmt.Println(msg.Type, msg.RuleFired.Rule, msg.RuleFired.Action)
+		if msg.RuleFired.Error != nil {
+			fmt.Println(protocol.TypeError, msg.RuleFired.Error.Code, msg.RuleFired.Error.Message)
+		}
+	case protocol.TypeSnapshot:
+		fmt.Printf("%s host=%s seq=%d\n", msg.Type, msg.Snapshot.Host, msg.Snapshot.Seq)
+		for _, ps := range msg.Snapshot.PinStates {
+			printPinState("", ps)
+		}
+		for _, r := range msg.Snapshot.Sensors {
+			printSensorReading("", r)
+		}
+		for _, st := range msg.Snapshot.Steppers {
+			if st.State != nil {
+				printStepperState("", *st.State)
+			}
+		}
+	case protocol.TypeSensorReading:
+		printSensorReading(msg.Type+" ", *msg.SensorReading)
+	case protocol.TypeSensor:
+		printSensorReading("", *msg.Sensor)
+	case protocol.TypeSensors:
+		for _, r := range msg.Sensors {
+			printSensorReading("", r)
+		}
+	case protocol.TypeSensorConfigs:
+		for name, sc := range msg.SensorConfigs {
+			fmt.Printf("%s driver=%s interval=%s options=%v\n", name, sc.Driver, sc.Interval, sc.Options)
+		}
+	case protocol.TypeSteppers:
+		for name, st := range msg.Steppers {
+			fmt.Printf("%s step=%s dir=%s enable=%s limit=%s speed=%d accel=%d\n", name, st.Step, st.Dir, st.Enable, st.Limit, st.Speed, st.Accel)
+			if st.State != nil {
+				printStepperState("", *st.State)
+			}
+		}
+	case protocol.TypeStepper:
+		printStepperState(msg.Type+" ", *msg.Stepper)
+	case protocol.TypeError:
+		fmt.Println(msg.Type, msg.Error.Code, msg.Error.Message)
+	}
+}
+
+func printPinState(prefix string, ps gpio.PinState) {
+	if ps.Dir == gpio.Analog {
+		fmt.Printf("%s%s state=%d raw=%d dir=%d name=%s\n", prefix, ps.PinId, ps.State, ps.Raw, ps.Dir, ps.Name)
+		return
+	}
+	if ps.Dir == gpio.Counter || ps.Dir == gpio.Encoder {
+		fmt.Printf("%s%s count=%d freq=%g rpm=%g dir=%d name=%s\n", prefix, ps.PinId, ps.Count, ps.Freq, ps.RPM, ps.Dir, ps.Name)
+		return
+	}
+	fmt.Printf("%s%s state=%d dir=%d pullup=%d name=%s\n", prefix, ps.PinId, ps.State, ps.Dir, ps.Pullup, ps.Name)
+}
+
+func printSensorReading(prefix string, r sensor.Reading) {
+	fmt.Printf("%s%s %s=%g%s quality=%s model=%s time=%s\n", prefix, r.Id, r.Kind, r.Value, r.Unit, r.Quality, r.Model, r.Time.Format(time.RFC3339))
+	if r.Error != "" {
+		fmt.Printf("%s%s error=%s\n", prefix, r.Id, r.Error)
+	}
+}
+
+func printStepperState(prefix string, st protocol.StepperState) {
+	fmt.Printf("%s%s position=%d moving=%t homed=%t\n", prefix, st.Stepper, st.Position, st.Moving, st.Homed)
+	if st.Error != nil {
+		fmt.Printf("%s%s error=%s\n", prefix, st.Stepper, st.Error.Message)
+	}
+}
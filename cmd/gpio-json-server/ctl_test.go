@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/server"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		args   []string
+		want   []string
+		server string
+		json   bool
+	}{
+		{[]string{"setpin", "P1_11", "high"}, []string{"setpin", "P1_11", "high"}, "", false},
+		{[]string{"--server", "pi:8888", "setpin", "P1_11", "high", "--json"}, []string{"setpin", "P1_11", "high"}, "pi:8888", true},
+		{[]string{"setpin", "-server=pi:8888", "P1_11", "high"}, []string{"setpin", "P1_11", "high"}, "pi:8888", false},
+		{[]string{"move", "rotary", "-100"}, []string{"move", "rotary", "-100"}, "", false},
+		{[]string{"move", "rotary", "-100", "-json"}, []string{"move", "rotary", "-100"}, "", true},
+		{[]string{"--json", "--", "setpin", "--server", "x"}, []string{"setpin", "--server", "x"}, "", true},
+	}
+	for _, test := range tests {
+		fs := flag.NewFlagSet("ctl", flag.ContinueOnError)
+		serverAddr := fs.String("server", "", "")
+		asJSON := fs.Bool("json", false, "")
+		got, err := splitArgs(fs, test.args)
+		if err != nil {
+			t.Errorf("%q: %v", test.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) || *serverAddr != test.server || *asJSON != test.json {
+			t.Errorf("%q: got %q, server %q and json %v, want %q, %q and %v", test.args, got, *serverAddr, *asJSON, test.want, test.server, test.json)
+		}
+	}
+}
+
+func TestCtlNegativeArgument(t *testing.T) {
+	srv := server.New(new(gpio.GPIO))
+	srv.StateFile, srv.W1Dir = "", ""
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer func() {
+		ts.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+	addr := strings.TrimPrefix(ts.URL, "http://")
+
+	for _, args := range [][]string{
+		{"initpin", "P8_07", "out", "none"},
+		{"initpin", "P8_08", "out", "none"},
+		{"initpin", "P8_09", "out", "none"},
+		{"addstepper", "rotary", "P8_07", "P8_08", "P8_09"},
+		{"move", "rotary", "-100"},
+	} {
+		if code := ctl(append(args, "--server", addr)); code != 0 {
+			t.Fatalf("ctl %s exited with %d", strings.Join(args, " "), code)
+		}
+	}
+}
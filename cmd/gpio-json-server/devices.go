@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+// openFunc opens the device at addr on an I2C bus, naming its pins with
+// prefix. extra is the optional last field of its spec, or "".
+type openFunc func(prefix string, bus byte, addr byte, extra string) (gpio.Device, error)
+
+// openDevices opens the devices of a kind listed in spec, as comma separated
+// bus:address[:extra], naming the pins of the first <prefix>0_0, <prefix>0_1
+// and so on, those of the second <prefix>1_0 and so on.
+func openDevices(kind string, prefix string, spec string, open openFunc) ([]gpio.Device, error) {
+	var devices []gpio.Device
+	fail := func(err error) ([]gpio.Device, error) {
+		for _, d := range devices {
+			d.Close()
+		}
+		return nil, err
+	}
+	for i, field := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(field), ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return fail(errors.New("invalid " + kind + " : " + field))
+		}
+		bus, err := strconv.ParseUint(parts[0], 0, 8)
+		if err != nil {
+			return fail(errors.New("invalid " + kind + " bus : " + parts[0]))
+		}
+		addr, err := strconv.ParseUint(parts[1], 0, 7)
+		if err != nil {
+			return fail(errors.New("invalid " + kind + " address : " + parts[1]))
+		}
+		extra := ""
+		if len(parts) == 3 {
+			extra = parts[2]
+		}
+		d, err := open(prefix+strconv.Itoa(i), byte(bus), byte(addr), extra)
+		if err != nil {
+			return fail(err)
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+// openPCA9685 opens a PCA9685, running at the frequency in Hz given as extra.
+func openPCA9685(prefix string, bus byte, addr byte, extra string) (gpio.Device, error) {
+	freq := gpio.DefaultPCA9685Freq
+	if extra != "" {
+		var err error
+		if freq, err = strconv.Atoi(extra); err != nil {
+			return nil, errors.New("invalid PCA9685 frequency : " + extra)
+		}
+	}
+	return gpio.OpenPCA9685(prefix, bus, addr, freq)
+}
+
+// openMCP23017 opens an MCP23017, whose interrupt line is wired to the board
+// pin given as extra.
+func openMCP23017(prefix string, bus byte, addr byte, extra string) (gpio.Device, error) {
+	return gpio.OpenMCP23017(prefix, bus, addr, extra)
+}
+
+// openPCF8574 opens a PCF8574, whose interrupt line is wired to the board pin
+// given as extra.
+func openPCF8574(prefix string, bus byte, addr byte, extra string) (gpio.Device, error) {
+	return gpio.OpenPCF8574(prefix, bus, addr, extra)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/sensor"
+	"github.com/benjamind/gpio-json-server/server"
+)
+
+var (
+	addr       = flag.String("addr", ":8888", "http service address")
+	stateFile  = flag.String("state", server.DefaultStateFile, "file pin states are persisted to")
+	configFile = flag.String("config", "", "file declaring the pins and groups to start with")
+	w1Dir      = flag.String("w1-dir", sensor.DefaultW1Dir, "directory 1-Wire thermometers are discovered in, empty to disable")
+
+	sensorInterval = flag.Duration("sensor-interval", server.DefaultSensorInterval, "how often sensors are read")
+
+	pca9685  = flag.String("pca9685", "", "PCA9685 PWM controllers to add pins from, as comma separated bus:address[:freq], e.g. 1:0x40")
+	mcp23017 = flag.String("mcp23017", "", "MCP23017 I/O expanders to add pins from, as comma separated bus:address[:interrupt pin], e.g. 1:0x20:GPIO_17")
+	pcf8574  = flag.String("pcf8574", "", "PCF8574 I/O expanders to add pins from, as comma separated bus:address[:interrupt pin], e.g. 1:0x38:GPIO_27")
+
+	pingInterval   = flag.Duration("ping-interval", server.DefaultPingInterval, "how often clients are pinged")
+	pongWait       = flag.Duration("pong-wait", server.DefaultPongWait, "how long a silent client is kept before it is dropped")
+	writeTimeout   = flag.Duration("write-timeout", server.DefaultWriteTimeout, "timeout for writes to a client")
+	maxMessageSize = flag.Int64("max-message-size", server.DefaultMaxMessageSize, "largest message accepted from a client, in bytes")
+
+	shutdownTimeout = flag.Duration("shutdown-timeout", 5*time.Second, "how long to wait for clients when shutting down")
+)
+
+type NullWriter int
+
+func (NullWriter) Write([]byte) (int, error) { return 0, nil }
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "ctl" {
+		os.Exit(ctl(os.Args[2:]))
+	}
+
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	flag.Parse()
+	f := flag.Lookup("addr")
+	log.Println("Version:" + server.Version)
+
+	ip, err := externalIP()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	log.Print("Started server and websocket on " + ip + "" + f.Value.String())
+
+	log.Println("The GPIO JSON Server is now running.")
+	log.Println("If you are using ChiliPeppr, you may go back to it and connect to this server using the GPIO widget.")
+
+	/*if !*verbose {
+		log.Println("You can enter verbose mode to see all logging by starting with the -v command line switch.")
+		log.SetOutput(new(NullWriter)) //route all logging to nullwriter
+	}*/
+
+	var g gpio.GPIOInterface = new(gpio.GPIO)
+	var devices []gpio.Device
+	for _, kind := range []struct {
+		name, prefix, spec string
+		open               openFunc
+	}{
+		{"PCA9685", "PCA", *pca9685, openPCA9685},
+		{"MCP23017", "MCP", *mcp23017, openMCP23017},
+		{"PCF8574", "PCF", *pcf8574, openPCF8574},
+	} {
+		if kind.spec == "" {
+			continue
+		}
+		opened, err := openDevices(kind.name, kind.prefix, kind.spec, kind.open)
+		if err != nil {
+			log.Println("Failed to open " + kind.name + " : " + err.Error())
+			os.Exit(1)
+		}
+		devices = append(devices, opened...)
+	}
+	if len(devices) > 0 {
+		g = gpio.Expand(g, devices...)
+	}
+
+	srv := server.New(g)
+	srv.StateFile = *stateFile
+	srv.ConfigFile = *configFile
+	srv.PingInterval = *pingInterval
+	srv.PongWait = *pongWait
+	srv.WriteTimeout = *writeTimeout
+	srv.MaxMessageSize = *maxMessageSize
+	srv.W1Dir = *w1Dir
+	srv.SensorInterval = *sensorInterval
+
+	if err := srv.Start(); err != nil {
+		log.Println("Failed to start server : " + err.Error())
+		os.Exit(1)
+	}
+
+	httpSrv := &http.Server{Addr: *addr, Handler: srv.Handler()}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-c
+		log.Printf("captured %v, shutting down..", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		if err := httpSrv.Shutdown(ctx); err != nil {
+			log.Println("Error shutting down http server : " + err.Error())
+		}
+	}()
+
+	exitCode := 0
+	if err := httpSrv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Println("Error ListenAndServe: " + err.Error())
+		exitCode = 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	if err := srv.Shutdown(ctx); err != nil {
+		exitCode = 1
+	}
+	cancel()
+	log.Println("Shut down, exiting..")
+	os.Exit(exitCode)
+}
+
+func externalIP() (string, error) {
+	//log.Println("Getting external IP")
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		log.Println("Got err getting external IP addr")
+		return "", err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 {
+			//log.Println("Iface down")
+			continue // interface down
+		}
+		if iface.Flags&net.FlagLoopback != 0 {
+			//log.Println("Loopback")
+			continue // loopback interface
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			log.Println("Got err on iface.Addrs()")
+			return "", err
+		}
+		for _, addr := range addrs {
+			var ip net.IP
+			switch v := addr.(type) {
+			case *net.IPNet:
+				ip = v.IP
+			case *net.IPAddr:
+				ip = v.IP
+			}
+			if ip == nil || ip.IsLoopback() {
+				//log.Println("Ip was nil or loopback")
+				continue
+			}
+			ip = ip.To4()
+			if ip == nil {
+				//log.Println("Was not ipv4 addr")
+				continue // not an ipv4 address
+			}
+			//log.Println("IP is ", ip.String())
+			return ip.String(), nil
+		}
+	}
+	return "", errors.New("are you connected to the network?")
+}
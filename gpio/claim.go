@@ -0,0 +1,76 @@
+package gpio
+
+import "sync"
+
+// Claimer is a GPIO backend whose pins may be claimed by drivers that drive
+// them directly, such as sensors bit-banged through the GPIO registers.
+type Claimer interface {
+	// Claim reserves pinId for owner, which describes what drives it, so the
+	// backend refuses to initialise it until it is released. A pin the
+	// backend has initialised, or that is already claimed, is refused.
+	Claim(pinId string, owner string) error
+	// Release gives up a pin claimed with Claim.
+	Release(pinId string)
+}
+
+// claims tracks the pins of a board that are either initialised by its
+// backend, or claimed by a driver, but never both. Both are by canonical pin
+// id. Its zero value is ready to use.
+type claims struct {
+	mu sync.Mutex
+	// what drives each claimed pin
+	owners map[string]string
+	// the pins the backend has initialised
+	held map[string]bool
+}
+
+func (c *claims) Claim(pinId string, owner string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if other, ok := c.owners[pinId]; ok {
+		return NewError(CodeUnsupported, pinId, "Pin "+pinId+" is used by "+other)
+	}
+	if c.held[pinId] {
+		return NewError(CodeUnsupported, pinId, "Pin "+pinId+" is initialised, remove it first")
+	}
+	if c.owners == nil {
+		c.owners = make(map[string]string)
+	}
+	c.owners[pinId] = owner
+	return nil
+}
+
+func (c *claims) Release(pinId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.owners, pinId)
+}
+
+// hold records pinId as initialised by the backend, unless it is claimed.
+func (c *claims) hold(pinId string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if owner, ok := c.owners[pinId]; ok {
+		return NewError(CodeUnsupported, pinId, "Pin "+pinId+" is used by "+owner)
+	}
+	if c.held == nil {
+		c.held = make(map[string]bool)
+	}
+	c.held[pinId] = true
+	return nil
+}
+
+// unhold records pinId as no longer initialised by the backend.
+func (c *claims) unhold(pinId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.held, pinId)
+}
+
+// claimedBy returns what drives pinId, if it is claimed.
+func (c *claims) claimedBy(pinId string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	owner, ok := c.owners[pinId]
+	return owner, ok
+}
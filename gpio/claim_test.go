@@ -0,0 +1,67 @@
+package gpio
+
+import "testing"
+
+func TestClaim(t *testing.T) {
+	g := &GPIO{}
+	g.Init(make(chan PinState, 10), make(chan PinState, 10), make(chan string, 10), map[string]PinState{})
+	defer g.Close()
+
+	if err := g.Claim("P8_07", "a sensor"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.PinInit("P8_07", Out, Pull_None, "P8_07"); CodeOf(err) != CodeUnsupported {
+		t.Errorf("initialising a claimed pin: got %v, want an Unsupported error", err)
+	}
+	if err := g.Claim("P8_07", "another sensor"); CodeOf(err) != CodeUnsupported {
+		t.Errorf("claiming a claimed pin: got %v, want an Unsupported error", err)
+	}
+	g.Release("P8_07")
+	if err := g.PinInit("P8_07", Out, Pull_None, "P8_07"); err != nil {
+		t.Errorf("initialising a released pin: %v", err)
+	}
+	if err := g.Claim("P8_07", "a sensor"); CodeOf(err) != CodeUnsupported {
+		t.Errorf("claiming an initialised pin: got %v, want an Unsupported error", err)
+	}
+	if err := g.PinRemove("P8_07"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Claim("P8_07", "a sensor"); err != nil {
+		t.Errorf("claiming a removed pin: %v", err)
+	}
+	g.Release("P8_07")
+
+	// nor can an encoder count a claimed pin as its B pin
+	if err := g.PinInit("P8_08", Encoder, Pull_None, "P8_08"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Claim("P8_09", "a sensor"); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Release("P8_09")
+	if err := g.PinSetCounter("P8_08", CounterConfig{PinB: "P8_09"}); CodeOf(err) != CodeUnsupported {
+		t.Errorf("counting a claimed B pin: got %v, want an Unsupported error", err)
+	}
+}
+
+func TestClaimsPerBackend(t *testing.T) {
+	a, b := &GPIO{}, &GPIO{}
+	a.Init(make(chan PinState, 10), make(chan PinState, 10), make(chan string, 10), map[string]PinState{})
+	b.Init(make(chan PinState, 10), make(chan PinState, 10), make(chan string, 10), map[string]PinState{})
+	defer a.Close()
+	defer b.Close()
+
+	if err := a.Claim("P8_07", "a sensor"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Release("P8_07")
+	if err := b.PinInit("P8_07", Out, Pull_None, "P8_07"); err != nil {
+		t.Errorf("initialising a pin claimed from another backend: %v", err)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.PinInit("P8_07", Out, Pull_None, "P8_07"); CodeOf(err) != CodeUnsupported {
+		t.Errorf("initialising a claimed pin after closing another backend: got %v, want an Unsupported error", err)
+	}
+}
@@ -0,0 +1,158 @@
+package gpio
+
+import (
+	"sync"
+	"time"
+)
+
+// CounterConfig sets how a counter or encoder pin counts. Its count and rate
+// are reported every Interval when they change, along with the RPM for
+// PulsesPerRev pulses per revolution. PinB is the B pin of an encoder, which
+// counts rising edges like a counter until it is given one. Zero values take
+// the defaults.
+type CounterConfig struct {
+	Interval     string `json:",omitempty"`
+	PulsesPerRev int    `json:",omitempty"`
+	PinB         string `json:",omitempty"`
+}
+
+// Counter defaults.
+const (
+	DefaultCounterInterval = time.Second
+	DefaultPulsesPerRev    = 1
+)
+
+// params checks c and returns its settings, with defaults filled in.
+func (c CounterConfig) params(pinId string) (interval time.Duration, pulsesPerRev int, err error) {
+	interval, pulsesPerRev = DefaultCounterInterval, DefaultPulsesPerRev
+	if c.Interval != "" {
+		if interval, err = time.ParseDuration(c.Interval); err != nil || interval < 10*time.Millisecond {
+			return 0, 0, NewError(CodeInvalidValue, pinId, "Invalid counter interval, must be a duration of at least 10ms : "+c.Interval)
+		}
+	}
+	if c.PulsesPerRev < 0 {
+		return 0, 0, NewError(CodeInvalidValue, pinId, "Pulses per revolution can't be negative")
+	}
+	if c.PulsesPerRev > 0 {
+		pulsesPerRev = c.PulsesPerRev
+	}
+	return interval, pulsesPerRev, nil
+}
+
+// check verifies c suits pin, and that its B pin isn't used otherwise, by
+// the backend's pins or its claims.
+func (c CounterConfig) check(pin PinState, pinStates map[string]PinState, claims *claims) error {
+	if pin.Dir != Counter && pin.Dir != Encoder {
+		return NewError(CodeUnsupported, pin.PinId, "Pin "+pin.PinId+" is not a counter")
+	}
+	if _, _, err := c.params(pin.PinId); err != nil {
+		return err
+	}
+	if c.PinB == "" {
+		return nil
+	}
+	if pin.Dir != Encoder {
+		return NewError(CodeInvalidArguments, pin.PinId, "Pin "+pin.PinId+" is a counter, only encoders have a B pin")
+	}
+	if c.PinB == pin.PinId {
+		return NewError(CodeInvalidValue, pin.PinId, "Pin "+pin.PinId+" can't be its own B pin")
+	}
+	if _, ok := pinStates[c.PinB]; ok {
+		return NewError(CodeUnsupported, c.PinB, "Pin "+c.PinB+" is in use")
+	}
+	if owner, ok := claims.claimedBy(c.PinB); ok {
+		return NewError(CodeUnsupported, c.PinB, "Pin "+c.PinB+" is used by "+owner)
+	}
+	if encoder, ok := encoderOf(pinStates, c.PinB); ok && encoder != pin.PinId {
+		return NewError(CodeUnsupported, c.PinB, "Pin "+c.PinB+" is the B pin of encoder "+encoder)
+	}
+	return nil
+}
+
+// encoderOf returns the encoder pinId is the B pin of, if any.
+func encoderOf(pinStates map[string]PinState, pinId string) (string, bool) {
+	for id, pin := range pinStates {
+		if pin.Dir == Encoder && pin.Counter != nil && pin.Counter.PinB == pinId {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// pulsesPerRev returns the pulses per revolution of a counter pin.
+func pulsesPerRev(pin PinState) int {
+	if pin.Counter != nil {
+		if _, pulsesPerRev, err := pin.Counter.params(pin.PinId); err == nil {
+			return pulsesPerRev
+		}
+	}
+	return DefaultPulsesPerRev
+}
+
+// setCount sets the count of pin and its rate in Hz, with State the low byte
+// of the count for clients that only read State. Rules compare the count
+// itself.
+func setCount(pin *PinState, count int64, freq float64, pulsesPerRev int) {
+	pin.Count = count
+	pin.Freq = freq
+	pin.RPM = freq * 60 / float64(pulsesPerRev)
+	pin.State = byte(count)
+}
+
+// quadrature holds the steps between consecutive states of an encoder, each
+// A<<1 | B, indexed by the previous state<<2 | the new one. A leading B counts
+// up. Transitions skipping a state have missed an edge, and count nothing.
+var quadrature = [16]int64{0, -1, 1, 0, 1, 0, 0, -1, -1, 0, 0, 1, 0, 1, -1, 0}
+
+// edgeCounter counts the pulses of a counter or encoder pin. Its methods are
+// safe to call from edge handlers as pulses come in.
+type edgeCounter struct {
+	mu    sync.Mutex
+	count int64
+	ab    byte
+
+	// the count and time the rate was last taken at
+	lastCount int64
+	lastTime  time.Time
+}
+
+func newEdgeCounter(count int64) *edgeCounter {
+	return &edgeCounter{count: count, lastCount: count, lastTime: time.Now()}
+}
+
+// pulse counts a rising edge.
+func (c *edgeCounter) pulse() {
+	c.mu.Lock()
+	c.count++
+	c.mu.Unlock()
+}
+
+// step counts the encoder's pins changing to levels a and b.
+func (c *edgeCounter) step(a int, b int) {
+	state := byte(a&1)<<1 | byte(b&1)
+	c.mu.Lock()
+	c.count += quadrature[c.ab<<2|state]
+	c.ab = state
+	c.mu.Unlock()
+}
+
+// reset sets the count back to zero.
+func (c *edgeCounter) reset() {
+	c.mu.Lock()
+	c.count, c.lastCount, c.lastTime = 0, 0, time.Now()
+	c.mu.Unlock()
+}
+
+// rate returns the count, and the pulses per second since rate was last
+// called.
+func (c *edgeCounter) rate() (int64, float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	freq := 0.0
+	if elapsed := now.Sub(c.lastTime).Seconds(); elapsed > 0 {
+		freq = float64(c.count-c.lastCount) / elapsed
+	}
+	c.lastCount, c.lastTime = c.count, now
+	return c.count, freq
+}
@@ -0,0 +1,472 @@
+package gpio
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Device is a chip adding pins to a board, such as a PWM or IO expander on
+// the I2C bus. Its pins are driven like the board's own once it is added
+// with Expand.
+type Device interface {
+	// PinMap returns the device's pins, whose ids must not clash with the
+	// board's or another device's.
+	PinMap() []PinDef
+	// PinInit sets up a pin, returning its initial state, or an Unsupported
+	// error for a direction the device can't do.
+	PinInit(pinId string, dir Direction, pullup PullUp) (byte, error)
+	// PinSet sets a pin to val, already checked against its direction.
+	PinSet(pinId string, dir Direction, val byte) error
+	PinRemove(pinId string) error
+	Close() error
+}
+
+// InputDevice is a Device with inputs. When its interrupt line, active low,
+// is wired to an input of the board, its inputs are read whenever the line
+// goes low, and otherwise every PollInterval.
+type InputDevice interface {
+	Device
+	// ReadPins returns the state of every pin, by id.
+	ReadPins() (map[string]byte, error)
+	// Interrupt returns the board pin the interrupt line is wired to, or ""
+	// if it isn't.
+	Interrupt() string
+}
+
+// PollInterval is how often the inputs of devices without an interrupt line
+// are read.
+const PollInterval = 50 * time.Millisecond
+
+// Expanded is a GPIO backend adding the pins of devices to those of a board.
+// The board inputs interrupt lines are wired to are set up by Expanded, and
+// hidden from its clients.
+type Expanded struct {
+	GPIOInterface
+
+	devices []Device
+	// the device each pin belongs to, and those interrupting on each board
+	// pin
+	owners     map[string]Device
+	interrupts map[string][]InputDevice
+
+	// guards pinStates and the devices, whose inputs are read from other
+	// goroutines
+	mu        sync.Mutex
+	pinStates map[string]PinState
+
+	pinStateChanged chan PinState
+	pinAdded        chan PinState
+	pinRemoved      chan string
+	// offered by forward whenever it has handed on every event it received
+	idle chan struct{}
+	stop chan struct{}
+}
+
+// Expand returns a backend driving board and the pins of devices.
+func Expand(board GPIOInterface, devices ...Device) *Expanded {
+	e := &Expanded{
+		GPIOInterface: board,
+		devices:       devices,
+		owners:        make(map[string]Device),
+		interrupts:    make(map[string][]InputDevice),
+		pinStates:     make(map[string]PinState),
+		idle:          make(chan struct{}),
+		stop:          make(chan struct{}),
+	}
+	for _, d := range devices {
+		for _, pd := range d.PinMap() {
+			e.owners[pd.ID] = d
+		}
+	}
+	return e
+}
+
+func (e *Expanded) Init(pinStateChanged chan PinState, pinAdded chan PinState, pinRemoved chan string, states map[string]PinState) error {
+	e.pinStateChanged = pinStateChanged
+	e.pinAdded = pinAdded
+	e.pinRemoved = pinRemoved
+
+	// interrupt lines may be given by any alias of the board pin
+	pinMap, err := e.GPIOInterface.PinMap()
+	if err != nil {
+		return err
+	}
+	var polled []InputDevice
+	for _, d := range e.devices {
+		in, ok := d.(InputDevice)
+		if !ok {
+			continue
+		}
+		pinId := in.Interrupt()
+		if pinId == "" {
+			polled = append(polled, in)
+			continue
+		}
+		if pd, ok := Lookup(pinMap, pinId); ok {
+			pinId = pd.ID
+		}
+		e.interrupts[pinId] = append(e.interrupts[pinId], in)
+	}
+
+	// the board's events pass through us, to catch interrupts
+	boardChanged := make(chan PinState)
+	boardAdded := make(chan PinState)
+	boardRemoved := make(chan string)
+	go e.forward(boardChanged, boardAdded, boardRemoved)
+
+	// the board restores its own pins, and we restore the devices'
+	boardStates := make(map[string]PinState, len(states))
+	for key, pinState := range states {
+		_, owned := e.owners[key]
+		_, interrupt := e.interrupts[key]
+		if !owned && !interrupt {
+			boardStates[key] = pinState
+		}
+	}
+	if err := e.GPIOInterface.Init(boardChanged, boardAdded, boardRemoved, boardStates); err != nil {
+		return err
+	}
+	for pinId := range e.interrupts {
+		if err := e.GPIOInterface.PinInit(pinId, In, Pull_Up, pinId); err != nil {
+			log.Println("Failed to set up interrupt line " + pinId + " : " + err.Error())
+			return err
+		}
+	}
+	for key, pinState := range states {
+		if _, ok := e.owners[key]; !ok {
+			continue
+		}
+		if pinState.Name == "" {
+			pinState.Name = pinState.PinId
+		}
+		if err := e.PinInit(key, pinState.Dir, pinState.Pullup, pinState.Name); err != nil {
+			return err
+		}
+		if pinState.Dir == Out || pinState.Dir == PWM || pinState.Dir == Servo {
+			if err := e.PinSet(key, pinState.State); err != nil {
+				return err
+			}
+		}
+	}
+
+	// reading clears any interrupt raised before we were listening
+	for _, devices := range e.interrupts {
+		for _, d := range devices {
+			e.readInputs(d)
+		}
+	}
+	if len(polled) > 0 {
+		go e.poll(polled)
+	}
+	return nil
+}
+
+// forward passes the board's events on, except those of interrupt lines,
+// which have the inputs of their devices read when they go low.
+// Between events it offers idle, which settle waits for.
+func (e *Expanded) forward(changed chan PinState, added chan PinState, removed chan string) {
+	for {
+		select {
+		case pinState := <-changed:
+			devices, ok := e.interrupts[pinState.PinId]
+			if !ok {
+				e.pinStateChanged <- pinState
+				continue
+			}
+			if pinState.State == 0 {
+				for _, d := range devices {
+					e.readInputs(d)
+				}
+			}
+		case pinState := <-added:
+			if _, ok := e.interrupts[pinState.PinId]; !ok {
+				e.pinAdded <- pinState
+			}
+		case pinId := <-removed:
+			if _, ok := e.interrupts[pinId]; !ok {
+				e.pinRemoved <- pinId
+			}
+		case e.idle <- struct{}{}:
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// settle waits for forward to hand on the events the board sent before
+// returning err, the result of a call to the board. The board's events then
+// reach the server before the call returns, as its own do, so the server
+// can tell which events a write caused.
+func (e *Expanded) settle(err error) error {
+	select {
+	case <-e.idle:
+	case <-e.stop:
+	}
+	return err
+}
+
+// poll reads the inputs of devices every PollInterval, until closed.
+func (e *Expanded) poll(devices []InputDevice) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, d := range devices {
+				e.readInputs(d)
+			}
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// readInputs reads the pins of d, and reports the inputs that changed.
+func (e *Expanded) readInputs(d InputDevice) {
+	e.mu.Lock()
+	states, err := d.ReadPins()
+	if err != nil {
+		e.mu.Unlock()
+		log.Println("Failed to read expander inputs : " + err.Error())
+		return
+	}
+	var changed []PinState
+	for pinId, val := range states {
+		pin, ok := e.pinStates[pinId]
+		if !ok || pin.Dir != In || pin.State == val {
+			continue
+		}
+		pin.State = val
+		e.pinStates[pinId] = pin
+		changed = append(changed, pin)
+	}
+	e.mu.Unlock()
+	for _, pin := range changed {
+		e.pinStateChanged <- pin
+	}
+}
+
+// Close closes the devices, then the board.
+func (e *Expanded) Close() error {
+	close(e.stop)
+	var err error
+	e.mu.Lock()
+	for _, d := range e.devices {
+		if derr := d.Close(); err == nil {
+			err = derr
+		}
+	}
+	e.mu.Unlock()
+	if berr := e.GPIOInterface.Close(); err == nil {
+		err = berr
+	}
+	return err
+}
+
+func (e *Expanded) PinMap() ([]PinDef, error) {
+	pinMap, err := e.GPIOInterface.PinMap()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range e.devices {
+		pinMap = append(pinMap, d.PinMap()...)
+	}
+	return pinMap, nil
+}
+
+func (e *Expanded) PinStates() (map[string]PinState, error) {
+	boardStates, err := e.GPIOInterface.PinStates()
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	pinStates := make(map[string]PinState, len(boardStates)+len(e.pinStates))
+	for key, pinState := range boardStates {
+		if _, ok := e.interrupts[key]; !ok {
+			pinStates[key] = pinState
+		}
+	}
+	for key, pinState := range e.pinStates {
+		pinStates[key] = pinState
+	}
+	return pinStates, nil
+}
+
+// checkInterrupt refuses to drive the board pin an interrupt line is wired
+// to.
+func (e *Expanded) checkInterrupt(pinId string) error {
+	if _, ok := e.interrupts[pinId]; ok {
+		return NewError(CodeUnsupported, pinId, "Pin "+pinId+" is the interrupt line of an expander")
+	}
+	return nil
+}
+
+func (e *Expanded) PinInit(pinId string, dir Direction, pullup PullUp, name string) error {
+	if err := e.checkInterrupt(pinId); err != nil {
+		return err
+	}
+	d, ok := e.owners[pinId]
+	if !ok {
+		return e.settle(e.GPIOInterface.PinInit(pinId, dir, pullup, name))
+	}
+	e.mu.Lock()
+	state, err := d.PinInit(pinId, dir, pullup)
+	if err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	pinState := PinState{Pin: d, PinId: pinId, Dir: dir, State: state, Pullup: pullup, Name: name}
+	e.pinStates[pinId] = pinState
+	e.mu.Unlock()
+	e.pinAdded <- pinState
+	return nil
+}
+
+func (e *Expanded) PinSet(pinId string, val byte) error {
+	if err := e.checkInterrupt(pinId); err != nil {
+		return err
+	}
+	d, ok := e.owners[pinId]
+	if !ok {
+		return e.settle(e.GPIOInterface.PinSet(pinId, val))
+	}
+	e.mu.Lock()
+	pin, ok := e.pinStates[pinId]
+	if !ok {
+		e.mu.Unlock()
+		return NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+	}
+	if err := checkValue(pin, val); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	if err := d.PinSet(pinId, pin.Dir, val); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	pin.State = val
+	e.pinStates[pinId] = pin
+	e.mu.Unlock()
+	e.pinStateChanged <- pin
+	return nil
+}
+
+func (e *Expanded) PinSetSampling(pinId string, config AnalogConfig) error {
+	if err := e.checkInterrupt(pinId); err != nil {
+		return err
+	}
+	if _, ok := e.owners[pinId]; !ok {
+		return e.settle(e.GPIOInterface.PinSetSampling(pinId, config))
+	}
+	e.mu.Lock()
+	_, ok := e.pinStates[pinId]
+	e.mu.Unlock()
+	if !ok {
+		return NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+	}
+	return NewError(CodeUnsupported, pinId, "Pin "+pinId+" is not an analog input")
+}
+
+func (e *Expanded) PinSetCounter(pinId string, config CounterConfig) error {
+	if err := e.checkInterrupt(pinId); err != nil {
+		return err
+	}
+	if _, ok := e.owners[pinId]; !ok {
+		if err := e.checkInterrupt(config.PinB); err != nil {
+			return err
+		}
+		if _, ok := e.owners[config.PinB]; ok {
+			return NewError(CodeUnsupported, config.PinB, "Pin "+config.PinB+" of an expander can't be the B pin of an encoder")
+		}
+		return e.settle(e.GPIOInterface.PinSetCounter(pinId, config))
+	}
+	return e.notCounter(pinId)
+}
+
+func (e *Expanded) PinResetCounter(pinId string) error {
+	if err := e.checkInterrupt(pinId); err != nil {
+		return err
+	}
+	if _, ok := e.owners[pinId]; !ok {
+		return e.settle(e.GPIOInterface.PinResetCounter(pinId))
+	}
+	return e.notCounter(pinId)
+}
+
+// notCounter is the error for using a device's pin as a counter.
+func (e *Expanded) notCounter(pinId string) error {
+	e.mu.Lock()
+	_, ok := e.pinStates[pinId]
+	e.mu.Unlock()
+	if !ok {
+		return NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+	}
+	return NewError(CodeUnsupported, pinId, "Pin "+pinId+" is not a counter")
+}
+
+func (e *Expanded) PinPulse(pinId string) error {
+	if err := e.checkInterrupt(pinId); err != nil {
+		return err
+	}
+	d, ok := e.owners[pinId]
+	if !ok {
+		return e.settle(e.GPIOInterface.PinPulse(pinId))
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	pin, ok := e.pinStates[pinId]
+	if !ok {
+		return NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+	}
+	if pin.Dir != Out {
+		return NewError(CodeUnsupported, pinId, "Pin "+pinId+" is not a digital output")
+	}
+	if err := d.PinSet(pinId, Out, 1); err != nil {
+		return err
+	}
+	return d.PinSet(pinId, Out, 0)
+}
+
+func (e *Expanded) PinRemove(pinId string) error {
+	if err := e.checkInterrupt(pinId); err != nil {
+		return err
+	}
+	d, ok := e.owners[pinId]
+	if !ok {
+		return e.settle(e.GPIOInterface.PinRemove(pinId))
+	}
+	e.mu.Lock()
+	if _, ok := e.pinStates[pinId]; !ok {
+		e.mu.Unlock()
+		return NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+	}
+	if err := d.PinRemove(pinId); err != nil {
+		e.mu.Unlock()
+		return err
+	}
+	delete(e.pinStates, pinId)
+	e.mu.Unlock()
+	e.pinRemoved <- pinId
+	return nil
+}
+
+// Claim claims a pin of the board, as devices' pins can't be driven
+// directly.
+func (e *Expanded) Claim(pinId string, owner string) error {
+	if _, ok := e.owners[pinId]; ok {
+		return NewError(CodeUnsupported, pinId, "Pin "+pinId+" belongs to a device, and can't be claimed")
+	}
+	board, ok := e.GPIOInterface.(Claimer)
+	if !ok {
+		return NewError(CodeUnsupported, pinId, "Pins of this board can't be claimed")
+	}
+	return board.Claim(pinId, owner)
+}
+
+func (e *Expanded) Release(pinId string) {
+	if board, ok := e.GPIOInterface.(Claimer); ok {
+		board.Release(pinId)
+	}
+}
@@ -0,0 +1,63 @@
+package gpio
+
+import "testing"
+
+func TestExpandedForwardsInOrder(t *testing.T) {
+	changed, added, removed := make(chan PinState, 10), make(chan PinState, 10), make(chan string, 10)
+	e := Expand(&GPIO{})
+	if err := e.Init(changed, added, removed, map[string]PinState{}); err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	// the board's events are handed on by the time each call returns, so
+	// the server can collect those of a write
+	if err := e.PinInit("P8_10", Out, Pull_None, "P8_10"); err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 1 {
+		t.Fatalf("got %d PinAdded events after PinInit returned, want 1", len(added))
+	}
+	for _, val := range []byte{1, 0, 1} {
+		if err := e.PinSet("P8_10", val); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case pin := <-changed:
+			if pin.PinId != "P8_10" || pin.State != val {
+				t.Errorf("got %s at %d, want P8_10 at %d", pin.PinId, pin.State, val)
+			}
+		default:
+			t.Fatalf("no PinState event after PinSet %d returned", val)
+		}
+	}
+	if err := e.PinRemove("P8_10"); err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 {
+		t.Errorf("got %d PinRemoved events after PinRemove returned, want 1", len(removed))
+	}
+}
+
+func TestExpandedClaimsBoardPins(t *testing.T) {
+	board := &GPIO{}
+	e := Expand(board)
+	if err := e.Init(make(chan PinState, 10), make(chan PinState, 10), make(chan string, 10), map[string]PinState{}); err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	if err := e.Claim("P8_07", "a sensor"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := board.claimedBy("P8_07"); !ok {
+		t.Error("claimed a pin, but not from the board")
+	}
+	if err := e.PinInit("P8_07", Out, Pull_None, "P8_07"); CodeOf(err) != CodeUnsupported {
+		t.Errorf("initialising a claimed pin: got %v, want an Unsupported error", err)
+	}
+	e.Release("P8_07")
+	if err := e.PinInit("P8_07", Out, Pull_None, "P8_07"); err != nil {
+		t.Errorf("initialising a released pin: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package gpio
+
+// ErrorCode classifies an error reported to clients. Codes are stable, so
+// clients can act on them rather than parsing messages.
+type ErrorCode string
+
+const (
+	// CodeUnknownCommand is for a command the server doesn't know.
+	CodeUnknownCommand ErrorCode = "UnknownCommand"
+	// CodeInvalidArguments is for a command with missing or extra arguments.
+	CodeInvalidArguments ErrorCode = "InvalidArguments"
+	// CodeUnknownPin is for a pin that doesn't exist or hasn't been initialised.
+	CodeUnknownPin ErrorCode = "UnknownPin"
+	// CodeNotFound is for a named group, scene, job or rule that doesn't exist.
+	CodeNotFound ErrorCode = "NotFound"
+	// CodeInvalidValue is for an argument outside its allowed values.
+	CodeInvalidValue ErrorCode = "InvalidValue"
+	// CodeUnsupported is for an operation the pin or board can't do.
+	CodeUnsupported ErrorCode = "Unsupported"
+	// CodeHardwareFailure is for the hardware, or its driver, failing.
+	CodeHardwareFailure ErrorCode = "HardwareFailure"
+)
+
+// Error is an error with a code, and the pin it concerns if any.
+type Error struct {
+	Code  ErrorCode
+	PinId string
+	Msg   string
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// NewError returns an Error about pinId, which may be empty.
+func NewError(code ErrorCode, pinId string, msg string) error {
+	return &Error{code, pinId, msg}
+}
+
+// CodeOf returns the code of err. Errors without one come from drivers, so
+// are hardware failures.
+func CodeOf(err error) ErrorCode {
+	if e, ok := err.(*Error); ok {
+		return e.Code
+	}
+	return CodeHardwareFailure
+}
+
+// checkValue verifies val can be written to pin.
+func checkValue(pin PinState, val byte) error {
+	switch {
+	case pin.Dir == In:
+		return NewError(CodeUnsupported, pin.PinId, "Pin "+pin.PinId+" is an input")
+	case pin.Dir == Analog:
+		return NewError(CodeUnsupported, pin.PinId, "Pin "+pin.PinId+" is an analog input")
+	case pin.Dir == Counter || pin.Dir == Encoder:
+		return NewError(CodeUnsupported, pin.PinId, "Pin "+pin.PinId+" is a counter")
+	case pin.Dir == Out && val > 1:
+		return NewError(CodeInvalidValue, pin.PinId, "Invalid value for digital pin "+pin.PinId+", must be 0 or 1")
+	case pin.Dir == Servo && val > 180:
+		return NewError(CodeInvalidValue, pin.PinId, "Invalid angle for servo pin "+pin.PinId+", must be 0-180")
+	}
+	return nil
+}
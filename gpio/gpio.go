@@ -0,0 +1,192 @@
+//go:build !linux || !arm
+// +build !linux !arm
+
+package gpio
+
+type GPIO struct {
+	claims
+
+	pinStates       map[string]PinState
+	pinStateChanged chan PinState
+	pinAdded        chan PinState
+	pinRemoved      chan string
+}
+
+func (g *GPIO) Init(pinStateChanged chan PinState, pinAdded chan PinState, pinRemoved chan string, states map[string]PinState) error {
+	g.pinStateChanged = pinStateChanged
+	g.pinRemoved = pinRemoved
+	g.pinAdded = pinAdded
+	g.pinStates = states
+
+	// now init pins
+	for key, pinState := range g.pinStates {
+		if pinState.Name == "" {
+			pinState.Name = pinState.PinId
+		}
+		g.PinInit(key, pinState.Dir, pinState.Pullup, pinState.Name)
+		g.PinSet(key, pinState.State)
+		if pinState.Dir == Analog && pinState.Analog != nil {
+			g.PinSetSampling(key, *pinState.Analog)
+		}
+		if pinState.Counter != nil {
+			g.PinSetCounter(key, *pinState.Counter)
+		}
+	}
+	return nil
+}
+
+func (g *GPIO) Close() error {
+	for pinId := range g.pinStates {
+		g.unhold(pinId)
+	}
+	return nil
+}
+func (g *GPIO) PinMap() ([]PinDef, error) {
+	// return a mock pinmap for this mock interface
+	pinmap := []PinDef{
+		{
+			"P8_07",
+			[]string{"66", "GPIO_66", "TIMER4"},
+			[]string{"analog", "digital", "pwm"},
+			66,
+			0,
+		}, {
+			"P8_08",
+			[]string{"67", "GPIO_67", "TIMER7"},
+			[]string{"analog", "digital", "pwm"},
+			67,
+			0,
+		}, {
+			"P8_09",
+			[]string{"69", "GPIO_69", "TIMER5"},
+			[]string{"analog", "digital", "pwm"},
+			69,
+			0,
+		}, {
+			"P8_10",
+			[]string{"68", "GPIO_68", "TIMER6"},
+			[]string{"analog", "digital", "pwm"},
+			68,
+			0,
+		}, {
+			"P8_11",
+			[]string{"45", "GPIO_45"},
+			[]string{"analog", "digital", "pwm"},
+			45,
+			0,
+		},
+	}
+	return pinmap, nil
+}
+func (g *GPIO) Host() (string, error) {
+	return "fake", nil
+}
+func (g *GPIO) PinStates() (map[string]PinState, error) {
+	// a copy, as the real backends return, so callers can't see or make
+	// later changes
+	pinStates := make(map[string]PinState, len(g.pinStates))
+	for key, pinState := range g.pinStates {
+		pinStates[key] = pinState
+	}
+	return pinStates, nil
+}
+func (g *GPIO) PinInit(pinId string, dir Direction, pullup PullUp, name string) error {
+	// add a pin
+
+	// look up internal ID (we're going to assume its correct already)
+
+	if encoder, ok := encoderOf(g.pinStates, pinId); ok {
+		return NewError(CodeUnsupported, pinId, "Pin "+pinId+" is the B pin of encoder "+encoder)
+	}
+	if err := g.hold(pinId); err != nil {
+		return err
+	}
+
+	// make a pinstate object
+	pinState := PinState{
+		PinId:  pinId,
+		Dir:    dir,
+		Pullup: pullup,
+		Name:   name,
+	}
+
+	g.pinStates[pinId] = pinState
+
+	g.pinAdded <- pinState
+	return nil
+}
+func (g *GPIO) PinSet(pinId string, val byte) error {
+	// change pin state
+	if pin, ok := g.pinStates[pinId]; ok {
+		if err := checkValue(pin, val); err != nil {
+			return err
+		}
+		// we have a value....
+		pin.State = val
+		g.pinStates[pinId] = pin
+		// notify channel of new pinstate
+		g.pinStateChanged <- pin
+		return nil
+	}
+	return NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+}
+func (g *GPIO) PinSetSampling(pinId string, config AnalogConfig) error {
+	// there's nothing to sample, but keep the settings
+	pin, ok := g.pinStates[pinId]
+	if !ok {
+		return NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+	}
+	if pin.Dir != Analog {
+		return NewError(CodeUnsupported, pinId, "Pin "+pinId+" is not an analog input")
+	}
+	if _, _, _, err := config.params(pinId); err != nil {
+		return err
+	}
+	pin.Analog = &config
+	g.pinStates[pinId] = pin
+	g.pinStateChanged <- pin
+	return nil
+}
+func (g *GPIO) PinSetCounter(pinId string, config CounterConfig) error {
+	// there's nothing to count, but keep the settings
+	pin, ok := g.pinStates[pinId]
+	if !ok {
+		return NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+	}
+	if err := config.check(pin, g.pinStates, &g.claims); err != nil {
+		return err
+	}
+	pin.Counter = &config
+	g.pinStates[pinId] = pin
+	g.pinStateChanged <- pin
+	return nil
+}
+func (g *GPIO) PinResetCounter(pinId string) error {
+	pin, ok := g.pinStates[pinId]
+	if !ok {
+		return NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+	}
+	if pin.Dir != Counter && pin.Dir != Encoder {
+		return NewError(CodeUnsupported, pinId, "Pin "+pinId+" is not a counter")
+	}
+	setCount(&pin, 0, 0, pulsesPerRev(pin))
+	g.pinStates[pinId] = pin
+	g.pinStateChanged <- pin
+	return nil
+}
+func (g *GPIO) PinPulse(pinId string) error {
+	// there's nothing to pulse, and pinStates may only be read from the
+	// goroutine setting pins
+	return nil
+}
+func (g *GPIO) PinRemove(pinId string) error {
+	// remove a pin
+	if _, ok := g.pinStates[pinId]; ok {
+		// normally you would close the pin here
+		delete(g.pinStates, pinId)
+		g.unhold(pinId)
+		g.pinRemoved <- pinId
+		return nil
+	}
+	return NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+}
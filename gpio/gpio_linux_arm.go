@@ -0,0 +1,850 @@
+//go:build linux && arm
+// +build linux,arm
+
+package gpio
+
+import (
+	"github.com/kidoman/embd"
+	_ "github.com/kidoman/embd/host/all"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+func gpioPWMPin(pinId string, value byte) {
+	// detect host to determine if we should use go-pi-blaster or embd
+	host, _, err := embd.DetectHost()
+	if err != nil {
+		log.Println(err)
+		h.broadcastSys <- []byte("Error detecting gpio host " + err.Error())
+		return
+	}
+	if host == embd.HostRPi {
+		// get pin map to lookup logical pin from string name
+		desc, err := embd.DescribeHost()
+		if err != nil {
+			log.Println(err)
+			h.broadcastSys <- []byte("Error describing gpio pinmap " + err.Error())
+			return
+		}
+
+		pinmap := desc.GPIODriver().PinMap()
+
+		pd, found := pinmap.Lookup(pinId, 1)
+
+		if !found {
+			log.Println("Pin " + pinId + " not found : ",(found))
+			return
+		}
+
+		b.Apply(int64(pd.DigitalLogical), float64(value)/100.0)
+
+	} else if host == embd.HostBBB {
+		// UNTESTED!
+		pwm, err := embd.NewPWMPin(pinId)
+		if err != nil {
+			log.Println("Failed to create PWM Pin on " + pinId + " : " + err.Error())
+			h.broadcastSys <- []byte("Error creating PWM Pin " + err.Error())
+			return
+		}
+
+		if err := pwm.SetAnalog(value); err != nil {
+			log.Println("Failed to create PWM SetAnalog on " + pinId + " : " + err.Error())
+			h.broadcastSys <- []byte("Error creating PWM SetAnalog " + err.Error())
+		}
+	}
+}
+*/
+
+// analogFullScale is the largest raw analog reading, 1.8V in millivolts on a
+// BeagleBone, which is scaled to a State of 255.
+const analogFullScale = 1800
+
+// analogPin is an analog input, sampled by its own goroutine until stop is
+// closed, which then closes done.
+type analogPin struct {
+	pin  embd.AnalogPin
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newAnalogPin(p embd.AnalogPin) *analogPin {
+	return &analogPin{p, make(chan struct{}), make(chan struct{})}
+}
+
+// stopSampling stops sampling a, and waits for its goroutine to finish. It
+// must not be called with mu held.
+func (a *analogPin) stopSampling() {
+	close(a.stop)
+	<-a.done
+}
+
+// counterPin is a counter or encoder input, whose edges are counted as they
+// come, and reported by its own goroutine until stop is closed, which then
+// closes done.
+type counterPin struct {
+	pin embd.DigitalPin
+	// an encoder's B pin and its id, nil when it has none
+	pinB   embd.DigitalPin
+	pinBId string
+	count  *edgeCounter
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// stopCounting stops counting c, and waits for its goroutine to finish,
+// closing its B pin, which it gives back to claims, but leaving its own open.
+// It must not be called with mu held.
+func (c *counterPin) stopCounting(claims *claims) {
+	close(c.stop)
+	<-c.done
+	c.pin.StopWatching()
+	if c.pinB != nil {
+		c.pinB.StopWatching()
+		c.pinB.Close()
+		claims.unhold(c.pinBId)
+	}
+}
+
+type GPIO struct {
+	claims
+
+	// guards pinStates, which input watchers update from their own goroutines
+	mu sync.Mutex
+
+	pinStates       map[string]PinState
+	pinStateChanged chan PinState
+	pinAdded        chan PinState
+	pinRemoved      chan string
+}
+
+func (g *GPIO) Init(pinStateChanged chan PinState, pinAdded chan PinState, pinRemoved chan string, states map[string]PinState) error {
+	g.pinStateChanged = pinStateChanged
+	g.pinRemoved = pinRemoved
+	g.pinAdded = pinAdded
+	// keep our own copy, so we can range over states while watchers update it
+	g.pinStates = make(map[string]PinState, len(states))
+	for key, pinState := range states {
+		g.pinStates[key] = pinState
+	}
+
+	// if its a raspberry pi initialize pi-blaster too
+	host, _, err := embd.DetectHost()
+	if err != nil {
+		return err
+	}
+	if host == embd.HostRPi {
+		InitBlaster()
+	}
+
+	err = embd.InitGPIO()
+	if err != nil {
+		return err
+	}
+	// now init pins
+	for key, pinState := range states {
+		if pinState.Name == "" {
+			pinState.Name = pinState.PinId
+		}
+		// analog pins are sampled as restored, with their saved settings
+		g.PinInit(key, pinState.Dir, pinState.Pullup, pinState.Name)
+		if pinState.Dir == Out || pinState.Dir == PWM || pinState.Dir == Servo {
+			g.PinSet(key, pinState.State)
+		}
+	}
+	return nil
+}
+
+func (g *GPIO) Close() error {
+	// close all the pins we have open if any
+	for _, pinState := range g.copyPinStates() {
+		if pinState.Pin != nil {
+			switch pinObj := pinState.Pin.(type) {
+			case embd.DigitalPin:
+				if pinState.Dir == In {
+					pinObj.StopWatching()
+				}
+				pinObj.Close()
+			case embd.PWMPin:
+				pinObj.Close()
+			case BlasterPin:
+				pinObj.Close()
+			case *analogPin:
+				pinObj.stopSampling()
+				pinObj.pin.Close()
+			case *counterPin:
+				pinObj.stopCounting(&g.claims)
+				pinObj.pin.Close()
+			}
+		}
+		g.unhold(pinState.PinId)
+	}
+
+	// if its a raspberry pi close pi-blaster too
+	host, _, err := embd.DetectHost()
+	if err != nil {
+		return err
+	}
+	if host == embd.HostRPi {
+		CloseBlaster()
+	}
+
+	err = embd.CloseGPIO()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+func (g *GPIO) PinMap() ([]PinDef, error) {
+	desc, err := embd.DescribeHost()
+	if err != nil {
+		return nil, err
+	}
+
+	// wrap pinmap in a struct to make the json easier to parse on the other end
+	embdMap := desc.GPIODriver().PinMap()
+	pinMap := make([]PinDef, len(embdMap))
+	// convert to PinDef format
+	for i := 0; i < len(embdMap); i++ {
+		pinDesc := embdMap[i]
+		caps := make([]string, 0)
+
+		if pinDesc.Caps&embd.CapDigital != 0 {
+			caps = append(caps, "Digital")
+		}
+		if pinDesc.Caps&embd.CapAnalog != 0 {
+			caps = append(caps, "Analog")
+		}
+		if pinDesc.Caps&embd.CapPWM != 0 {
+			caps = append(caps, "PWM")
+		}
+		if pinDesc.Caps&embd.CapI2C != 0 {
+			caps = append(caps, "I2C")
+		}
+		if pinDesc.Caps&embd.CapUART != 0 {
+			caps = append(caps, "UART")
+		}
+		if pinDesc.Caps&embd.CapSPI != 0 {
+			caps = append(caps, "SPI")
+		}
+		if pinDesc.Caps&embd.CapGPMC != 0 {
+			caps = append(caps, "GPMC")
+		}
+		if pinDesc.Caps&embd.CapLCD != 0 {
+			caps = append(caps, "LCD")
+		}
+
+		pinMap[i] = PinDef{
+			pinDesc.ID,
+			pinDesc.Aliases,
+			caps,
+			pinDesc.DigitalLogical,
+			pinDesc.AnalogLogical,
+		}
+	}
+	return pinMap, nil
+}
+func (g *GPIO) Host() (string, error) {
+	host, _, err := embd.DetectHost()
+	if err != nil {
+		return "", err
+	}
+	return string(host), nil
+}
+func (g *GPIO) PinStates() (map[string]PinState, error) {
+	return g.copyPinStates(), nil
+}
+
+func (g *GPIO) copyPinStates() map[string]PinState {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	pinStates := make(map[string]PinState, len(g.pinStates))
+	for key, pinState := range g.pinStates {
+		pinStates[key] = pinState
+	}
+	return pinStates
+}
+
+// inputChanged returns the edge handler for an input pin, which records its
+// new state and reports it.
+func (g *GPIO) inputChanged(pinId string) func(embd.DigitalPin) {
+	return func(p embd.DigitalPin) {
+		val, err := p.Read()
+		if err != nil {
+			log.Println("Failed to read input " + pinId + " : " + err.Error())
+			return
+		}
+		g.mu.Lock()
+		pin, ok := g.pinStates[pinId]
+		if !ok || pin.State == byte(val) {
+			g.mu.Unlock()
+			return
+		}
+		pin.State = byte(val)
+		g.pinStates[pinId] = pin
+		g.mu.Unlock()
+		g.pinStateChanged <- pin
+	}
+}
+
+// sample reads analog pin a every interval until it is stopped, and reports
+// the average of its last readings whenever it changes by at least the
+// threshold.
+func (g *GPIO) sample(pinId string, a *analogPin, config AnalogConfig) {
+	defer close(a.done)
+	interval, samples, threshold, err := config.params(pinId)
+	if err != nil {
+		log.Println("Invalid sampling settings for " + pinId + ", using the defaults : " + err.Error())
+		interval, samples, threshold, _ = AnalogConfig{}.params(pinId)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var window []int
+	reported := -1
+	failing := false
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+		}
+		val, err := a.pin.Read()
+		if err != nil {
+			if !failing {
+				log.Println("Failed to read analog pin " + pinId + " : " + err.Error())
+			}
+			failing = true
+			continue
+		}
+		failing = false
+
+		window = append(window, val)
+		if len(window) > samples {
+			window = window[1:]
+		}
+		sum := 0
+		for _, v := range window {
+			sum += v
+		}
+		avg := sum / len(window)
+		change := avg - reported
+		if change < 0 {
+			change = -change
+		}
+		if avg == reported || (reported >= 0 && change < threshold) {
+			continue
+		}
+		reported = avg
+
+		g.mu.Lock()
+		pin, ok := g.pinStates[pinId]
+		if !ok || pin.Pin != a {
+			g.mu.Unlock()
+			return
+		}
+		pin.Raw = avg
+		pin.State = byte(255)
+		if avg < analogFullScale {
+			pin.State = byte(avg * 255 / analogFullScale)
+		}
+		g.pinStates[pinId] = pin
+		g.mu.Unlock()
+		g.pinStateChanged <- pin
+	}
+}
+
+// startCounting starts counting the edges of c, from count, and reporting
+// them. If it fails, c is left stopped.
+func (g *GPIO) startCounting(pinId string, c *counterPin, dir Direction, pullup PullUp, config CounterConfig, count int64) error {
+	interval, pulsesPerRev, err := config.params(pinId)
+	if err != nil {
+		log.Println("Invalid counter settings for " + pinId + ", using the defaults : " + err.Error())
+		config = CounterConfig{}
+		interval, pulsesPerRev, _ = config.params(pinId)
+	}
+	c.count = newEdgeCounter(count)
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	if dir == Encoder && config.PinB != "" {
+		if err = g.hold(config.PinB); err == nil {
+			if err = c.watchQuadrature(config.PinB, pullup); err != nil {
+				g.unhold(config.PinB)
+			}
+		}
+	} else {
+		err = c.pin.Watch(embd.EdgeRising, func(embd.DigitalPin) { c.count.pulse() })
+	}
+	if err != nil {
+		close(c.done)
+		return err
+	}
+	go g.countEdges(pinId, c, interval, pulsesPerRev)
+	return nil
+}
+
+// watchQuadrature opens the B pin of an encoder, pulled like A where the
+// board can, and decodes the edges of both.
+func (c *counterPin) watchQuadrature(pinB string, pullup PullUp) error {
+	b, err := embd.NewDigitalPin(pinB)
+	if err != nil {
+		return err
+	}
+	if err := b.SetDirection(embd.In); err != nil {
+		b.Close()
+		return err
+	}
+	if pullup == Pull_Up {
+		b.PullUp()
+	} else if pullup == Pull_Down {
+		b.PullDown()
+	}
+	a, _ := c.pin.Read()
+	bv, _ := b.Read()
+	c.count.ab = byte(a&1)<<1 | byte(bv&1)
+	handler := func(embd.DigitalPin) {
+		a, errA := c.pin.Read()
+		bv, errB := b.Read()
+		if errA == nil && errB == nil {
+			c.count.step(a, bv)
+		}
+	}
+	if err := c.pin.Watch(embd.EdgeBoth, handler); err != nil {
+		b.Close()
+		return err
+	}
+	if err := b.Watch(embd.EdgeBoth, handler); err != nil {
+		c.pin.StopWatching()
+		b.Close()
+		return err
+	}
+	c.pinB, c.pinBId = b, pinB
+	return nil
+}
+
+// countEdges reports the count of c and its rate every interval, when they
+// change, until it is stopped.
+func (g *GPIO) countEdges(pinId string, c *counterPin, interval time.Duration, pulsesPerRev int) {
+	defer close(c.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+		// taken with mu held, so a reset can't be overwritten by an older
+		// count
+		g.mu.Lock()
+		count, freq := c.count.rate()
+		pin, ok := g.pinStates[pinId]
+		if !ok || pin.Pin != c {
+			g.mu.Unlock()
+			return
+		}
+		if pin.Count == count && pin.Freq == freq {
+			g.mu.Unlock()
+			continue
+		}
+		setCount(&pin, count, freq, pulsesPerRev)
+		g.pinStates[pinId] = pin
+		g.mu.Unlock()
+		g.pinStateChanged <- pin
+	}
+}
+
+func (g *GPIO) PinInit(pinId string, dir Direction, pullup PullUp, name string) error {
+	var pin interface{}
+	state := byte(0)
+
+	g.mu.Lock()
+	existing, initialised := g.pinStates[pinId]
+	encoder, isB := encoderOf(g.pinStates, pinId)
+	g.mu.Unlock()
+	if isB {
+		return NewError(CodeUnsupported, pinId, "Pin "+pinId+" is the B pin of encoder "+encoder)
+	}
+	if err := g.hold(pinId); err != nil {
+		return err
+	}
+	defer func() {
+		// a pin that failed to open isn't held
+		if !initialised {
+			g.unhold(pinId)
+		}
+	}()
+
+	// stop sampling or counting a pin initialised again, so it can be opened
+	// afresh
+	switch p := existing.Pin.(type) {
+	case *analogPin:
+		p.stopSampling()
+		p.pin.Close()
+	case *counterPin:
+		p.stopCounting(&g.claims)
+		p.pin.Close()
+	}
+	switch existing.Pin.(type) {
+	case *analogPin, *counterPin:
+		g.mu.Lock()
+		existing.Pin = nil
+		g.pinStates[pinId] = existing
+		g.mu.Unlock()
+	}
+
+	if dir == Analog {
+		p, err := embd.NewAnalogPin(pinId)
+		if err != nil {
+			log.Println("Failed to create analog pin using key ", pinId, " : ", err.Error())
+			return err
+		}
+		pin = newAnalogPin(p)
+	} else if dir == PWM || dir == Servo {
+
+		host, _, err := embd.DetectHost()
+		if err != nil {
+			return err
+		}
+		if host == embd.HostRPi {
+			// use pi blaster pin
+			log.Println("Creating PWM pin on Pi")
+
+			// lookup the pinId in the map
+			pinMap, err := g.PinMap()
+			if err != nil {
+				return err
+			}
+			if pinDesc, ok := Lookup(pinMap, pinId); ok {
+				// we found a pin with that name....what is its first Alias?
+				pinIdInt, err := strconv.Atoi(pinDesc.Aliases[0])
+				if err != nil {
+					log.Println("Failed to parse int from alias : ", pinDesc.Aliases[0])
+					return err
+				}
+				p := NewBlasterPin(pinIdInt)
+				pin = p
+			} else {
+				log.Println("Failed to find Pin ", pinId)
+				return NewError(CodeUnknownPin, pinId, "Failed to find pin "+pinId)
+			}
+		} else {
+			// bbb, so use embd since pwm pins work there
+			p, err := embd.NewPWMPin(pinId)
+			if err != nil {
+				log.Println("Failed to create PWM Pin using key ", pinId, " : ", err.Error())
+				return err
+			}
+			if dir == Servo {
+				// servos expect a pulse every 20ms
+				if err := p.SetPeriod(20000000); err != nil {
+					return err
+				}
+			}
+			pin = p
+		}
+	} else {
+		// add a pin
+		p, err := embd.NewDigitalPin(pinId)
+		if err != nil {
+			return err
+		}
+		pin = p
+
+		embdDir := embd.In
+		if dir == Out {
+			embdDir = embd.Out
+		}
+		err = p.SetDirection(embdDir)
+		if err != nil {
+			return err
+		}
+
+		if pullup == Pull_Up {
+			err = p.PullUp()
+
+			// pullup and down not implemented on rpi host so we need to manually set initial states
+			// not ideal as a pullup really isn't the same thing but it works for most use cases
+
+			if err != nil {
+				log.Println("Failed to set pullup on " + pinId + " setting high state instead : " + err.Error())
+				// we failed to set pullup, so lets set initial state high instead
+				err = p.Write(1)
+				state = 1
+				if err != nil {
+					return err
+				}
+			}
+		} else if pullup == Pull_Down {
+			err = p.PullDown()
+
+			if err != nil {
+
+				log.Println("Failed to set pulldown on " + pinId + " setting low state instead : " + err.Error())
+
+				err = p.Write(0)
+				state = 1
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if dir == In {
+			if val, err := p.Read(); err == nil {
+				state = byte(val)
+			}
+			// report changes as they happen; a pin initialised again may
+			// already be watched
+			p.StopWatching()
+			if err := p.Watch(embd.EdgeBoth, g.inputChanged(pinId)); err != nil {
+				log.Println("Failed to watch input " + pinId + ", its changes won't be reported : " + err.Error())
+			}
+		}
+		if dir == Counter || dir == Encoder {
+			// counting starts once its state is stored
+			p.StopWatching()
+			pin = &counterPin{pin: p}
+		}
+	}
+
+	// test to see if we already have a state for this pin
+	g.mu.Lock()
+	existingPin, exists := g.pinStates[pinId]
+	if exists {
+		existingPin.Pin = pin
+		existingPin.Name = name
+		existingPin.Dir = dir
+		existingPin.State = state
+		existingPin.Pullup = pullup
+		existingPin.Raw = 0
+		existingPin.Count, existingPin.Freq, existingPin.RPM = 0, 0, 0
+		if dir != Analog {
+			existingPin.Analog = nil
+		}
+		if dir != Counter && dir != Encoder {
+			existingPin.Counter = nil
+		}
+		g.pinStates[pinId] = existingPin
+		g.mu.Unlock()
+
+		g.pinStateChanged <- existingPin
+		g.pinRemoved <- pinId
+		g.pinAdded <- existingPin
+	} else {
+		existingPin = PinState{Pin: pin, PinId: pinId, Dir: dir, State: state, Pullup: pullup, Name: name}
+		g.pinStates[pinId] = existingPin
+		g.mu.Unlock()
+		initialised = true
+		g.pinAdded <- existingPin
+	}
+
+	if a, ok := pin.(*analogPin); ok {
+		var config AnalogConfig
+		if existingPin.Analog != nil {
+			config = *existingPin.Analog
+		}
+		go g.sample(pinId, a, config)
+	}
+	if c, ok := pin.(*counterPin); ok {
+		var config CounterConfig
+		if existingPin.Counter != nil {
+			config = *existingPin.Counter
+		}
+		if err := g.startCounting(pinId, c, dir, pullup, config, 0); err != nil {
+			log.Println("Failed to count edges of " + pinId + " : " + err.Error())
+			return err
+		}
+	}
+	return nil
+}
+func (g *GPIO) PinSet(pinId string, val byte) error {
+	// change pin state
+	g.mu.Lock()
+	pin, ok := g.pinStates[pinId]
+	g.mu.Unlock()
+	if ok {
+		if err := checkValue(pin, val); err != nil {
+			return err
+		}
+		// we have a value....
+		switch pinObj := pin.Pin.(type) {
+		case embd.DigitalPin:
+			err := pinObj.Write(int(val))
+			if err != nil {
+				return err
+			}
+		case embd.PWMPin:
+			if pin.Dir == Servo {
+				if err := pinObj.SetMicroseconds(servoPulse(val)); err != nil {
+					return err
+				}
+			} else if err := pinObj.SetAnalog(val); err != nil {
+				return err
+			}
+		case BlasterPin:
+			if pin.Dir == Servo {
+				if err := pinObj.WritePulse(servoPulse(val)); err != nil {
+					return err
+				}
+			} else if err := pinObj.Write(val); err != nil {
+				return err
+			}
+		}
+		pin.State = val
+		g.mu.Lock()
+		g.pinStates[pinId] = pin
+		g.mu.Unlock()
+		// notify channel of new pinstate
+		g.pinStateChanged <- pin
+		return nil
+	}
+	return NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+}
+func (g *GPIO) PinSetSampling(pinId string, config AnalogConfig) error {
+	g.mu.Lock()
+	pin, ok := g.pinStates[pinId]
+	g.mu.Unlock()
+	if !ok {
+		return NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+	}
+	old, ok := pin.Pin.(*analogPin)
+	if !ok {
+		return NewError(CodeUnsupported, pinId, "Pin "+pinId+" is not an analog input")
+	}
+	if _, _, _, err := config.params(pinId); err != nil {
+		return err
+	}
+	// restart sampling with the new settings
+	old.stopSampling()
+	a := newAnalogPin(old.pin)
+	g.mu.Lock()
+	pin = g.pinStates[pinId]
+	pin.Pin = a
+	pin.Analog = &config
+	g.pinStates[pinId] = pin
+	g.mu.Unlock()
+	go g.sample(pinId, a, config)
+	g.pinStateChanged <- pin
+	return nil
+}
+func (g *GPIO) PinSetCounter(pinId string, config CounterConfig) error {
+	g.mu.Lock()
+	pin, ok := g.pinStates[pinId]
+	var err error
+	if ok {
+		err = config.check(pin, g.pinStates, &g.claims)
+	}
+	g.mu.Unlock()
+	if !ok {
+		return NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+	}
+	if err != nil {
+		return err
+	}
+	old, ok := pin.Pin.(*counterPin)
+	if !ok {
+		return NewError(CodeUnsupported, pinId, "Pin "+pinId+" is not a counter")
+	}
+	// restart counting with the new settings, from the same count
+	old.stopCounting(&g.claims)
+	count, _ := old.count.rate()
+	c := &counterPin{pin: old.pin}
+	g.mu.Lock()
+	pin = g.pinStates[pinId]
+	pin.Pin = c
+	pin.Counter = &config
+	g.pinStates[pinId] = pin
+	g.mu.Unlock()
+	if err := g.startCounting(pinId, c, pin.Dir, pin.Pullup, config, count); err != nil {
+		log.Println("Failed to count edges of " + pinId + " : " + err.Error())
+		return err
+	}
+	g.pinStateChanged <- pin
+	return nil
+}
+func (g *GPIO) PinResetCounter(pinId string) error {
+	g.mu.Lock()
+	pin, ok := g.pinStates[pinId]
+	if !ok {
+		g.mu.Unlock()
+		return NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+	}
+	c, ok := pin.Pin.(*counterPin)
+	if !ok {
+		g.mu.Unlock()
+		return NewError(CodeUnsupported, pinId, "Pin "+pinId+" is not a counter")
+	}
+	c.count.reset()
+	setCount(&pin, 0, 0, pulsesPerRev(pin))
+	g.pinStates[pinId] = pin
+	g.mu.Unlock()
+	g.pinStateChanged <- pin
+	return nil
+}
+func (g *GPIO) PinPulse(pinId string) error {
+	g.mu.Lock()
+	pin, ok := g.pinStates[pinId]
+	g.mu.Unlock()
+	if !ok {
+		return NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+	}
+	pinObj, ok := pin.Pin.(embd.DigitalPin)
+	if !ok || pin.Dir != Out {
+		return NewError(CodeUnsupported, pinId, "Pin "+pinId+" is not a digital output")
+	}
+	if err := pinObj.Write(1); err != nil {
+		return err
+	}
+	return pinObj.Write(0)
+}
+func (g *GPIO) PinRemove(pinId string) error {
+	// remove a pin
+	g.mu.Lock()
+	pin, ok := g.pinStates[pinId]
+	g.mu.Unlock()
+	if ok {
+		var err error
+		switch pinObj := pin.Pin.(type) {
+		case embd.DigitalPin:
+			if pin.Dir == In {
+				pinObj.StopWatching()
+			}
+			err = pinObj.Close()
+			if err != nil {
+				return err
+			}
+		case embd.PWMPin:
+			err = pinObj.Close()
+			if err != nil {
+				return err
+			}
+		case BlasterPin:
+			err = pinObj.Close()
+			if err != nil {
+				return err
+			}
+		case *analogPin:
+			pinObj.stopSampling()
+			err = pinObj.pin.Close()
+			if err != nil {
+				return err
+			}
+		case *counterPin:
+			pinObj.stopCounting(&g.claims)
+			err = pinObj.pin.Close()
+			if err != nil {
+				return err
+			}
+		}
+		g.mu.Lock()
+		delete(g.pinStates, pinId)
+		g.mu.Unlock()
+		g.unhold(pinId)
+		g.pinRemoved <- pinId
+		return nil
+	}
+	return NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+}
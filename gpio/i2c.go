@@ -0,0 +1,20 @@
+package gpio
+
+// I2C is a connection to one device on an I2C bus.
+type I2C interface {
+	// ReadReg reads len(data) bytes from consecutive registers, starting at
+	// reg.
+	ReadReg(reg byte, data []byte) error
+	// WriteReg writes data to consecutive registers, starting at reg.
+	WriteReg(reg byte, data []byte) error
+	// Read reads data from a device without registers, like the PCF8574.
+	Read(data []byte) error
+	// Write writes data to a device without registers.
+	Write(data []byte) error
+	Close() error
+}
+
+// OpenI2C opens the device at addr on bus /dev/i2c-<bus>.
+func OpenI2C(bus byte, addr byte) (I2C, error) {
+	return openI2C(bus, addr)
+}
@@ -0,0 +1,68 @@
+//go:build linux && arm
+// +build linux,arm
+
+package gpio
+
+import (
+	"sync"
+
+	"github.com/kidoman/embd"
+)
+
+var (
+	// guards i2cUsers, the number of devices open, as embd's I2C driver is
+	// initialised and closed once for all buses
+	i2cMu    sync.Mutex
+	i2cUsers int
+)
+
+// i2cDevice is the device at addr on a bus driven through embd, which is
+// shared with the other devices on it.
+type i2cDevice struct {
+	bus  embd.I2CBus
+	addr byte
+}
+
+func openI2C(bus byte, addr byte) (I2C, error) {
+	i2cMu.Lock()
+	defer i2cMu.Unlock()
+	if i2cUsers == 0 {
+		if err := embd.InitI2C(); err != nil {
+			return nil, err
+		}
+	}
+	i2cUsers++
+	return &i2cDevice{embd.NewI2CBus(bus), addr}, nil
+}
+
+func (d *i2cDevice) ReadReg(reg byte, data []byte) error {
+	return d.bus.ReadFromReg(d.addr, reg, data)
+}
+
+func (d *i2cDevice) WriteReg(reg byte, data []byte) error {
+	return d.bus.WriteToReg(d.addr, reg, data)
+}
+
+func (d *i2cDevice) Read(data []byte) error {
+	received, err := d.bus.ReadBytes(d.addr, len(data))
+	if err != nil {
+		return err
+	}
+	copy(data, received)
+	return nil
+}
+
+func (d *i2cDevice) Write(data []byte) error {
+	return d.bus.WriteBytes(d.addr, data)
+}
+
+// Close leaves the bus open for the other devices, until the last is closed.
+func (d *i2cDevice) Close() error {
+	i2cMu.Lock()
+	defer i2cMu.Unlock()
+	i2cUsers--
+	if i2cUsers == 0 {
+		return embd.CloseI2C()
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux || !arm
+// +build !linux !arm
+
+package gpio
+
+func openI2C(bus byte, addr byte) (I2C, error) {
+	return nil, NewError(CodeUnsupported, "", "I2C is not supported on this board")
+}
@@ -0,0 +1,46 @@
+package gpio
+
+// i2cWrite is a write to consecutive registers from reg.
+type i2cWrite struct {
+	reg  byte
+	data []byte
+}
+
+// fakeI2C is an I2C device holding 256 registers, which reads and writes
+// advance through like most devices, and recording every register write.
+type fakeI2C struct {
+	regs   [256]byte
+	writes []i2cWrite
+	data   []byte
+	closed bool
+}
+
+func (f *fakeI2C) ReadReg(reg byte, data []byte) error {
+	for i := range data {
+		data[i] = f.regs[reg+byte(i)]
+	}
+	return nil
+}
+
+func (f *fakeI2C) WriteReg(reg byte, data []byte) error {
+	for i, b := range data {
+		f.regs[reg+byte(i)] = b
+	}
+	f.writes = append(f.writes, i2cWrite{reg, append([]byte{}, data...)})
+	return nil
+}
+
+func (f *fakeI2C) Read(data []byte) error {
+	copy(data, f.data)
+	return nil
+}
+
+func (f *fakeI2C) Write(data []byte) error {
+	f.data = append([]byte{}, data...)
+	return nil
+}
+
+func (f *fakeI2C) Close() error {
+	f.closed = true
+	return nil
+}
@@ -0,0 +1,111 @@
+package gpio
+
+import (
+	"sort"
+	"strings"
+)
+
+// Lookup finds the pin key refers to by its id or any of its aliases,
+// ignoring case.
+func Lookup(pinMap []PinDef, key string) (PinDef, bool) {
+	for _, pd := range pinMap {
+		if strings.EqualFold(pd.ID, key) {
+			return pd, true
+		}
+	}
+	for _, pd := range pinMap {
+		for _, alias := range pd.Aliases {
+			if strings.EqualFold(alias, key) {
+				return pd, true
+			}
+		}
+	}
+	return PinDef{}, false
+}
+
+// Resolve returns the canonical id of the pin key refers to, so "GPIO_17",
+// "17" and "P1_11" all address the same pin. key may be a pin id or alias
+// from pinMap, the id of a pin in pinStates, or the Name of one. A name
+// shared by several pins is refused rather than picking one.
+func Resolve(pinMap []PinDef, pinStates map[string]PinState, key string) (string, error) {
+	if pd, ok := Lookup(pinMap, key); ok {
+		return pd.ID, nil
+	}
+	if _, ok := pinStates[key]; ok {
+		return key, nil
+	}
+	var named []string
+	for pinId, ps := range pinStates {
+		if ps.Name == key {
+			named = append(named, pinId)
+		}
+	}
+	switch len(named) {
+	case 0:
+		return "", NewError(CodeUnknownPin, key, "Unknown pin "+key)
+	case 1:
+		return named[0], nil
+	}
+	sort.Strings(named)
+	return "", NewError(CodeInvalidArguments, key, "Name "+key+" is shared by pins "+strings.Join(named, ", "))
+}
+
+// CheckName verifies pin pinId can be named name without making another pin
+// unreachable: name must not be the id or alias of another pin, nor the name
+// of another pin in pinStates.
+func CheckName(pinMap []PinDef, pinStates map[string]PinState, pinId string, name string) error {
+	if name == "" || name == pinId {
+		return nil
+	}
+	if pd, ok := Lookup(pinMap, name); ok && pd.ID != pinId {
+		return NewError(CodeInvalidValue, pinId, "Name "+name+" is the id or an alias of pin "+pd.ID)
+	}
+	for id, ps := range pinStates {
+		if id == pinId {
+			continue
+		}
+		if strings.EqualFold(id, name) {
+			return NewError(CodeInvalidValue, pinId, "Name "+name+" is the id of pin "+id)
+		}
+		if ps.Name == name {
+			return NewError(CodeInvalidValue, pinId, "Name "+name+" is already the name of pin "+id)
+		}
+	}
+	return nil
+}
+
+// Canonical re-keys pinStates by canonical pin id, so states saved under an
+// alias don't become a second entry for the same pin. States whose key isn't
+// in pinMap are kept as they are. Two states of the same pin, or pins whose
+// names collide, are reported rather than one of them being dropped.
+func Canonical(pinMap []PinDef, pinStates map[string]PinState) (map[string]PinState, error) {
+	keys := make([]string, 0, len(pinStates))
+	for key := range pinStates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make(map[string]PinState, len(pinStates))
+	savedAs := make(map[string]string, len(pinStates))
+	for _, key := range keys {
+		ps := pinStates[key]
+		pinId := key
+		if pd, ok := Lookup(pinMap, key); ok {
+			pinId = pd.ID
+		}
+		if other, ok := savedAs[pinId]; ok {
+			return nil, NewError(CodeInvalidValue, pinId, "Pins "+other+" and "+key+" are both pin "+pinId)
+		}
+		if ps.Name == "" || ps.Name == ps.PinId {
+			ps.Name = pinId
+		}
+		ps.PinId = pinId
+		result[pinId] = ps
+		savedAs[pinId] = key
+	}
+	for pinId, ps := range result {
+		if err := CheckName(pinMap, result, pinId, ps.Name); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
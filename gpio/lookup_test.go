@@ -0,0 +1,90 @@
+package gpio
+
+import "testing"
+
+var lookupPinMap = []PinDef{
+	{ID: "P1_11", Aliases: []string{"17", "GPIO_17"}},
+	{ID: "P1_12", Aliases: []string{"18", "GPIO_18", "PWM0"}},
+	// an alias that is also another pin's id refers to that pin
+	{ID: "P1_13", Aliases: []string{"27", "GPIO_27", "P1_12"}},
+}
+
+func TestResolve(t *testing.T) {
+	pinStates := map[string]PinState{
+		"P1_11":  {PinId: "P1_11", Name: "fan"},
+		"P1_12":  {PinId: "P1_12", Name: "Lamp"},
+		"P1_13":  {PinId: "P1_13", Name: "lamp"},
+		"X1":     {PinId: "X1", Name: "heater"},
+		"X2":     {PinId: "X2", Name: "heater"},
+		"EXT_01": {PinId: "EXT_01", Name: "18"},
+	}
+	tests := []struct {
+		key  string
+		want string
+		code ErrorCode
+	}{
+		{"P1_11", "P1_11", ""},
+		{"p1_11", "P1_11", ""},
+		{"17", "P1_11", ""},
+		{"gpio_17", "P1_11", ""},
+		{"pwm0", "P1_12", ""},
+		{"P1_12", "P1_12", ""},
+		{"27", "P1_13", ""},
+		// ids and aliases come before names
+		{"18", "P1_12", ""},
+		// pins only the state knows, such as those of expanders
+		{"X1", "X1", ""},
+		{"fan", "P1_11", ""},
+		// names are matched exactly
+		{"Lamp", "P1_12", ""},
+		{"lamp", "P1_13", ""},
+		{"LAMP", "", CodeUnknownPin},
+		{"FAN", "", CodeUnknownPin},
+		{"heater", "", CodeInvalidArguments},
+		{"P9_99", "", CodeUnknownPin},
+	}
+	for _, test := range tests {
+		got, err := Resolve(lookupPinMap, pinStates, test.key)
+		var code ErrorCode
+		if err != nil {
+			code = CodeOf(err)
+		}
+		if got != test.want || code != test.code {
+			t.Errorf("%s: got %q, %v, want %q with code %q", test.key, got, err, test.want, test.code)
+		}
+	}
+}
+
+func TestCheckName(t *testing.T) {
+	pinStates := map[string]PinState{
+		"P1_11": {PinId: "P1_11", Name: "fan"},
+		"X1":    {PinId: "X1", Name: "X1"},
+	}
+	tests := []struct {
+		pinId, name string
+		ok          bool
+	}{
+		{"P1_12", "", true},
+		{"P1_12", "P1_12", true},
+		{"P1_12", "lamp", true},
+		// a pin may be named after one of its own aliases
+		{"P1_12", "pwm0", true},
+		{"P1_12", "GPIO_17", false},
+		{"P1_12", "p1_11", false},
+		{"P1_12", "fan", false},
+		{"P1_11", "fan", true},
+		// names are distinct from other names by case, but not from ids
+		{"P1_12", "Fan", true},
+		{"P1_12", "x1", false},
+		{"X1", "heater", true},
+	}
+	for _, test := range tests {
+		err := CheckName(lookupPinMap, pinStates, test.pinId, test.name)
+		if (err == nil) != test.ok {
+			t.Errorf("naming %s %q: got %v, want ok %v", test.pinId, test.name, err, test.ok)
+		}
+		if err != nil && CodeOf(err) != CodeInvalidValue {
+			t.Errorf("naming %s %q: got code %s, want %s", test.pinId, test.name, CodeOf(err), CodeInvalidValue)
+		}
+	}
+}
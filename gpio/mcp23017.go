@@ -0,0 +1,213 @@
+package gpio
+
+import "strconv"
+
+// MCP23017 registers, with IOCON.BANK clear so those of port B follow port
+// A's, and bits.
+const (
+	mcpIODir   = 0x00
+	mcpIPol    = 0x02
+	mcpGPIntEn = 0x04
+	mcpIntCon  = 0x08
+	mcpIOCon   = 0x0a
+	mcpGPPU    = 0x0c
+	mcpGPIO    = 0x12
+	mcpOLat    = 0x14
+
+	mcpMirror = 0x40
+)
+
+// MCP23017 is a 16 pin I/O expander on the I2C bus. Its pins are <prefix>_0
+// to <prefix>_15, also known by port as <prefix>_A0 to <prefix>_B7, and can
+// be in, with an optional pull-up, or out. Its INTA and INTB lines mirror
+// each other, so either can be wired to IntPin.
+type MCP23017 struct {
+	Prefix string
+	// IntPin is the board input the interrupt line is wired to, or "" to
+	// poll the inputs.
+	IntPin string
+
+	dev  I2C
+	pins map[string]uint
+
+	// registers as last written, port A in the low byte
+	iodir, gppu, gpinten, olat uint16
+}
+
+// OpenMCP23017 opens the MCP23017 at addr on I2C bus bus, 0x20-0x27.
+func OpenMCP23017(prefix string, bus byte, addr byte, intPin string) (*MCP23017, error) {
+	dev, err := OpenI2C(bus, addr)
+	if err != nil {
+		return nil, err
+	}
+	m, err := NewMCP23017(prefix, dev, intPin)
+	if err != nil {
+		dev.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// NewMCP23017 sets up the MCP23017 on dev, with every pin an input.
+func NewMCP23017(prefix string, dev I2C, intPin string) (*MCP23017, error) {
+	m := &MCP23017{
+		Prefix: prefix,
+		IntPin: intPin,
+		dev:    dev,
+		pins:   make(map[string]uint, 16),
+		iodir:  0xffff,
+	}
+	for n := uint(0); n < 16; n++ {
+		m.pins[prefix+"_"+strconv.Itoa(int(n))] = n
+	}
+
+	// inputs interrupt on any change once enabled
+	if err := dev.WriteReg(mcpIOCon, []byte{mcpMirror}); err != nil {
+		return nil, err
+	}
+	for _, reg := range []byte{mcpIPol, mcpIntCon, mcpGPPU, mcpGPIntEn} {
+		if err := m.write(reg, 0); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.write(mcpIODir, m.iodir); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *MCP23017) PinMap() []PinDef {
+	pinMap := make([]PinDef, 16)
+	for n := range pinMap {
+		port := "A"
+		if n >= 8 {
+			port = "B"
+		}
+		pinMap[n] = PinDef{
+			ID:             m.Prefix + "_" + strconv.Itoa(n),
+			Aliases:        []string{m.Prefix + "_" + port + strconv.Itoa(n%8)},
+			Capabilities:   []string{"Digital"},
+			DigitalLogical: n,
+		}
+	}
+	return pinMap
+}
+
+// PinInit makes a pin an input, returning its state, or an output, set low.
+func (m *MCP23017) PinInit(pinId string, dir Direction, pullup PullUp) (byte, error) {
+	bit, err := m.bit(pinId)
+	if err != nil {
+		return 0, err
+	}
+	switch dir {
+	case In:
+		if pullup == Pull_Down {
+			return 0, NewError(CodeUnsupported, pinId, "Pin "+pinId+" of the MCP23017 only has a pull-up")
+		}
+		m.iodir |= bit
+		m.gpinten |= bit
+		if pullup == Pull_Up {
+			m.gppu |= bit
+		} else {
+			m.gppu &^= bit
+		}
+		if err := m.writeAll(); err != nil {
+			return 0, err
+		}
+		states, err := m.ReadPins()
+		return states[pinId], err
+	case Out:
+		m.olat &^= bit
+		m.iodir &^= bit
+		m.gpinten &^= bit
+		m.gppu &^= bit
+		return 0, m.writeAll()
+	}
+	return 0, NewError(CodeUnsupported, pinId, "Pin "+pinId+" of the MCP23017 must be in or out")
+}
+
+func (m *MCP23017) PinSet(pinId string, dir Direction, val byte) error {
+	bit, err := m.bit(pinId)
+	if err != nil {
+		return err
+	}
+	if val != 0 {
+		m.olat |= bit
+	} else {
+		m.olat &^= bit
+	}
+	return m.write(mcpOLat, m.olat)
+}
+
+// PinRemove leaves a pin a floating input.
+func (m *MCP23017) PinRemove(pinId string) error {
+	bit, err := m.bit(pinId)
+	if err != nil {
+		return err
+	}
+	m.iodir |= bit
+	m.gpinten &^= bit
+	m.gppu &^= bit
+	return m.writeAll()
+}
+
+// ReadPins reads every pin, inputs and outputs.
+func (m *MCP23017) ReadPins() (map[string]byte, error) {
+	data := make([]byte, 2)
+	if err := m.dev.ReadReg(mcpGPIO, data); err != nil {
+		return nil, err
+	}
+	gpio := uint16(data[0]) | uint16(data[1])<<8
+	states := make(map[string]byte, len(m.pins))
+	for pinId, n := range m.pins {
+		states[pinId] = byte(gpio >> n & 1)
+	}
+	return states, nil
+}
+
+func (m *MCP23017) Interrupt() string {
+	return m.IntPin
+}
+
+// Close leaves every pin a floating input, and closes the device.
+func (m *MCP23017) Close() error {
+	m.iodir, m.gpinten, m.gppu = 0xffff, 0, 0
+	err := m.writeAll()
+	if cerr := m.dev.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (m *MCP23017) bit(pinId string) (uint16, error) {
+	n, ok := m.pins[pinId]
+	if !ok {
+		return 0, NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+	}
+	return 1 << n, nil
+}
+
+// writeAll writes the pins' settings, with outputs latched before they are
+// made outputs.
+func (m *MCP23017) writeAll() error {
+	regs := []struct {
+		reg byte
+		v   uint16
+	}{
+		{mcpOLat, m.olat},
+		{mcpGPPU, m.gppu},
+		{mcpIODir, m.iodir},
+		{mcpGPIntEn, m.gpinten},
+	}
+	for _, r := range regs {
+		if err := m.write(r.reg, r.v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write writes v to the port A and B registers at reg.
+func (m *MCP23017) write(reg byte, v uint16) error {
+	return m.dev.WriteReg(reg, []byte{byte(v), byte(v >> 8)})
+}
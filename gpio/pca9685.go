@@ -0,0 +1,167 @@
+package gpio
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// PCA9685 registers and bits.
+const (
+	pcaMode1    = 0x00
+	pcaMode2    = 0x01
+	pcaLED0     = 0x06
+	pcaAllLED   = 0xfa
+	pcaPrescale = 0xfe
+
+	pcaRestart = 0x80
+	pcaAutoInc = 0x20
+	pcaSleep   = 0x10
+	pcaAllCall = 0x01
+	pcaOutDrv  = 0x04
+
+	// set in the high byte of a channel's on or off time, it is fully on
+	// or off
+	pcaFull = 0x10
+
+	pcaOscillator = 25000000
+)
+
+// DefaultPCA9685Freq is the PWM frequency of a PCA9685, which suits servos.
+// LEDs flicker less at a few hundred Hz.
+const DefaultPCA9685Freq = 50
+
+// PCA9685 is a 16 channel, 12 bit PWM controller on the I2C bus. Its channels
+// are pins <prefix>_0 to <prefix>_15, which can be out, pwm or servo, all
+// running at the chip's one frequency.
+type PCA9685 struct {
+	Prefix string
+	// Freq is the PWM frequency in Hz, as near as the chip's prescaler gets
+	// to the one asked for.
+	Freq float64
+
+	dev      I2C
+	channels map[string]int
+}
+
+// OpenPCA9685 opens the PCA9685 at addr on I2C bus bus, usually 0x40 on bus
+// 1, running at freq Hz.
+func OpenPCA9685(prefix string, bus byte, addr byte, freq int) (*PCA9685, error) {
+	dev, err := OpenI2C(bus, addr)
+	if err != nil {
+		return nil, err
+	}
+	p, err := NewPCA9685(prefix, dev, freq)
+	if err != nil {
+		dev.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewPCA9685 sets up the PCA9685 on dev, turning every channel off, and
+// running at freq Hz, 24-1526.
+func NewPCA9685(prefix string, dev I2C, freq int) (*PCA9685, error) {
+	if freq < 24 || freq > 1526 {
+		return nil, NewError(CodeInvalidValue, "", "Invalid PCA9685 frequency, must be 24-1526Hz : "+strconv.Itoa(freq))
+	}
+	prescale := int(math.Floor(float64(pcaOscillator)/(4096*float64(freq))+0.5)) - 1
+	p := &PCA9685{
+		Prefix:   prefix,
+		Freq:     float64(pcaOscillator) / (4096 * float64(prescale+1)),
+		dev:      dev,
+		channels: make(map[string]int, 16),
+	}
+	for n := 0; n < 16; n++ {
+		p.channels[prefix+"_"+strconv.Itoa(n)] = n
+	}
+
+	// the prescaler can only be set while the oscillator sleeps
+	steps := []struct {
+		reg  byte
+		data []byte
+	}{
+		{pcaAllLED, []byte{0, 0, 0, pcaFull}},
+		{pcaMode2, []byte{pcaOutDrv}},
+		{pcaMode1, []byte{pcaSleep | pcaAutoInc | pcaAllCall}},
+		{pcaPrescale, []byte{byte(prescale)}},
+		{pcaMode1, []byte{pcaAutoInc | pcaAllCall}},
+	}
+	for _, step := range steps {
+		if err := dev.WriteReg(step.reg, step.data); err != nil {
+			return nil, err
+		}
+	}
+	// the oscillator takes 500us to start
+	time.Sleep(time.Millisecond)
+	if err := dev.WriteReg(pcaMode1, []byte{pcaRestart | pcaAutoInc | pcaAllCall}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *PCA9685) PinMap() []PinDef {
+	pinMap := make([]PinDef, 16)
+	for n := range pinMap {
+		pinMap[n] = PinDef{
+			ID:             p.Prefix + "_" + strconv.Itoa(n),
+			Aliases:        []string{},
+			Capabilities:   []string{"Digital", "PWM"},
+			DigitalLogical: n,
+		}
+	}
+	return pinMap
+}
+
+// PinInit turns a channel off.
+func (p *PCA9685) PinInit(pinId string, dir Direction, pullup PullUp) (byte, error) {
+	if dir != Out && dir != PWM && dir != Servo {
+		return 0, NewError(CodeUnsupported, pinId, "Pin "+pinId+" of the PCA9685 must be out, pwm or servo")
+	}
+	return 0, p.write(pinId, 0, pcaFull<<8)
+}
+
+// PinSet sets the duty cycle of a channel. Digital outputs are fully on or
+// off, PWM pins on for val/255 of the time, and servos get a pulse for the
+// angle val.
+func (p *PCA9685) PinSet(pinId string, dir Direction, val byte) error {
+	switch {
+	case val == 0 && dir != Servo:
+		return p.write(pinId, 0, pcaFull<<8)
+	case dir == Out, dir == PWM && val == 255:
+		return p.write(pinId, pcaFull<<8, 0)
+	case dir == PWM:
+		return p.write(pinId, 0, int(val)*4096/255)
+	}
+	// at high frequencies the pulse may not fit in the period
+	period := 1000000 / p.Freq
+	off := int(float64(servoPulse(val)) * 4096 / period)
+	if off > 4095 {
+		off = 4095
+	}
+	return p.write(pinId, 0, off)
+}
+
+// PinRemove turns a channel off.
+func (p *PCA9685) PinRemove(pinId string) error {
+	return p.write(pinId, 0, pcaFull<<8)
+}
+
+// Close turns every channel off, and closes the device.
+func (p *PCA9685) Close() error {
+	err := p.dev.WriteReg(pcaAllLED, []byte{0, 0, 0, pcaFull})
+	if cerr := p.dev.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// write sets the counts at which a channel turns on and off in each period
+// of 4096, or pcaFull<<8 for fully on or off.
+func (p *PCA9685) write(pinId string, on int, off int) error {
+	n, ok := p.channels[pinId]
+	if !ok {
+		return NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+	}
+	return p.dev.WriteReg(byte(pcaLED0+4*n), []byte{byte(on), byte(on >> 8), byte(off), byte(off >> 8)})
+}
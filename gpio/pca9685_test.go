@@ -0,0 +1,130 @@
+package gpio
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+// checkWrites compares the register writes of dev with want, and forgets
+// them.
+func checkWrites(t *testing.T, what string, dev *fakeI2C, want []i2cWrite) {
+	t.Helper()
+	if len(dev.writes) != len(want) {
+		t.Errorf("%s: wrote %v, want %v", what, dev.writes, want)
+	} else {
+		for i, w := range want {
+			if dev.writes[i].reg != w.reg || !bytes.Equal(dev.writes[i].data, w.data) {
+				t.Errorf("%s: write %d was %02x % x, want %02x % x", what, i, dev.writes[i].reg, dev.writes[i].data, w.reg, w.data)
+			}
+		}
+	}
+	dev.writes = nil
+}
+
+func TestNewPCA9685(t *testing.T) {
+	tests := []struct {
+		freq     int
+		prescale byte
+	}{
+		{50, 121},
+		{200, 30},
+		{24, 253},
+		{1526, 3},
+	}
+	for _, test := range tests {
+		dev := &fakeI2C{}
+		p, err := NewPCA9685("PCA0", dev, test.freq)
+		if err != nil {
+			t.Errorf("%dHz: %v", test.freq, err)
+			continue
+		}
+		// every channel off, then the prescaler set while asleep, and a
+		// restart once the oscillator runs
+		checkWrites(t, "setup", dev, []i2cWrite{
+			{pcaAllLED, []byte{0, 0, 0, 0x10}},
+			{pcaMode2, []byte{0x04}},
+			{pcaMode1, []byte{0x31}},
+			{pcaPrescale, []byte{test.prescale}},
+			{pcaMode1, []byte{0x21}},
+			{pcaMode1, []byte{0xa1}},
+		})
+		if math.Abs(p.Freq-float64(test.freq)) > float64(test.freq)*0.05 {
+			t.Errorf("%dHz: runs at %vHz", test.freq, p.Freq)
+		}
+	}
+	for _, freq := range []int{0, 23, 1527} {
+		if _, err := NewPCA9685("PCA0", &fakeI2C{}, freq); CodeOf(err) != CodeInvalidValue {
+			t.Errorf("%dHz: got %v, want an InvalidValue error", freq, err)
+		}
+	}
+}
+
+func TestPCA9685PinSet(t *testing.T) {
+	dev := &fakeI2C{}
+	p, err := NewPCA9685("PCA0", dev, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev.writes = nil
+
+	tests := []struct {
+		pinId string
+		dir   Direction
+		val   byte
+		reg   byte
+		data  []byte
+	}{
+		// on and off counts, low byte first, with bit 4 of the high byte
+		// fully on or off
+		{"PCA0_0", Out, 1, 0x06, []byte{0, 0x10, 0, 0}},
+		{"PCA0_0", Out, 0, 0x06, []byte{0, 0, 0, 0x10}},
+		{"PCA0_3", PWM, 128, 0x12, []byte{0, 0, 0x08, 0x08}},
+		{"PCA0_3", PWM, 255, 0x12, []byte{0, 0x10, 0, 0}},
+		{"PCA0_3", PWM, 0, 0x12, []byte{0, 0, 0, 0x10}},
+		// 544us, 1472us and 2400us of a 20ms period
+		{"PCA0_15", Servo, 0, 0x42, []byte{0, 0, 0x6f, 0}},
+		{"PCA0_15", Servo, 90, 0x42, []byte{0, 0, 0x2d, 0x01}},
+		{"PCA0_15", Servo, 180, 0x42, []byte{0, 0, 0xeb, 0x01}},
+	}
+	for _, test := range tests {
+		if err := p.PinSet(test.pinId, test.dir, test.val); err != nil {
+			t.Errorf("%s %d: %v", test.pinId, test.val, err)
+			continue
+		}
+		checkWrites(t, test.pinId, dev, []i2cWrite{{test.reg, test.data}})
+	}
+
+	if err := p.PinSet("PCA0_16", Out, 1); CodeOf(err) != CodeUnknownPin {
+		t.Errorf("PCA0_16: got %v, want an UnknownPin error", err)
+	}
+	if _, err := p.PinInit("PCA0_1", In, Pull_None); CodeOf(err) != CodeUnsupported {
+		t.Errorf("input: got %v, want an Unsupported error", err)
+	}
+	if _, err := p.PinInit("PCA0_1", PWM, Pull_None); err != nil {
+		t.Errorf("init: %v", err)
+	}
+	checkWrites(t, "init", dev, []i2cWrite{{0x0a, []byte{0, 0, 0, 0x10}}})
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkWrites(t, "close", dev, []i2cWrite{{pcaAllLED, []byte{0, 0, 0, 0x10}}})
+	if !dev.closed {
+		t.Error("device left open")
+	}
+}
+
+func TestPCA9685ServoAtHighFrequency(t *testing.T) {
+	dev := &fakeI2C{}
+	p, err := NewPCA9685("PCA0", dev, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev.writes = nil
+	// a 2.4ms pulse doesn't fit a 1ms period, so is cut to the whole period
+	if err := p.PinSet("PCA0_0", Servo, 180); err != nil {
+		t.Fatal(err)
+	}
+	checkWrites(t, "servo", dev, []i2cWrite{{0x06, []byte{0, 0, 0xff, 0x0f}}})
+}
@@ -0,0 +1,148 @@
+package gpio
+
+import "strconv"
+
+// PCF8574 is an 8 pin I/O expander on the I2C bus. Its pins are <prefix>_0 to
+// <prefix>_7, and can be in or out. Its pins are quasi-bidirectional: inputs
+// are weakly pulled up, and outputs only sink current when low, as relay
+// boards expect.
+type PCF8574 struct {
+	Prefix string
+	// IntPin is the board input the interrupt line is wired to, or "" to
+	// poll the inputs.
+	IntPin string
+
+	dev  I2C
+	pins map[string]uint
+
+	// the pins as last written, high for inputs
+	latch byte
+}
+
+// OpenPCF8574 opens the PCF8574 at addr on I2C bus bus, 0x20-0x27, or
+// 0x38-0x3f for a PCF8574A.
+func OpenPCF8574(prefix string, bus byte, addr byte, intPin string) (*PCF8574, error) {
+	dev, err := OpenI2C(bus, addr)
+	if err != nil {
+		return nil, err
+	}
+	p, err := NewPCF8574(prefix, dev, intPin)
+	if err != nil {
+		dev.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewPCF8574 sets up the PCF8574 on dev, with every pin an input.
+func NewPCF8574(prefix string, dev I2C, intPin string) (*PCF8574, error) {
+	p := &PCF8574{
+		Prefix: prefix,
+		IntPin: intPin,
+		dev:    dev,
+		pins:   make(map[string]uint, 8),
+		latch:  0xff,
+	}
+	for n := uint(0); n < 8; n++ {
+		p.pins[prefix+"_"+strconv.Itoa(int(n))] = n
+	}
+	if err := dev.Write([]byte{p.latch}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *PCF8574) PinMap() []PinDef {
+	pinMap := make([]PinDef, 8)
+	for n := range pinMap {
+		pinMap[n] = PinDef{
+			ID:             p.Prefix + "_" + strconv.Itoa(n),
+			Aliases:        []string{},
+			Capabilities:   []string{"Digital"},
+			DigitalLogical: n,
+		}
+	}
+	return pinMap
+}
+
+// PinInit makes a pin an input, returning its state, or an output, set low.
+func (p *PCF8574) PinInit(pinId string, dir Direction, pullup PullUp) (byte, error) {
+	bit, err := p.bit(pinId)
+	if err != nil {
+		return 0, err
+	}
+	switch dir {
+	case In:
+		if pullup == Pull_Down {
+			return 0, NewError(CodeUnsupported, pinId, "Pin "+pinId+" of the PCF8574 is always pulled up")
+		}
+		p.latch |= bit
+		if err := p.dev.Write([]byte{p.latch}); err != nil {
+			return 0, err
+		}
+		states, err := p.ReadPins()
+		return states[pinId], err
+	case Out:
+		p.latch &^= bit
+		return 0, p.dev.Write([]byte{p.latch})
+	}
+	return 0, NewError(CodeUnsupported, pinId, "Pin "+pinId+" of the PCF8574 must be in or out")
+}
+
+func (p *PCF8574) PinSet(pinId string, dir Direction, val byte) error {
+	bit, err := p.bit(pinId)
+	if err != nil {
+		return err
+	}
+	if val != 0 {
+		p.latch |= bit
+	} else {
+		p.latch &^= bit
+	}
+	return p.dev.Write([]byte{p.latch})
+}
+
+// PinRemove leaves a pin a pulled up input.
+func (p *PCF8574) PinRemove(pinId string) error {
+	bit, err := p.bit(pinId)
+	if err != nil {
+		return err
+	}
+	p.latch |= bit
+	return p.dev.Write([]byte{p.latch})
+}
+
+// ReadPins reads every pin, inputs and outputs.
+func (p *PCF8574) ReadPins() (map[string]byte, error) {
+	data := make([]byte, 1)
+	if err := p.dev.Read(data); err != nil {
+		return nil, err
+	}
+	states := make(map[string]byte, len(p.pins))
+	for pinId, n := range p.pins {
+		states[pinId] = data[0] >> n & 1
+	}
+	return states, nil
+}
+
+func (p *PCF8574) Interrupt() string {
+	return p.IntPin
+}
+
+// Close leaves every pin a pulled up input, and closes the device.
+func (p *PCF8574) Close() error {
+	p.latch = 0xff
+	err := p.dev.Write([]byte{p.latch})
+	if cerr := p.dev.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (p *PCF8574) bit(pinId string) (byte, error) {
+	n, ok := p.pins[pinId]
+	if !ok {
+		return 0, NewError(CodeUnknownPin, pinId, "Unknown pin "+pinId)
+	}
+	return 1 << n, nil
+}
@@ -1,16 +1,17 @@
+//go:build linux && arm
 // +build linux,arm
 
-package main
+package gpio
 
 import (
-	"os"
-	"strconv"
 	"errors"
 	"log"
+	"os"
+	"strconv"
 )
 
 type BlasterPin struct {
-	id int
+	id    int
 	value float64
 }
 
@@ -25,8 +26,8 @@ func CloseBlaster() error {
 	return nil
 }
 func NewBlasterPin(pinId int) BlasterPin {
-	log.Println("Creating pi blaster pin on ", string(pinId))
-	return BlasterPin {
+	log.Println("Creating pi blaster pin on ", strconv.Itoa(pinId))
+	return BlasterPin{
 		pinId,
 		0.0,
 	}
@@ -45,19 +46,29 @@ func (b *BlasterPin) Close() error {
 	return nil
 }
 func (b *BlasterPin) Write(value byte) error {
+	return b.write(float64(value)/255.0, 2)
+}
+
+// WritePulse sets the pin to pulse for us microseconds every period of
+// pi-blaster's, 10ms by default, as servos expect.
+func (b *BlasterPin) WritePulse(us int) error {
+	return b.write(float64(us)/10000.0, 4)
+}
+
+// write sets the pin's duty cycle to v, 0-1, written with prec decimals.
+func (b *BlasterPin) write(v float64, prec int) error {
 	f, err := os.Create("/dev/pi-blaster")
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	v := (float64(value)/255.0)
 	if v > 1.0 {
 		v = 1.0
 	} else if v < 0.0 {
 		v = 0.0
 	}
-	toVal := strconv.FormatFloat(v, 'f', 2, 64)
+	toVal := strconv.FormatFloat(v, 'f', prec, 64)
 	msg := strconv.Itoa(b.id) + "=" + string(toVal)
 	_, err = f.WriteString(msg + "\n")
 	if err != nil {
@@ -67,4 +78,4 @@ func (b *BlasterPin) Write(value byte) error {
 	b.value = v
 	f.Sync()
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,128 @@
+// Package gpio contains the pin model shared by the server and its clients,
+// and the GPIO backends that drive real (or mock) hardware.
+package gpio
+
+import "time"
+
+type Direction int
+type PullUp int
+
+type PinState struct {
+	Pin    interface{} `json:"-"`
+	PinId  string
+	Dir    Direction
+	State  byte
+	Pullup PullUp
+	Name   string
+
+	// Raw is the reading of an analog pin as the board reports it, whose
+	// State is scaled to 0-255, and Analog how it is sampled.
+	Raw    int           `json:",omitempty"`
+	Analog *AnalogConfig `json:",omitempty"`
+
+	// Count is the number of pulses a counter or encoder pin has seen, Freq
+	// their rate in Hz and RPM the revolutions per minute they make, as last
+	// reported, and Counter how it counts. Encoders count backwards too.
+	Count   int64          `json:",omitempty"`
+	Freq    float64        `json:",omitempty"`
+	RPM     float64        `json:",omitempty"`
+	Counter *CounterConfig `json:",omitempty"`
+}
+
+// AnalogConfig sets how an analog pin is sampled. It is read every Interval,
+// and the average of its last Samples readings is reported whenever it
+// differs from the value last reported by at least Threshold, in raw units.
+// Zero values take the defaults.
+type AnalogConfig struct {
+	Interval  string `json:",omitempty"`
+	Samples   int    `json:",omitempty"`
+	Threshold int    `json:",omitempty"`
+}
+
+// Analog sampling defaults.
+const (
+	DefaultAnalogInterval  = 250 * time.Millisecond
+	DefaultAnalogSamples   = 4
+	DefaultAnalogThreshold = 5
+)
+
+// params checks c and returns its settings, with defaults filled in.
+func (c AnalogConfig) params(pinId string) (interval time.Duration, samples int, threshold int, err error) {
+	interval, samples, threshold = DefaultAnalogInterval, DefaultAnalogSamples, DefaultAnalogThreshold
+	if c.Interval != "" {
+		if interval, err = time.ParseDuration(c.Interval); err != nil || interval < time.Millisecond {
+			return 0, 0, 0, NewError(CodeInvalidValue, pinId, "Invalid sampling interval, must be a duration of at least 1ms : "+c.Interval)
+		}
+	}
+	if c.Samples < 0 || c.Threshold < 0 {
+		return 0, 0, 0, NewError(CodeInvalidValue, pinId, "Samples and threshold can't be negative")
+	}
+	if c.Samples > 0 {
+		samples = c.Samples
+	}
+	if c.Threshold > 0 {
+		threshold = c.Threshold
+	}
+	return interval, samples, threshold, nil
+}
+
+// Servo pins are set to an angle of 0-180 degrees, sent as a pulse of
+// ServoMinPulse to ServoMaxPulse microseconds each period.
+const (
+	ServoMinPulse = 544
+	ServoMaxPulse = 2400
+)
+
+// servoPulse returns the pulse width in microseconds for angle.
+func servoPulse(angle byte) int {
+	return ServoMinPulse + int(angle)*(ServoMaxPulse-ServoMinPulse)/180
+}
+
+type PinDef struct {
+	ID             string
+	Aliases        []string
+	Capabilities   []string
+	DigitalLogical int
+	AnalogLogical  int
+}
+
+const (
+	In     Direction = 0
+	Out    Direction = 1
+	PWM    Direction = 2
+	Analog Direction = 3
+	Servo  Direction = 4
+
+	// Counter pins count rising edges, and Encoder pins decode quadrature
+	// from themselves and a B pin.
+	Counter Direction = 5
+	Encoder Direction = 6
+
+	Pull_None PullUp = 0
+	Pull_Up   PullUp = 1
+	Pull_Down PullUp = 2
+)
+
+// GPIOInterface is implemented by every GPIO backend. Init is handed the
+// channels the backend reports pin changes on, and the pin states to restore.
+// Changes to input, analog and counter pins may be reported from any
+// goroutine as they happen. PinSetSampling changes how an analog pin is
+// sampled, PinSetCounter how a counter or encoder counts, and
+// PinResetCounter sets its count back to zero. PinPulse pulses an output
+// high then low again as briefly as the board allows, without reporting it,
+// for pulse trains too fast to report such as a stepper's steps; unlike the
+// other methods it may be called from any goroutine.
+type GPIOInterface interface {
+	Init(chan PinState, chan PinState, chan string, map[string]PinState) error
+	Close() error
+	PinMap() ([]PinDef, error)
+	Host() (string, error)
+	PinStates() (map[string]PinState, error)
+	PinInit(string, Direction, PullUp, string) error
+	PinSet(string, byte) error
+	PinSetSampling(string, AnalogConfig) error
+	PinSetCounter(string, CounterConfig) error
+	PinResetCounter(string) error
+	PinPulse(string) error
+	PinRemove(string) error
+}
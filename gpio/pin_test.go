@@ -0,0 +1,44 @@
+package gpio
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnalogParams(t *testing.T) {
+	tests := []struct {
+		config    AnalogConfig
+		interval  time.Duration
+		samples   int
+		threshold int
+		ok        bool
+	}{
+		{AnalogConfig{}, DefaultAnalogInterval, DefaultAnalogSamples, DefaultAnalogThreshold, true},
+		{AnalogConfig{Interval: "250ms"}, 250 * time.Millisecond, DefaultAnalogSamples, DefaultAnalogThreshold, true},
+		{AnalogConfig{Interval: "1ms", Samples: 1, Threshold: 1}, time.Millisecond, 1, 1, true},
+		{AnalogConfig{Samples: 16, Threshold: 40}, DefaultAnalogInterval, 16, 40, true},
+		{AnalogConfig{Interval: "999us"}, 0, 0, 0, false},
+		{AnalogConfig{Interval: "0s"}, 0, 0, 0, false},
+		{AnalogConfig{Interval: "-1s"}, 0, 0, 0, false},
+		{AnalogConfig{Interval: "fast"}, 0, 0, 0, false},
+		{AnalogConfig{Interval: "100"}, 0, 0, 0, false},
+		{AnalogConfig{Samples: -1}, 0, 0, 0, false},
+		{AnalogConfig{Threshold: -1}, 0, 0, 0, false},
+	}
+	for _, test := range tests {
+		interval, samples, threshold, err := test.config.params("P8_07")
+		if (err == nil) != test.ok {
+			t.Errorf("%+v: got %v, want ok %v", test.config, err, test.ok)
+			continue
+		}
+		if err != nil {
+			if CodeOf(err) != CodeInvalidValue {
+				t.Errorf("%+v: got code %s, want %s", test.config, CodeOf(err), CodeInvalidValue)
+			}
+			continue
+		}
+		if interval != test.interval || samples != test.samples || threshold != test.threshold {
+			t.Errorf("%+v: got %v, %d and %d, want %v, %d and %d", test.config, interval, samples, threshold, test.interval, test.samples, test.threshold)
+		}
+	}
+}
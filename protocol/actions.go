@@ -0,0 +1,87 @@
+package protocol
+
+import (
+	"strconv"
+	"time"
+)
+
+// Action types.
+const (
+	// ActionSetPin sets Pin to Value.
+	ActionSetPin = "setpin"
+	// ActionPulse sets Pin to Value for Duration, then restores its state.
+	ActionPulse = "pulse"
+	// ActionScene applies Scene.
+	ActionScene = "scene"
+	// ActionFade ramps Pin from its state to Value over Duration.
+	ActionFade = "fade"
+)
+
+// Action is something done to pins by a scheduled job or a rule.
+type Action struct {
+	Type     string
+	Pin      string `json:",omitempty"`
+	Value    byte
+	Duration string `json:",omitempty"`
+	Scene    string `json:",omitempty"`
+}
+
+// String formats the action as it is given to commands, e.g.
+// "pulse P1_11 5s 1".
+func (a Action) String() string {
+	switch a.Type {
+	case ActionSetPin:
+		return a.Type + " " + a.Pin + " " + strconv.Itoa(int(a.Value))
+	case ActionPulse, ActionFade:
+		return a.Type + " " + a.Pin + " " + a.Duration + " " + strconv.Itoa(int(a.Value))
+	case ActionScene:
+		return a.Type + " " + a.Scene
+	}
+	return a.Type
+}
+
+// Job is an action run on a schedule. Schedule is a cron expression with
+// five fields (minute, hour, day of month, month, day of week), one of
+// @hourly, @daily, @weekly, @monthly or @yearly, or "@every <duration>".
+// Next is when the job runs next, and is only sent to clients.
+type Job struct {
+	Schedule string
+	Action   Action
+	Next     *time.Time `json:",omitempty"`
+}
+
+// JobFired is sent every time a job runs. Error is set if its action failed.
+type JobFired struct {
+	Job    string
+	Action Action
+	Time   time.Time
+	Error  *Error `json:",omitempty"`
+}
+
+// Condition is a test on the state of Pin. When is high or low, or a
+// comparison with a value such as ">100" or "!=0". In the trigger of a rule
+// it may also be rising, falling or change.
+type Condition struct {
+	Pin  string
+	When string
+}
+
+// Rule runs an action when its trigger pin changes to meet its condition,
+// provided every condition in If holds. With a Delay the action runs that
+// long afterwards, and only if the trigger condition still holds then.
+type Rule struct {
+	Condition
+	If       []Condition `json:",omitempty"`
+	Delay    string      `json:",omitempty"`
+	Action   Action
+	Disabled bool `json:",omitempty"`
+}
+
+// RuleFired is sent every time a rule runs its action. Error is set if the
+// action failed.
+type RuleFired struct {
+	Rule   string
+	Action Action
+	Time   time.Time
+	Error  *Error `json:",omitempty"`
+}
@@ -0,0 +1,62 @@
+package protocol
+
+import (
+	"encoding/json"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/sensor"
+)
+
+// Message is a decoded server message. Type names the message, and only the
+// field of the same name carries a value.
+type Message struct {
+	Type string
+
+	// Seq numbers pin events, see Snapshot.
+	Seq uint64 `json:",omitempty"`
+
+	Version    string                   `json:",omitempty"`
+	Commands   []string                 `json:",omitempty"`
+	Host       string                   `json:",omitempty"`
+	PinMap     []gpio.PinDef            `json:",omitempty"`
+	PinStates  map[string]gpio.PinState `json:",omitempty"`
+	PinState   *gpio.PinState           `json:",omitempty"`
+	Pin        *gpio.PinState           `json:",omitempty"`
+	PinAdded   *gpio.PinState           `json:",omitempty"`
+	PinRemoved string                   `json:",omitempty"`
+
+	PinsChanged  *PinsChanged        `json:",omitempty"`
+	Groups       map[string][]string `json:",omitempty"`
+	SceneApplied *PinsChanged        `json:",omitempty"`
+	Scenes       map[string]Scene    `json:",omitempty"`
+	Jobs         map[string]Job      `json:",omitempty"`
+	JobFired     *JobFired           `json:",omitempty"`
+	Rules        map[string]Rule     `json:",omitempty"`
+	RuleFired    *RuleFired          `json:",omitempty"`
+
+	SensorReading *sensor.Reading           `json:",omitempty"`
+	Sensors       map[string]sensor.Reading `json:",omitempty"`
+	Sensor        *sensor.Reading           `json:",omitempty"`
+	SensorConfigs map[string]sensor.Config  `json:",omitempty"`
+
+	Steppers map[string]Stepper `json:",omitempty"`
+	Stepper  *StepperState      `json:",omitempty"`
+
+	Schema        []CommandSchema `json:",omitempty"`
+	Subscriptions *Subscriptions  `json:",omitempty"`
+	Snapshot      *Snapshot       `json:",omitempty"`
+
+	Error *Error `json:",omitempty"`
+}
+
+// Decode parses a single message sent by the server.
+func Decode(data []byte) (*Message, error) {
+	msg := new(Message)
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	if msg.Type == "" && msg.Error != nil {
+		msg.Type = TypeError
+	}
+	return msg, nil
+}
@@ -0,0 +1,189 @@
+// Package protocol describes the messages exchanged over the websocket.
+//
+// Clients send plain text commands such as "setpin P1_11 1". The server
+// replies with JSON objects carrying a Type field, and a field of the same
+// name holding the payload, e.g. {"Type": "PinState", "PinState": {...}}.
+package protocol
+
+import (
+	"encoding/json"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/sensor"
+)
+
+// Message types sent by the server.
+const (
+	TypeVersion    = "Version"
+	TypeCommands   = "Commands"
+	TypeHost       = "Host"
+	TypePinMap     = "PinMap"
+	TypePinStates  = "PinStates"
+	TypePinState   = "PinState"
+	TypePinAdded   = "PinAdded"
+	TypePinRemoved = "PinRemoved"
+	TypeError      = "Error"
+	TypePin        = "Pin"
+
+	TypeSubscriptions = "Subscriptions"
+	TypeSnapshot      = "Snapshot"
+	TypeGroups        = "Groups"
+	TypePinsChanged   = "PinsChanged"
+	TypeScenes        = "Scenes"
+	TypeSceneApplied  = "SceneApplied"
+	TypeJobs          = "Jobs"
+	TypeJobFired      = "JobFired"
+	TypeRules         = "Rules"
+	TypeRuleFired     = "RuleFired"
+	TypeSensorReading = "SensorReading"
+	TypeSensors       = "Sensors"
+	TypeSensor        = "Sensor"
+	TypeSensorConfigs = "SensorConfigs"
+	TypeSteppers      = "Steppers"
+	TypeStepper       = "Stepper"
+)
+
+// Commands understood by the server.
+const (
+	CmdGetHost      = "gethost"
+	CmdGetPinMap    = "getpinmap"
+	CmdGetPinStates = "getpinstates"
+	CmdGetPin       = "getpin"
+	CmdInitPin      = "initpin"
+	CmdSetPin       = "setpin"
+	CmdRemovePin    = "removepin"
+	CmdSetSampling  = "setsampling"
+	CmdSetCounter   = "setcounter"
+	CmdResetCounter = "resetcounter"
+	CmdSubscribe    = "subscribe"
+	CmdUnsubscribe  = "unsubscribe"
+	CmdDefGroup     = "defgroup"
+	CmdDelGroup     = "delgroup"
+	CmdGetGroups    = "getgroups"
+	CmdSetGroup     = "setgroup"
+	CmdSetPins      = "setpins"
+	CmdSaveScene    = "savescene"
+	CmdApplyScene   = "applyscene"
+	CmdDelScene     = "delscene"
+	CmdGetScenes    = "getscenes"
+	CmdAddJob       = "addjob"
+	CmdDelJob       = "deljob"
+	CmdGetJobs      = "getjobs"
+	CmdAddRule      = "addrule"
+	CmdDelRule      = "delrule"
+	CmdGetRules     = "getrules"
+	CmdEnableRule   = "enablerule"
+	CmdDisableRule  = "disablerule"
+	CmdGetSensors   = "getsensors"
+	CmdGetSensor    = "getsensor"
+	CmdAddSensor    = "addsensor"
+	CmdDelSensor    = "delsensor"
+	CmdTare         = "tare"
+	CmdCalibrate    = "calibrate"
+	CmdAddStepper   = "addstepper"
+	CmdDelStepper   = "delstepper"
+	CmdGetSteppers  = "getsteppers"
+	CmdMove         = "move"
+	CmdMoveTo       = "moveto"
+	CmdStop         = "stop"
+	CmdHome         = "home"
+
+	CmdGetSensorConfigs = "getsensorconfigs"
+)
+
+// Subscriptions is sent to a client in reply to subscribe and unsubscribe,
+// listing the filters now applied to its pin events. When all are empty the
+// client receives every event.
+type Subscriptions struct {
+	Pins  []string
+	Names []string
+	Types []string
+}
+
+// Snapshot is sent to every client as soon as it connects, after Version and
+// Commands. Seq is the sequence number of the last pin event reflected in
+// PinStates; every pin event the client receives afterwards has a larger Seq.
+// Sensors holds the last reading of every sensor, keyed by id, and Steppers
+// every stepper with its state.
+type Snapshot struct {
+	Host      string
+	PinMap    []gpio.PinDef
+	PinStates map[string]gpio.PinState
+	Sensors   map[string]sensor.Reading `json:",omitempty"`
+	Groups    map[string][]string       `json:",omitempty"`
+	Scenes    map[string]Scene          `json:",omitempty"`
+	Steppers  map[string]Stepper        `json:",omitempty"`
+	Seq       uint64
+}
+
+// Scene is a named set of pin values, keyed by pin id, applied together by
+// applyscene.
+type Scene map[string]byte
+
+// PinsChanged is sent instead of individual PinState events when several pins
+// are written as one operation by setgroup or setpins, and is also the
+// payload of SceneApplied. PinStates holds the new state of every pin
+// written, keyed by pin id, and Group or Scene the group written or scene
+// applied, if any. If the operation failed and was rolled back, the Error is
+// sent first and PinStates holds the restored states.
+type PinsChanged struct {
+	Group     string `json:",omitempty"`
+	Scene     string `json:",omitempty"`
+	PinStates map[string]gpio.PinState
+}
+
+// Encode wraps payload in a message of the given type.
+func Encode(name string, payload interface{}) ([]byte, error) {
+	return EncodeSeq(name, payload, 0)
+}
+
+// EncodeSeq wraps payload in a message of the given type, numbered seq. Pin
+// events are numbered from 1, other messages have no Seq.
+func EncodeSeq(name string, payload interface{}, seq uint64) ([]byte, error) {
+	msgMap := make(map[string]interface{})
+	msgMap[name] = payload
+	msgMap["Type"] = name
+	if seq > 0 {
+		msgMap["Seq"] = seq
+	}
+	return json.Marshal(msgMap)
+}
+
+// EncodeCommands builds the Commands message, listing the command names under
+// Commands and their full schemas under Schema.
+func EncodeCommands(schema []CommandSchema) ([]byte, error) {
+	names := make([]string, len(schema))
+	for i := range schema {
+		names[i] = schema[i].Name
+	}
+	return json.Marshal(map[string]interface{}{
+		"Type":     TypeCommands,
+		"Commands": names,
+		"Schema":   schema,
+	})
+}
+
+// Error is the payload of an Error message. Command is the command that
+// failed, and PinId the pin it failed on, when known.
+type Error struct {
+	Code    gpio.ErrorCode
+	Message string
+	Command string `json:",omitempty"`
+	PinId   string `json:",omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// UnmarshalJSON also accepts the bare message string older servers sent as
+// {"error": "..."}.
+func (e *Error) UnmarshalJSON(data []byte) error {
+	var msg string
+	if err := json.Unmarshal(data, &msg); err == nil {
+		*e = Error{Message: msg}
+		return nil
+	}
+	type plain Error
+	return json.Unmarshal(data, (*plain)(e))
+}
@@ -0,0 +1,58 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+func TestDecodeError(t *testing.T) {
+	tests := []struct {
+		data string
+		want Error
+	}{
+		// as older servers sent them
+		{`{"error": "Unknown command frob"}`, Error{Message: "Unknown command frob"}},
+		{`{"Error": "Pin P9_99 not found"}`, Error{Message: "Pin P9_99 not found"}},
+		{`{"Type": "Error", "Error": "bad"}`, Error{Message: "bad"}},
+		{
+			`{"Type": "Error", "Error": {"Code": "UnknownPin", "Message": "Unknown pin P9_99", "Command": "setpin", "PinId": "P9_99"}}`,
+			Error{Code: gpio.CodeUnknownPin, Message: "Unknown pin P9_99", Command: "setpin", PinId: "P9_99"},
+		},
+		{`{"Error": {"Code": "InvalidValue", "Message": "Invalid value"}}`, Error{Code: gpio.CodeInvalidValue, Message: "Invalid value"}},
+	}
+	for _, test := range tests {
+		msg, err := Decode([]byte(test.data))
+		if err != nil {
+			t.Errorf("%s: %v", test.data, err)
+			continue
+		}
+		if msg.Type != TypeError || msg.Error == nil || *msg.Error != test.want {
+			t.Errorf("%s: got %s %+v, want Error %+v", test.data, msg.Type, msg.Error, test.want)
+		}
+	}
+
+	for _, data := range []string{`{"Error": 42}`, `{"Error": ["bad"]}`} {
+		if _, err := Decode([]byte(data)); err == nil {
+			t.Errorf("%s: decoded an error that is neither a string nor an object", data)
+		}
+	}
+}
+
+func TestEncodeError(t *testing.T) {
+	want := Error{Code: gpio.CodeUnsupported, Message: "Pin P8_07 is not a PWM pin", Command: "setpin", PinId: "P8_07"}
+	data, err := Encode(TypeError, want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != TypeError || msg.Error == nil || *msg.Error != want {
+		t.Errorf("got %s %+v, want Error %+v", msg.Type, msg.Error, want)
+	}
+	if msg.Error.Error() != want.Message {
+		t.Errorf("got %q, want the message", msg.Error.Error())
+	}
+}
@@ -0,0 +1,61 @@
+package protocol
+
+// Argument types used in command schemas.
+const (
+	// ArgPin is a pin id.
+	ArgPin = "pin"
+	// ArgString is free text without spaces.
+	ArgString = "string"
+	// ArgInt is a whole number, bounded by Min and Max when given.
+	ArgInt = "int"
+	// ArgEnum is one of the values listed in Enum.
+	ArgEnum = "enum"
+	// ArgValue is a pin value: 0, 1, low, high, or 0-255 for PWM pins.
+	ArgValue = "value"
+	// ArgJSON is a JSON value. It is always the last argument, and may
+	// contain spaces.
+	ArgJSON = "json"
+)
+
+// CommandSchema describes a command and its arguments, so clients can build
+// forms for it. The server sends the schema of every command it supports in
+// the Commands message, and serves it as JSON at /commands.
+type CommandSchema struct {
+	Name        string
+	Description string
+	Args        []ArgSchema
+}
+
+// ArgSchema describes one argument of a command. Arguments are positional and
+// separated by spaces, in the order listed.
+type ArgSchema struct {
+	Name        string
+	Type        string
+	Description string
+	Enum        []string `json:",omitempty"`
+	Min         *int     `json:",omitempty"`
+	Max         *int     `json:",omitempty"`
+	Default     string   `json:",omitempty"`
+
+	// Optional arguments may be left off the end of the command.
+	Optional bool `json:",omitempty"`
+	// A Variadic argument is last and may be repeated.
+	Variadic bool `json:",omitempty"`
+}
+
+// Usage formats the command as a usage line, e.g.
+// "setpin <pin> <value>".
+func (c CommandSchema) Usage() string {
+	usage := c.Name
+	for _, arg := range c.Args {
+		name := "<" + arg.Name + ">"
+		if arg.Variadic {
+			name += "..."
+		}
+		if arg.Optional {
+			name = "[" + name + "]"
+		}
+		usage += " " + name
+	}
+	return usage
+}
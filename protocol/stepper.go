@@ -0,0 +1,49 @@
+package protocol
+
+// Stepper is a stepper motor driven through a step/dir driver such as an
+// A4988 or DRV8825, wired to three output pins. Each pulse of Step moves it
+// one step, forwards while Dir is high, and the driver is enabled through
+// Enable while it moves, and between moves too if Hold is set.
+//
+// Speed is the top speed in steps per second and Accel the acceleration in
+// steps per second per second of moves that don't give their own, the
+// server's defaults when 0. Limit is an optional input wired to a limit switch, active when high,
+// or low if LimitActiveLow is set. Moves are refused while it is active and
+// stopped as soon as it becomes so, and homing runs towards it, backwards
+// unless HomeForward is set.
+//
+// State is only sent to clients.
+type Stepper struct {
+	Step   string
+	Dir    string
+	Enable string
+
+	EnableActiveLow bool `json:",omitempty"`
+	Hold            bool `json:",omitempty"`
+
+	Speed int `json:",omitempty"`
+	Accel int `json:",omitempty"`
+
+	Limit          string `json:",omitempty"`
+	LimitActiveLow bool   `json:",omitempty"`
+	HomeForward    bool   `json:",omitempty"`
+
+	State *StepperState `json:",omitempty"`
+}
+
+// StepperState is sent as a Stepper event when a stepper starts moving, every
+// so often while it moves, and when it stops. Position counts steps from
+// where it was last homed, or from where it was when the server started.
+// Target is where a move is heading, and Speed how fast it goes in steps
+// per second. Error is set when a move stopped short, such as on hitting the
+// limit switch.
+type StepperState struct {
+	Stepper  string
+	Position int64
+	Target   int64   `json:",omitempty"`
+	Speed    float64 `json:",omitempty"`
+	Moving   bool
+	Homing   bool `json:",omitempty"`
+	Homed    bool
+	Error    *Error `json:",omitempty"`
+}
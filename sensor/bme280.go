@@ -0,0 +1,235 @@
+package sensor
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+// BME280 registers, and values.
+const (
+	bmeCalib1   = 0x88
+	bmeChipId   = 0xd0
+	bmeCalib2   = 0xe1
+	bmeCtrlHum  = 0xf2
+	bmeStatus   = 0xf3
+	bmeCtrlMeas = 0xf4
+	bmeData     = 0xf7
+
+	bme280Id = 0x60
+	// ctrl_meas for one measurement of temperature and pressure, each
+	// oversampled once
+	bmeForced = 0x25
+	// status bit set while measuring
+	bmeMeasuring = 0x08
+)
+
+// bmp280Ids are the chip ids of the BMP280, which has no humidity sensor.
+var bmp280Ids = map[byte]bool{0x56: true, 0x57: true, 0x58: true}
+
+func init() {
+	Register("bme280", openBME280)
+}
+
+// BME280 reads the temperature, humidity and pressure from a Bosch BME280
+// on the I2C bus, or the temperature and pressure from a BMP280. As a
+// driver, its options are:
+//
+//	bus   the I2C bus, 1 by default
+//	addr  the address, 0x76 by default or 0x77 with SDO high
+//
+// It is reported as sensors <name>_temperature in degrees Celsius,
+// <name>_humidity in percent and <name>_pressure in pascals.
+type BME280 struct {
+	Name  string
+	Model string
+
+	dev gpio.I2C
+
+	// calibration
+	t1             float64
+	t2, t3         float64
+	p1             float64
+	p2, p3, p4, p5 float64
+	p6, p7, p8, p9 float64
+	h1, h2, h3     float64
+	h4, h5, h6     float64
+}
+
+func openBME280(name string, options map[string]string, pins gpio.Claimer) (Driver, error) {
+	if err := checkOptions("bme280", options, "bus", "addr"); err != nil {
+		return nil, err
+	}
+	bus, addr := uint64(1), uint64(0x76)
+	var err error
+	if v, ok := options["bus"]; ok {
+		if bus, err = strconv.ParseUint(v, 0, 8); err != nil {
+			return nil, gpio.NewError(gpio.CodeInvalidValue, "", "Invalid bus for bme280 : "+v)
+		}
+	}
+	if v, ok := options["addr"]; ok {
+		if addr, err = strconv.ParseUint(v, 0, 7); err != nil {
+			return nil, gpio.NewError(gpio.CodeInvalidValue, "", "Invalid addr for bme280 : "+v)
+		}
+	}
+	dev, err := gpio.OpenI2C(byte(bus), byte(addr))
+	if err != nil {
+		return nil, err
+	}
+	b, err := NewBME280(name, dev)
+	if err != nil {
+		dev.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// NewBME280 reads the calibration of the BME280 or BMP280 on dev.
+func NewBME280(name string, dev gpio.I2C) (*BME280, error) {
+	b := &BME280{Name: name, dev: dev}
+	id := make([]byte, 1)
+	if err := dev.ReadReg(bmeChipId, id); err != nil {
+		return nil, err
+	}
+	switch {
+	case id[0] == bme280Id:
+		b.Model = "BME280"
+	case bmp280Ids[id[0]]:
+		b.Model = "BMP280"
+	default:
+		return nil, gpio.NewError(gpio.CodeHardwareFailure, "", "No BME280 found, chip id is 0x"+strconv.FormatUint(uint64(id[0]), 16))
+	}
+
+	c := make([]byte, 26)
+	if err := dev.ReadReg(bmeCalib1, c); err != nil {
+		return nil, err
+	}
+	u16 := func(i int) float64 { return float64(uint16(c[i]) | uint16(c[i+1])<<8) }
+	s16 := func(i int) float64 { return float64(int16(uint16(c[i]) | uint16(c[i+1])<<8)) }
+	b.t1, b.t2, b.t3 = u16(0), s16(2), s16(4)
+	b.p1, b.p2, b.p3, b.p4, b.p5 = u16(6), s16(8), s16(10), s16(12), s16(14)
+	b.p6, b.p7, b.p8, b.p9 = s16(16), s16(18), s16(20), s16(22)
+	if b.Model == "BMP280" {
+		return b, nil
+	}
+	b.h1 = float64(c[25])
+
+	h := make([]byte, 7)
+	if err := dev.ReadReg(bmeCalib2, h); err != nil {
+		return nil, err
+	}
+	b.h2 = float64(int16(uint16(h[0]) | uint16(h[1])<<8))
+	b.h3 = float64(h[2])
+	// 12 bit signed values sharing a byte
+	b.h4 = float64(int16(int8(h[3]))<<4 | int16(h[4]&0x0f))
+	b.h5 = float64(int16(int8(h[5]))<<4 | int16(h[4]>>4))
+	b.h6 = float64(int8(h[6]))
+	return b, nil
+}
+
+// Measure takes one measurement, returning the temperature in degrees
+// Celsius, the relative humidity in percent, 0 for a BMP280, and the
+// pressure in pascals.
+func (b *BME280) Measure() (temperature float64, humidity float64, pressure float64, err error) {
+	// humidity settings only apply once ctrl_meas is written
+	if err = b.dev.WriteReg(bmeCtrlHum, []byte{0x01}); err != nil {
+		return
+	}
+	if err = b.dev.WriteReg(bmeCtrlMeas, []byte{bmeForced}); err != nil {
+		return
+	}
+	status := make([]byte, 1)
+	for i := 0; ; i++ {
+		time.Sleep(2 * time.Millisecond)
+		if err = b.dev.ReadReg(bmeStatus, status); err != nil {
+			return
+		}
+		if status[0]&bmeMeasuring == 0 {
+			break
+		}
+		if i == 50 {
+			err = gpio.NewError(gpio.CodeHardwareFailure, "", b.Model+" "+b.Name+" didn't finish measuring")
+			return
+		}
+	}
+
+	d := make([]byte, 8)
+	if err = b.dev.ReadReg(bmeData, d); err != nil {
+		return
+	}
+	adcP := float64(uint32(d[0])<<12 | uint32(d[1])<<4 | uint32(d[2])>>4)
+	adcT := float64(uint32(d[3])<<12 | uint32(d[4])<<4 | uint32(d[5])>>4)
+	adcH := float64(uint32(d[6])<<8 | uint32(d[7]))
+
+	// compensation as given in the datasheet
+	v1 := (adcT/16384 - b.t1/1024) * b.t2
+	v2 := (adcT/131072 - b.t1/8192) * (adcT/131072 - b.t1/8192) * b.t3
+	tFine := v1 + v2
+	temperature = tFine / 5120
+
+	v1 = tFine/2 - 64000
+	v2 = v1 * v1 * b.p6 / 32768
+	v2 += v1 * b.p5 * 2
+	v2 = v2/4 + b.p4*65536
+	v1 = (b.p3*v1*v1/524288 + b.p2*v1) / 524288
+	v1 = (1 + v1/32768) * b.p1
+	if v1 != 0 {
+		pressure = 1048576 - adcP
+		pressure = (pressure - v2/4096) * 6250 / v1
+		v1 = b.p9 * pressure * pressure / 2147483648
+		v2 = pressure * b.p8 / 32768
+		pressure += (v1 + v2 + b.p7) / 16
+	}
+
+	if b.Model == "BMP280" {
+		return
+	}
+	h := tFine - 76800
+	h = (adcH - (b.h4*64 + b.h5/16384*h)) * (b.h2 / 65536 * (1 + b.h6/67108864*h*(1+b.h3/67108864*h)))
+	humidity = h * (1 - b.h1*h/524288)
+	if humidity > 100 {
+		humidity = 100
+	} else if humidity < 0 {
+		humidity = 0
+	}
+	return
+}
+
+// Read takes one measurement.
+func (b *BME280) Read() ([]Reading, error) {
+	readings := []Reading{
+		{Id: b.Name + "_temperature", Kind: KindTemperature, Unit: UnitCelsius},
+		{Id: b.Name + "_pressure", Kind: KindPressure, Unit: UnitPascal},
+	}
+	if b.Model == "BME280" {
+		readings = append(readings, Reading{Id: b.Name + "_humidity", Kind: KindHumidity, Unit: UnitPercent})
+	}
+	temperature, humidity, pressure, err := b.Measure()
+	now := time.Now()
+	for i := range readings {
+		r := &readings[i]
+		r.Model = b.Model
+		if err != nil {
+			r.Quality = QualityBad
+			r.Error = "Failed to read " + strings.ToLower(b.Model) + " " + b.Name + " : " + err.Error()
+			continue
+		}
+		r.Quality, r.Time = QualityGood, now
+		switch r.Kind {
+		case KindTemperature:
+			r.Value = temperature
+		case KindPressure:
+			r.Value = pressure
+		case KindHumidity:
+			r.Value = humidity
+		}
+	}
+	return readings, nil
+}
+
+// Close closes the I2C device.
+func (b *BME280) Close() error {
+	return b.dev.Close()
+}
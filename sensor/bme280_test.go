@@ -0,0 +1,99 @@
+package sensor
+
+import (
+	"math"
+	"testing"
+)
+
+// newBMEDevice returns a device with chip id id, the calibration and raw
+// readings of the worked example in the BMP280 datasheet, and a humidity
+// calibration of a BME280.
+func newBMEDevice(id byte) *fakeI2C {
+	f := &fakeI2C{}
+	f.regs[bmeChipId] = id
+	calibration := []int{27504, 26435, -1000, 36477, -10685, 3024, 2855, 140, -7, 15500, -14600, 6000}
+	for i, v := range calibration {
+		f.regs[bmeCalib1+2*i] = byte(uint16(v))
+		f.regs[bmeCalib1+2*i+1] = byte(uint16(v) >> 8)
+	}
+	f.regs[0xa1] = 75
+	copy(f.regs[bmeCalib2:], []byte{0x6a, 0x01, 0x00, 0x13, 0x2d, 0x03, 0x1e})
+	adcP, adcT := 415148, 519888
+	copy(f.regs[bmeData:], []byte{byte(adcP >> 12), byte(adcP >> 4), byte(adcP << 4), byte(adcT >> 12), byte(adcT >> 4), byte(adcT << 4), 0x6e, 0x00})
+	return f
+}
+
+func TestBME280(t *testing.T) {
+	dev := newBMEDevice(bme280Id)
+	b, err := NewBME280("env", dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Model != "BME280" || b.h4 != 0x13<<4|0x0d || b.h5 != 0x03<<4|0x02 {
+		t.Errorf("got model %s, h4 %v and h5 %v", b.Model, b.h4, b.h5)
+	}
+	temperature, humidity, pressure, err := b.Measure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(temperature-25.08) > 0.01 || math.Abs(pressure-100653.27) > 0.01 {
+		t.Errorf("got %vC and %vPa, want 25.08C and 100653.27Pa", temperature, pressure)
+	}
+	if humidity <= 0 || humidity >= 100 {
+		t.Errorf("got %v%% humidity", humidity)
+	}
+	// forced mode, with humidity set first as it only applies once
+	// ctrl_meas is written
+	if dev.regs[bmeCtrlHum] != 0x01 || dev.regs[bmeCtrlMeas] != bmeForced {
+		t.Errorf("got ctrl_hum %02x and ctrl_meas %02x", dev.regs[bmeCtrlHum], dev.regs[bmeCtrlMeas])
+	}
+
+	readings, err := b.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]string{"env_temperature": UnitCelsius, "env_pressure": UnitPascal, "env_humidity": UnitPercent}
+	if len(readings) != len(ids) {
+		t.Errorf("got %d readings, want %d", len(readings), len(ids))
+	}
+	for _, r := range readings {
+		if unit, ok := ids[r.Id]; !ok || r.Unit != unit || r.Quality != QualityGood {
+			t.Errorf("got %v", r)
+		}
+	}
+}
+
+func TestBMP280(t *testing.T) {
+	b, err := NewBME280("env", newBMEDevice(0x58))
+	if err != nil {
+		t.Fatal(err)
+	}
+	readings, err := b.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Model != "BMP280" || len(readings) != 2 {
+		t.Errorf("got %s with %v", b.Model, readings)
+	}
+	if _, err := NewBME280("env", newBMEDevice(0x11)); err == nil {
+		t.Error("found a BME280 with chip id 0x11")
+	}
+}
+
+func TestBME280Busy(t *testing.T) {
+	dev := newBMEDevice(bme280Id)
+	b, err := NewBME280("env", dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev.regs[bmeStatus] = bmeMeasuring
+	readings, err := b.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range readings {
+		if r.Quality != QualityBad || r.Error == "" {
+			t.Errorf("got %v from a chip that never finishes measuring", r)
+		}
+	}
+}
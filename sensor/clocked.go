@@ -0,0 +1,26 @@
+package sensor
+
+import (
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+// Clocked is a pair of GPIO pins, a clock output and a data input, a serial
+// sensor such as an HX711 is bit-banged through. It bypasses the GPIO
+// backend, which can't pulse the clock as briefly as these sensors need.
+// openClocked opens a clock and a data pin, given by id or alias as listed
+// in the board's pin map, as a line. The pins must not be initialised.
+type Clocked interface {
+	// ShiftIn waits up to timeout for the sensor to pull the data line low,
+	// telling it has data, then pulses the clock pulses times, reading the
+	// data line while it is high. It returns the first bits read, the first
+	// as the most significant.
+	ShiftIn(bits int, pulses int, timeout time.Duration) (uint32, error)
+	Close() error
+}
+
+// errNotReady is returned by ShiftIn when the sensor has no data in time.
+func errNotReady(timeout time.Duration) error {
+	return gpio.NewError(gpio.CodeHardwareFailure, "", "No data within "+timeout.String())
+}
@@ -0,0 +1,78 @@
+//go:build linux && arm
+// +build linux,arm
+
+package sensor
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+// clockHalf is how long the clock stays at each level while shifting. An
+// HX711 needs at least 0.2µs, and powers down when it stays high over 60µs.
+const clockHalf = time.Microsecond
+
+// gpioClocked is a clocked line on two pins of a Raspberry Pi.
+type gpioClocked struct {
+	clock *gpioMem
+	data  *gpioMem
+}
+
+func openClocked(pins gpio.Claimer, clockPin string, dataPin string) (Clocked, error) {
+	clock, err := openGPIOMem(pins, clockPin, "Clocked sensors")
+	if err != nil {
+		return nil, err
+	}
+	data, err := openGPIOMem(pins, dataPin, "Clocked sensors")
+	if err != nil {
+		clock.close()
+		return nil, err
+	}
+	clock.set(false)
+	clock.setOutput(true)
+	return &gpioClocked{clock: clock, data: data}, nil
+}
+
+// spin waits for d without giving up the thread.
+func spin(d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
+
+func (c *gpioClocked) ShiftIn(bits int, pulses int, timeout time.Duration) (uint32, error) {
+	for deadline := time.Now().Add(timeout); c.data.level() != 0; {
+		if time.Now().After(deadline) {
+			return 0, errNotReady(timeout)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// stay on one thread while shifting, so the clock isn't left high for
+	// long
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var v uint32
+	for i := 0; i < pulses; i++ {
+		c.clock.set(true)
+		spin(clockHalf)
+		bit := c.data.level()
+		c.clock.set(false)
+		spin(clockHalf)
+		if i < bits {
+			v = v<<1 | bit
+		}
+	}
+	return v, nil
+}
+
+// Close leaves both pins inputs, and unmaps the registers.
+func (c *gpioClocked) Close() error {
+	err := c.clock.close()
+	if derr := c.data.close(); err == nil {
+		err = derr
+	}
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build !linux || !arm
+// +build !linux !arm
+
+package sensor
+
+import "github.com/benjamind/gpio-json-server/gpio"
+
+func openClocked(pins gpio.Claimer, clockPin string, dataPin string) (Clocked, error) {
+	return nil, gpio.NewError(gpio.CodeUnsupported, clockPin, "Clocked sensors are not supported on this board")
+}
@@ -0,0 +1,29 @@
+package sensor
+
+import "time"
+
+// fakeClocked is a Clocked line answering every shift with the value answer
+// returns, or timing out when it returns false.
+type fakeClocked struct {
+	answer func() (uint32, bool)
+	// the clock pulses of every shift
+	pulses []int
+	closed bool
+}
+
+func (f *fakeClocked) ShiftIn(bits int, pulses int, timeout time.Duration) (uint32, error) {
+	f.pulses = append(f.pulses, pulses)
+	if f.answer == nil {
+		return 0, errNotReady(timeout)
+	}
+	v, ok := f.answer()
+	if !ok {
+		return 0, errNotReady(timeout)
+	}
+	return v & (1<<uint(bits) - 1), nil
+}
+
+func (f *fakeClocked) Close() error {
+	f.closed = true
+	return nil
+}
@@ -0,0 +1,176 @@
+package sensor
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+// DefaultDHTRetries is how many times a DHT read failing its checksum is
+// retried unless configured otherwise.
+const DefaultDHTRetries = 3
+
+// dhtIdle is how long the line stays at one level once a DHT has answered.
+// Every level of the answer is shorter.
+const dhtIdle = time.Millisecond
+
+func init() {
+	Register("dht11", func(name string, options map[string]string, pins gpio.Claimer) (Driver, error) {
+		return openDHT(name, "DHT11", options, pins)
+	})
+	Register("dht22", func(name string, options map[string]string, pins gpio.Claimer) (Driver, error) {
+		return openDHT(name, "DHT22", options, pins)
+	})
+}
+
+// DHT reads the temperature and humidity from a DHT11 or DHT22 (AM2302),
+// bit-banged through the pin its data line is wired to, which needs a
+// pull-up as most modules have. As a driver, its options are:
+//
+//	pin      the pin, which must not be initialised, required
+//	retries  how many times a read that fails its checksum or misses bits
+//	         is retried, 3 by default
+//
+// It is reported as sensors <name>_temperature in degrees Celsius and
+// <name>_humidity in percent. A DHT11 can only be read every second and a
+// DHT22 every two, so reads, retries included, wait that long after the
+// last.
+type DHT struct {
+	Name    string
+	Model   string
+	Retries int
+
+	wire Wire
+	// how long the start signal lasts, and the time between reads
+	start    time.Duration
+	interval time.Duration
+	last     time.Time
+}
+
+func openDHT(name string, model string, options map[string]string, pins gpio.Claimer) (Driver, error) {
+	driver := strings.ToLower(model)
+	if err := checkOptions(driver, options, "pin", "retries"); err != nil {
+		return nil, err
+	}
+	pin, ok := options["pin"]
+	if !ok {
+		return nil, gpio.NewError(gpio.CodeInvalidArguments, "", "Option pin is required for "+driver)
+	}
+	retries := DefaultDHTRetries
+	if v, ok := options["retries"]; ok {
+		var err error
+		if retries, err = strconv.Atoi(v); err != nil || retries < 0 || retries > 10 {
+			return nil, gpio.NewError(gpio.CodeInvalidValue, "", "Invalid retries for "+driver+", must be 0-10 : "+v)
+		}
+	}
+	wire, err := openWire(pins, pin)
+	if err != nil {
+		return nil, err
+	}
+	return NewDHT(name, model, wire, retries), nil
+}
+
+// NewDHT reads a DHT11 or DHT22, as given by model, through wire.
+func NewDHT(name string, model string, wire Wire, retries int) *DHT {
+	d := &DHT{Name: name, Model: model, Retries: retries, wire: wire}
+	if model == "DHT11" {
+		d.start, d.interval = 18*time.Millisecond, time.Second
+	} else {
+		d.start, d.interval = 1100*time.Microsecond, 2*time.Second
+	}
+	return d
+}
+
+// Measure returns the temperature in degrees Celsius and the relative
+// humidity in percent, retrying reads that fail their checksum or miss bits.
+func (d *DHT) Measure() (temperature float64, humidity float64, err error) {
+	for try := 0; try <= d.Retries; try++ {
+		if wait := d.interval - time.Since(d.last); wait > 0 {
+			time.Sleep(wait)
+		}
+		levels, werr := d.wire.Exchange(d.start, dhtIdle)
+		d.last = time.Now()
+		if werr != nil {
+			return 0, 0, werr
+		}
+		var data [5]byte
+		if data, err = decodeDHT(levels); err != nil {
+			continue
+		}
+		if d.Model == "DHT11" {
+			humidity = float64(data[0]) + float64(data[1])/10
+			temperature = float64(data[2]) + float64(data[3]&0x7f)/10
+			if data[3]&0x80 != 0 {
+				temperature = -temperature
+			}
+		} else {
+			humidity = float64(uint16(data[0])<<8|uint16(data[1])) / 10
+			temperature = float64(uint16(data[2]&0x7f)<<8|uint16(data[3])) / 10
+			if data[2]&0x80 != 0 {
+				temperature = -temperature
+			}
+		}
+		return temperature, humidity, nil
+	}
+	return 0, 0, gpio.NewError(gpio.CodeHardwareFailure, "", err.Error()+" after "+strconv.Itoa(d.Retries+1)+" tries")
+}
+
+// decodeDHT decodes the 5 bytes a DHT answers with, given how long each
+// level of its answer lasted. The answer ends with 40 bits, each a low then
+// a high lasting longer than the low for a 1, and a last low. The fifth byte
+// is the checksum of the first four.
+func decodeDHT(levels []time.Duration) ([5]byte, error) {
+	var data [5]byte
+	n := len(levels)
+	if n == 0 {
+		return data, gpio.NewError(gpio.CodeHardwareFailure, "", "No answer")
+	}
+	// the high after release, the sensor's low and high, the bits and the
+	// last low
+	if n < 84 || n%2 != 0 {
+		return data, gpio.NewError(gpio.CodeHardwareFailure, "", "Missed bits of the answer")
+	}
+	for i := 0; i < 40; i++ {
+		data[i/8] <<= 1
+		if levels[n-80+2*i] > levels[n-81+2*i] {
+			data[i/8] |= 1
+		}
+	}
+	if data[0]+data[1]+data[2]+data[3] != data[4] {
+		return data, gpio.NewError(gpio.CodeHardwareFailure, "", "Checksum failed")
+	}
+	return data, nil
+}
+
+// Read takes one measurement.
+func (d *DHT) Read() ([]Reading, error) {
+	readings := []Reading{
+		{Id: d.Name + "_temperature", Kind: KindTemperature, Unit: UnitCelsius},
+		{Id: d.Name + "_humidity", Kind: KindHumidity, Unit: UnitPercent},
+	}
+	temperature, humidity, err := d.Measure()
+	now := time.Now()
+	for i := range readings {
+		r := &readings[i]
+		r.Model = d.Model
+		if err != nil {
+			r.Quality = QualityBad
+			r.Error = "Failed to read " + strings.ToLower(d.Model) + " " + d.Name + " : " + err.Error()
+			continue
+		}
+		r.Quality, r.Time = QualityGood, now
+		if r.Kind == KindTemperature {
+			r.Value = temperature
+		} else {
+			r.Value = humidity
+		}
+	}
+	return readings, nil
+}
+
+// Close closes the line.
+func (d *DHT) Close() error {
+	return d.wire.Close()
+}
@@ -0,0 +1,158 @@
+package sensor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+// dhtAnswer returns the levels a DHT answers data with: the high after the
+// start signal is released, its 80us low and high, each bit as a 50us low
+// and a high of 27us for a 0 or 70us for a 1, and a last low.
+func dhtAnswer(data [5]byte) []time.Duration {
+	us := time.Microsecond
+	levels := []time.Duration{20 * us, 80 * us, 80 * us}
+	for i := 0; i < 40; i++ {
+		levels = append(levels, 50*us)
+		if data[i/8]>>(7-uint(i%8))&1 == 1 {
+			levels = append(levels, 70*us)
+		} else {
+			levels = append(levels, 27*us)
+		}
+	}
+	return append(levels, 50*us)
+}
+
+// withChecksum sets the checksum of data.
+func withChecksum(data [5]byte) [5]byte {
+	data[4] = data[0] + data[1] + data[2] + data[3]
+	return data
+}
+
+func TestDecodeDHT(t *testing.T) {
+	good := withChecksum([5]byte{0x02, 0x8c, 0x80, 0x65})
+	bad := good
+	bad[4]++
+	tests := []struct {
+		name   string
+		levels []time.Duration
+		err    string
+	}{
+		{"good", dhtAnswer(good), ""},
+		{"bad checksum", dhtAnswer(bad), "Checksum failed"},
+		{"missed bits", dhtAnswer(good)[5:], "Missed bits of the answer"},
+		{"odd levels", append(dhtAnswer(good), 20*time.Microsecond), "Missed bits of the answer"},
+		{"no answer", nil, "No answer"},
+	}
+	for _, test := range tests {
+		data, err := decodeDHT(test.levels)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err || gpio.CodeOf(err) != gpio.CodeHardwareFailure {
+				t.Errorf("%s: got %v, want %s", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil || data != good {
+			t.Errorf("%s: got % x, %v, want % x", test.name, data, err, good)
+		}
+	}
+}
+
+func TestDHTMeasure(t *testing.T) {
+	tests := []struct {
+		model       string
+		data        [5]byte
+		temperature float64
+		humidity    float64
+	}{
+		{"DHT22", withChecksum([5]byte{0x02, 0x8c, 0x01, 0x5f}), 35.1, 65.2},
+		{"DHT22", withChecksum([5]byte{0x02, 0x8c, 0x80, 0x65}), -10.1, 65.2},
+		{"DHT11", withChecksum([5]byte{45, 0, 23, 4}), 23.4, 45},
+		{"DHT11", withChecksum([5]byte{45, 0, 1, 0x82}), -1.2, 45},
+	}
+	for _, test := range tests {
+		answer := dhtAnswer(test.data)
+		d := NewDHT("box", test.model, &fakeWire{answer: func() []time.Duration { return answer }}, 0)
+		temperature, humidity, err := d.Measure()
+		if err != nil || temperature != test.temperature || humidity != test.humidity {
+			t.Errorf("%s % x: got %v, %v, %v, want %v, %v", test.model, test.data, temperature, humidity, err, test.temperature, test.humidity)
+		}
+	}
+}
+
+func TestDHTRetries(t *testing.T) {
+	good := withChecksum([5]byte{0x02, 0x8c, 0x01, 0x5f})
+	bad := good
+	bad[4]++
+	// a failed checksum, then missed bits, then a good answer
+	answers := [][]time.Duration{dhtAnswer(bad), dhtAnswer(good)[5:], dhtAnswer(good)}
+	w := &fakeWire{}
+	w.answer = func() []time.Duration { return answers[(w.exchanges-1)%len(answers)] }
+	d := NewDHT("box", "DHT22", w, 2)
+	d.interval = 0
+	readings, err := d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.exchanges != 3 {
+		t.Errorf("read %d times, want 3", w.exchanges)
+	}
+	if len(readings) != 2 || readings[0].Id != "box_temperature" || readings[1].Id != "box_humidity" {
+		t.Fatalf("got %v", readings)
+	}
+	if readings[0].Value != 35.1 || readings[1].Value != 65.2 || readings[0].Quality != QualityGood || readings[1].Quality != QualityGood {
+		t.Errorf("got %v", readings)
+	}
+
+	// one try and a retry, both failing their checksum
+	w.exchanges = 0
+	w.answer = func() []time.Duration { return dhtAnswer(bad) }
+	d.Retries = 1
+	readings, err = d.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.exchanges != 2 {
+		t.Errorf("read %d times, want 2", w.exchanges)
+	}
+	for _, r := range readings {
+		if r.Quality != QualityBad || !strings.HasSuffix(r.Error, "Checksum failed after 2 tries") {
+			t.Errorf("%s: got %s %q", r.Id, r.Quality, r.Error)
+		}
+	}
+}
+
+func TestDHTInterval(t *testing.T) {
+	good := withChecksum([5]byte{0x02, 0x8c, 0x01, 0x5f})
+	d := NewDHT("box", "DHT22", &fakeWire{answer: func() []time.Duration { return dhtAnswer(good) }}, 0)
+	d.interval = 50 * time.Millisecond
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, _, err := d.Measure(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first read doesn't wait
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("3 reads took %v, want at least 100ms", elapsed)
+	}
+}
+
+func TestDHTOptions(t *testing.T) {
+	tests := []struct {
+		options map[string]string
+		code    gpio.ErrorCode
+	}{
+		{map[string]string{}, gpio.CodeInvalidArguments},
+		{map[string]string{"pin": "GPIO_4", "speed": "1"}, gpio.CodeInvalidArguments},
+		{map[string]string{"pin": "GPIO_4", "retries": "11"}, gpio.CodeInvalidValue},
+		{map[string]string{"pin": "GPIO_4", "retries": "-1"}, gpio.CodeInvalidValue},
+	}
+	for _, test := range tests {
+		if _, err := Open("box", Config{Driver: "dht22", Options: test.options}, nil); gpio.CodeOf(err) != test.code {
+			t.Errorf("%v: got %v, want a %s error", test.options, err, test.code)
+		}
+	}
+}
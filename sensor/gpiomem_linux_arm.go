@@ -0,0 +1,114 @@
+//go:build linux && arm
+// +build linux,arm
+
+package sensor
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/kidoman/embd"
+)
+
+// GPIO registers of the Raspberry Pi's BCM283x, as words from the start of
+// /dev/gpiomem.
+const (
+	gpioSet0 = 0x1c / 4
+	gpioClr0 = 0x28 / 4
+	gpioLev0 = 0x34 / 4
+)
+
+// fselMu serialises changes to the function select registers, each of which
+// is shared by 10 pins, so pins of different sensors can't undo each other's
+// changes.
+var fselMu sync.Mutex
+
+// gpioMem is a pin of a Raspberry Pi driven through its GPIO registers,
+// mapped from /dev/gpiomem, which can be polled fast enough to time the
+// bits of sensors bit-banged through it. The pin is claimed from the GPIO
+// backend while open.
+type gpioMem struct {
+	pins  gpio.Claimer
+	mem   []byte
+	regs  *[1024]uint32
+	pinId string
+	pin   uint
+}
+
+// openGPIOMem maps the registers of a pin, given by id or alias, leaving it
+// an input. The pin is claimed from pins, so must not be initialised.
+func openGPIOMem(pins gpio.Claimer, pinId string, what string) (*gpioMem, error) {
+	if pins == nil {
+		return nil, gpio.NewError(gpio.CodeUnsupported, pinId, what+" are not supported by this GPIO backend")
+	}
+	host, _, err := embd.DetectHost()
+	if err != nil {
+		return nil, err
+	}
+	if host != embd.HostRPi {
+		return nil, gpio.NewError(gpio.CodeUnsupported, pinId, what+" are only supported on a Raspberry Pi")
+	}
+	desc, err := embd.DescribeHost()
+	if err != nil {
+		return nil, err
+	}
+	pd, ok := desc.GPIODriver().PinMap().Lookup(pinId, embd.CapDigital)
+	if !ok {
+		return nil, gpio.NewError(gpio.CodeUnknownPin, pinId, "Unknown pin "+pinId)
+	}
+	if err := pins.Claim(pd.ID, strings.ToLower(what)); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile("/dev/gpiomem", os.O_RDWR|os.O_SYNC, 0)
+	if err != nil {
+		pins.Release(pd.ID)
+		return nil, err
+	}
+	defer f.Close()
+	mem, err := syscall.Mmap(int(f.Fd()), 0, 4096, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		pins.Release(pd.ID)
+		return nil, err
+	}
+	g := &gpioMem{pins: pins, mem: mem, regs: (*[1024]uint32)(unsafe.Pointer(&mem[0])), pinId: pd.ID, pin: uint(pd.DigitalLogical)}
+	g.setOutput(false)
+	return g, nil
+}
+
+// setOutput makes the pin an output, or an input.
+func (g *gpioMem) setOutput(out bool) {
+	fselMu.Lock()
+	defer fselMu.Unlock()
+	reg := &g.regs[g.pin/10]
+	shift := g.pin % 10 * 3
+	mode := atomic.LoadUint32(reg) &^ (7 << shift)
+	if out {
+		mode |= 1 << shift
+	}
+	atomic.StoreUint32(reg, mode)
+}
+
+// set drives the pin high, or low, when it is an output.
+func (g *gpioMem) set(high bool) {
+	reg := gpioClr0
+	if high {
+		reg = gpioSet0
+	}
+	atomic.StoreUint32(&g.regs[reg+int(g.pin/32)], 1<<(g.pin%32))
+}
+
+func (g *gpioMem) level() uint32 {
+	return atomic.LoadUint32(&g.regs[gpioLev0+g.pin/32]) >> (g.pin % 32) & 1
+}
+
+// close leaves the pin an input, unmaps the registers and releases the pin.
+func (g *gpioMem) close() error {
+	g.setOutput(false)
+	defer g.pins.Release(g.pinId)
+	return syscall.Munmap(g.mem)
+}
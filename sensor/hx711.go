@@ -0,0 +1,228 @@
+package sensor
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+// HX711 defaults.
+const (
+	DefaultHX711Gain    = 128
+	DefaultHX711Samples = 5
+)
+
+// hx711Pulses are the clock pulses reading a conversion takes, by the gain
+// they select for the next. Gains of 128 and 64 are of channel A, and 32 of
+// channel B.
+var hx711Pulses = map[int]int{128: 25, 32: 26, 64: 27}
+
+// hx711Timeout is how long to wait for a conversion. An HX711 makes 10 or 80
+// a second.
+const hx711Timeout = 500 * time.Millisecond
+
+func init() {
+	Register("hx711", openHX711)
+}
+
+// HX711 weighs with a load cell through an HX711 amplifier, bit-banged
+// through the pins its DOUT and PD_SCK are wired to. As a driver, its
+// options are:
+//
+//	data     the pin wired to DOUT, which must not be initialised, required
+//	clock    the pin wired to PD_SCK, which must not be initialised, required
+//	gain     128 or 64 to read channel A, or 32 to read channel B, 128 by
+//	         default
+//	samples  how many reads the weight is averaged over, 1-100, 5 by default
+//	offset   the raw value read with nothing on the scale, 0 by default
+//	scale    the raw value per unit of weight, 1 by default
+//	unit     the unit of weight, kg by default
+//
+// It is reported as sensor <name>_weight. Until it is tared and calibrated
+// it reads raw values, which Tare and Calibrate set offset and scale from.
+type HX711 struct {
+	Name    string
+	Gain    int
+	Samples int
+	Unit    string
+
+	line   Clocked
+	pulses int
+	// set once a conversion has been read at Gain, which only applies to
+	// the next
+	primed bool
+
+	mu     sync.Mutex
+	offset float64
+	scale  float64
+	// the last raw values, the oldest at next once full
+	raw  []float64
+	next int
+}
+
+func openHX711(name string, options map[string]string, pins gpio.Claimer) (Driver, error) {
+	if err := checkOptions("hx711", options, "data", "clock", "gain", "samples", "offset", "scale", "unit"); err != nil {
+		return nil, err
+	}
+	data, clock := options["data"], options["clock"]
+	if data == "" || clock == "" {
+		return nil, gpio.NewError(gpio.CodeInvalidArguments, "", "Options data and clock are required for hx711")
+	}
+	if data == clock {
+		return nil, gpio.NewError(gpio.CodeInvalidValue, data, "Pin "+data+" can't be both data and clock of hx711 "+name)
+	}
+	gain, samples := DefaultHX711Gain, DefaultHX711Samples
+	offset, scale := 0.0, 1.0
+	unit := UnitKilogram
+	var err error
+	if v, ok := options["gain"]; ok {
+		if gain, err = strconv.Atoi(v); err != nil || hx711Pulses[gain] == 0 {
+			return nil, gpio.NewError(gpio.CodeInvalidValue, "", "Invalid gain for hx711, must be 128, 64 or 32 : "+v)
+		}
+	}
+	if v, ok := options["samples"]; ok {
+		if samples, err = strconv.Atoi(v); err != nil || samples < 1 || samples > 100 {
+			return nil, gpio.NewError(gpio.CodeInvalidValue, "", "Invalid samples for hx711, must be 1-100 : "+v)
+		}
+	}
+	if v, ok := options["offset"]; ok {
+		if offset, err = strconv.ParseFloat(v, 64); err != nil {
+			return nil, gpio.NewError(gpio.CodeInvalidValue, "", "Invalid offset for hx711 : "+v)
+		}
+	}
+	if v, ok := options["scale"]; ok {
+		if scale, err = strconv.ParseFloat(v, 64); err != nil || scale == 0 {
+			return nil, gpio.NewError(gpio.CodeInvalidValue, "", "Invalid scale for hx711, must be a number other than 0 : "+v)
+		}
+	}
+	if v, ok := options["unit"]; ok && v != "" {
+		unit = v
+	}
+	line, err := openClocked(pins, clock, data)
+	if err != nil {
+		return nil, err
+	}
+	h := NewHX711(name, line, gain, samples)
+	h.Unit, h.offset, h.scale = unit, offset, scale
+	return h, nil
+}
+
+// NewHX711 reads an HX711 through line at gain, averaging samples reads.
+// It reads raw values until given an offset and scale by Tare and
+// Calibrate.
+func NewHX711(name string, line Clocked, gain int, samples int) *HX711 {
+	return &HX711{
+		Name:    name,
+		Gain:    gain,
+		Samples: samples,
+		Unit:    UnitKilogram,
+		line:    line,
+		pulses:  hx711Pulses[gain],
+		scale:   1,
+		raw:     make([]float64, 0, samples),
+	}
+}
+
+// convert reads one conversion, a 24 bit signed value.
+func (h *HX711) convert() (float64, error) {
+	v, err := h.line.ShiftIn(24, h.pulses, hx711Timeout)
+	if err != nil {
+		return 0, err
+	}
+	return float64(int32(v<<8) >> 8), nil
+}
+
+// Measure reads a conversion and returns the weight averaged over the last
+// reads. A failed read starts the average over.
+func (h *HX711) Measure() (float64, error) {
+	if !h.primed {
+		// the conversion read when opened is at the gain of the last read
+		if _, err := h.convert(); err != nil {
+			return 0, err
+		}
+		h.primed = true
+	}
+	v, err := h.convert()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		h.raw, h.next = h.raw[:0], 0
+		return 0, err
+	}
+	if len(h.raw) < h.Samples {
+		h.raw = append(h.raw, v)
+	} else {
+		h.raw[h.next] = v
+		h.next = (h.next + 1) % h.Samples
+	}
+	return (h.average() - h.offset) / h.scale, nil
+}
+
+// average returns the average of the last raw values. h.mu must be held.
+func (h *HX711) average() float64 {
+	sum := 0.0
+	for _, v := range h.raw {
+		sum += v
+	}
+	return sum / float64(len(h.raw))
+}
+
+// settled checks a full average of reads is available to tare or calibrate
+// with. h.mu must be held.
+func (h *HX711) settled(what string) error {
+	if len(h.raw) < h.Samples {
+		return gpio.NewError(gpio.CodeUnsupported, "", "Can't "+what+" hx711 "+h.Name+" until it has been read "+strconv.Itoa(h.Samples)+" times in a row")
+	}
+	return nil
+}
+
+// Tare makes the current weight read as zero, returning the offset option
+// that keeps it so.
+func (h *HX711) Tare() (map[string]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.settled("tare"); err != nil {
+		return nil, err
+	}
+	h.offset = h.average()
+	return map[string]string{"offset": strconv.FormatFloat(h.offset, 'g', -1, 64)}, nil
+}
+
+// Calibrate makes the current weight, over the tare, read as weight,
+// returning the scale option that keeps it so.
+func (h *HX711) Calibrate(weight float64) (map[string]string, error) {
+	if weight == 0 {
+		return nil, gpio.NewError(gpio.CodeInvalidValue, "", "Calibration weight can't be 0")
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.settled("calibrate"); err != nil {
+		return nil, err
+	}
+	diff := h.average() - h.offset
+	if diff == 0 {
+		return nil, gpio.NewError(gpio.CodeUnsupported, "", "Nothing is on hx711 "+h.Name+" since it was tared, put the weight on it to calibrate")
+	}
+	h.scale = diff / weight
+	return map[string]string{"scale": strconv.FormatFloat(h.scale, 'g', -1, 64)}, nil
+}
+
+// Read takes one measurement.
+func (h *HX711) Read() ([]Reading, error) {
+	r := Reading{Id: h.Name + "_weight", Model: "HX711", Kind: KindWeight, Unit: h.Unit}
+	weight, err := h.Measure()
+	if err != nil {
+		r.Quality = QualityBad
+		r.Error = "Failed to read hx711 " + h.Name + " : " + err.Error()
+		return []Reading{r}, nil
+	}
+	r.Value, r.Time, r.Quality = weight, time.Now(), QualityGood
+	return []Reading{r}, nil
+}
+
+// Close closes the line.
+func (h *HX711) Close() error {
+	return h.line.Close()
+}
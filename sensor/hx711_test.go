@@ -0,0 +1,167 @@
+package sensor
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+// answers returns a fakeClocked answer giving each of values in turn, then
+// the last for ever.
+func answers(values ...uint32) func() (uint32, bool) {
+	i := 0
+	return func() (uint32, bool) {
+		v := values[i]
+		if i < len(values)-1 {
+			i++
+		}
+		return v, true
+	}
+}
+
+func TestHX711Convert(t *testing.T) {
+	tests := []struct {
+		raw  uint32
+		want float64
+	}{
+		{0x000000, 0},
+		{0x00000a, 10},
+		{0x7fffff, 8388607},
+		{0xfffff6, -10},
+		{0x800000, -8388608},
+		{0xffffff, -1},
+	}
+	for _, test := range tests {
+		h := NewHX711("scale", &fakeClocked{answer: answers(test.raw)}, 128, 1)
+		if got, err := h.Measure(); err != nil || got != test.want {
+			t.Errorf("%06x: got %v, %v, want %v", test.raw, got, err, test.want)
+		}
+	}
+}
+
+func TestHX711Gain(t *testing.T) {
+	tests := []struct {
+		gain   int
+		pulses int
+	}{
+		{128, 25},
+		{32, 26},
+		{64, 27},
+	}
+	for _, test := range tests {
+		line := &fakeClocked{answer: answers(0)}
+		h := NewHX711("scale", line, test.gain, 1)
+		for i := 0; i < 2; i++ {
+			if _, err := h.Measure(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// the conversion read first is at the gain of the last read, and is
+		// thrown away
+		want := []int{test.pulses, test.pulses, test.pulses}
+		if !reflect.DeepEqual(line.pulses, want) {
+			t.Errorf("gain %d: pulsed %v, want %v", test.gain, line.pulses, want)
+		}
+	}
+}
+
+func TestHX711Average(t *testing.T) {
+	h := NewHX711("scale", &fakeClocked{answer: answers(0, 10, 20, 30, 40, 50)}, 128, 3)
+	var got []float64
+	for i := 0; i < 5; i++ {
+		v, err := h.Measure()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, v)
+	}
+	// the first conversion is thrown away, then the average is over the
+	// last 3
+	want := []float64{10, 15, 20, 30, 40}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestHX711TareCalibrate(t *testing.T) {
+	weight := uint32(1000)
+	line := &fakeClocked{answer: func() (uint32, bool) { return weight, true }}
+	h := NewHX711("scale", line, 128, 2)
+	if _, err := h.Tare(); gpio.CodeOf(err) != gpio.CodeUnsupported {
+		t.Errorf("tare before reading: got %v, want an Unsupported error", err)
+	}
+	if _, err := h.Measure(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Tare(); gpio.CodeOf(err) != gpio.CodeUnsupported {
+		t.Errorf("tare after one read of 2: got %v, want an Unsupported error", err)
+	}
+	if v, err := h.Measure(); err != nil || v != 1000 {
+		t.Fatalf("got %v, %v, want the raw 1000", v, err)
+	}
+	options, err := h.Tare()
+	if err != nil || options["offset"] != "1000" {
+		t.Fatalf("tare: got %v, %v", options, err)
+	}
+	if _, err := h.Calibrate(2); gpio.CodeOf(err) != gpio.CodeUnsupported {
+		t.Errorf("calibrate with nothing on: got %v, want an Unsupported error", err)
+	}
+	if _, err := h.Calibrate(0); gpio.CodeOf(err) != gpio.CodeInvalidValue {
+		t.Errorf("calibrate with 0: got %v, want an InvalidValue error", err)
+	}
+
+	weight = 1500
+	for i := 0; i < 2; i++ {
+		if _, err := h.Measure(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	options, err = h.Calibrate(2)
+	if err != nil || options["scale"] != "250" {
+		t.Fatalf("calibrate: got %v, %v", options, err)
+	}
+	weight = 2000
+	h.Measure()
+	if v, err := h.Measure(); err != nil || v != 4 {
+		t.Errorf("got %v, %v, want 4", v, err)
+	}
+
+	// a failed read starts the average over, so it must settle again
+	line.answer = nil
+	readings, err := h.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(readings) != 1 || readings[0].Id != "scale_weight" || readings[0].Quality != QualityBad {
+		t.Errorf("got %v", readings)
+	}
+	line.answer = func() (uint32, bool) { return weight, true }
+	h.Measure()
+	if _, err := h.Tare(); gpio.CodeOf(err) != gpio.CodeUnsupported {
+		t.Errorf("tare after a failed read: got %v, want an Unsupported error", err)
+	}
+	if err := h.Close(); err != nil || !line.closed {
+		t.Errorf("close: %v, closed %v", err, line.closed)
+	}
+}
+
+func TestHX711Options(t *testing.T) {
+	tests := []struct {
+		options map[string]string
+		code    gpio.ErrorCode
+	}{
+		{map[string]string{"data": "GPIO_5"}, gpio.CodeInvalidArguments},
+		{map[string]string{"data": "GPIO_5", "clock": "GPIO_5"}, gpio.CodeInvalidValue},
+		{map[string]string{"data": "GPIO_5", "clock": "GPIO_6", "gain": "16"}, gpio.CodeInvalidValue},
+		{map[string]string{"data": "GPIO_5", "clock": "GPIO_6", "samples": "0"}, gpio.CodeInvalidValue},
+		{map[string]string{"data": "GPIO_5", "clock": "GPIO_6", "scale": "0"}, gpio.CodeInvalidValue},
+		{map[string]string{"data": "GPIO_5", "clock": "GPIO_6", "offset": "x"}, gpio.CodeInvalidValue},
+		{map[string]string{"data": "GPIO_5", "clock": "GPIO_6", "speed": "1"}, gpio.CodeInvalidArguments},
+	}
+	for _, test := range tests {
+		if _, err := Open("hopper", Config{Driver: "hx711", Options: test.options}, nil); gpio.CodeOf(err) != test.code {
+			t.Errorf("%v: got %v, want a %s error", test.options, err, test.code)
+		}
+	}
+}
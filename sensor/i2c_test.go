@@ -0,0 +1,30 @@
+package sensor
+
+// fakeI2C is an I2C device holding 256 registers, which reads and writes
+// advance through like most devices.
+type fakeI2C struct {
+	regs   [256]byte
+	closed bool
+}
+
+func (f *fakeI2C) ReadReg(reg byte, data []byte) error {
+	for i := range data {
+		data[i] = f.regs[reg+byte(i)]
+	}
+	return nil
+}
+
+func (f *fakeI2C) WriteReg(reg byte, data []byte) error {
+	for i, b := range data {
+		f.regs[reg+byte(i)] = b
+	}
+	return nil
+}
+
+func (f *fakeI2C) Read(data []byte) error  { return nil }
+func (f *fakeI2C) Write(data []byte) error { return nil }
+
+func (f *fakeI2C) Close() error {
+	f.closed = true
+	return nil
+}
@@ -0,0 +1,227 @@
+package sensor
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+// KindAnalog is the kind of an ADC channel scaled to units of its own.
+const KindAnalog = "analog"
+
+func init() {
+	Register("mcp3008", func(name string, options map[string]string, pins gpio.Claimer) (Driver, error) {
+		return openMCP3x08(name, "MCP3008", 10, options)
+	})
+	Register("mcp3208", func(name string, options map[string]string, pins gpio.Claimer) (Driver, error) {
+		return openMCP3x08(name, "MCP3208", 12, options)
+	})
+}
+
+// ADCChannel is an input of an ADC, reported as sensor Id. Its voltage is
+// scaled linearly to engineering units, so that V0 volts read as Value0 and
+// V1 volts as Value1.
+type ADCChannel struct {
+	Channel    int
+	Id         string
+	Kind, Unit string
+
+	V0, V1         float64
+	Value0, Value1 float64
+}
+
+// value scales voltage v.
+func (c ADCChannel) value(v float64) float64 {
+	return c.Value0 + (v-c.V0)*(c.Value1-c.Value0)/(c.V1-c.V0)
+}
+
+// MCP3x08 reads the 8 single ended inputs of an MCP3008 (10 bit) or MCP3208
+// (12 bit) ADC over SPI. As a driver, its options are:
+//
+//	cs         chip select, 0 by default
+//	speed      clock in Hz, 1000000 by default
+//	vref       reference voltage, 3.3 by default
+//	channels   the channels to read, e.g. 0,1,5, by default those with
+//	           other options or else all of them
+//	chN.kind   kind of channel N, voltage by default
+//	chN.unit   unit of channel N, V by default
+//	chN.scale  two points v0:value0,v1:value1 scaling the voltage of
+//	           channel N, e.g. 0.5:0,4.5:10 for a 0.5-4.5V sensor of 0-10 bar
+//
+// Channel N is reported as sensor <name>_N.
+type MCP3x08 struct {
+	Model    string
+	Bits     uint
+	Vref     float64
+	Channels []ADCChannel
+
+	spi SPI
+}
+
+func openMCP3x08(name string, model string, bits uint, options map[string]string) (Driver, error) {
+	m := &MCP3x08{Model: model, Bits: bits, Vref: 3.3}
+	cs, speed := 0, 1000000
+	invalid := func(key string) error {
+		return gpio.NewError(gpio.CodeInvalidValue, "", "Invalid "+key+" for "+strings.ToLower(model)+" : "+options[key])
+	}
+	var err error
+	if v, ok := options["cs"]; ok {
+		if cs, err = strconv.Atoi(v); err != nil || cs < 0 || cs > 255 {
+			return nil, invalid("cs")
+		}
+	}
+	if v, ok := options["speed"]; ok {
+		if speed, err = strconv.Atoi(v); err != nil || speed <= 0 {
+			return nil, invalid("speed")
+		}
+	}
+	if v, ok := options["vref"]; ok {
+		if m.Vref, err = strconv.ParseFloat(v, 64); err != nil || m.Vref <= 0 {
+			return nil, invalid("vref")
+		}
+	}
+
+	// find the channels, and the options of each
+	channels := make(map[int]map[string]string)
+	for key, v := range options {
+		switch key {
+		case "cs", "speed", "vref", "channels":
+			continue
+		}
+		i := strings.Index(key, ".")
+		n := -1
+		if i > 2 && strings.HasPrefix(key, "ch") {
+			if n, err = strconv.Atoi(key[2:i]); err != nil {
+				n = -1
+			}
+		}
+		if n < 0 || n > 7 {
+			return nil, gpio.NewError(gpio.CodeInvalidArguments, "", "Unknown option "+key+" for "+strings.ToLower(model)+", must be cs, speed, vref, channels, or chN.kind, chN.unit or chN.scale for a channel N of 0-7")
+		}
+		if channels[n] == nil {
+			channels[n] = make(map[string]string)
+		}
+		channels[n][key[i+1:]] = v
+	}
+	if v, ok := options["channels"]; ok {
+		for _, field := range strings.Split(v, ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil || n < 0 || n > 7 {
+				return nil, invalid("channels")
+			}
+			if channels[n] == nil {
+				channels[n] = make(map[string]string)
+			}
+		}
+	}
+	if len(channels) == 0 {
+		for n := 0; n < 8; n++ {
+			channels[n] = make(map[string]string)
+		}
+	}
+
+	for n, opts := range channels {
+		c := ADCChannel{
+			Channel: n,
+			Id:      name + "_" + strconv.Itoa(n),
+			Kind:    KindVoltage,
+			Unit:    UnitVolt,
+			V1:      m.Vref,
+			Value1:  m.Vref,
+		}
+		if scale, ok := opts["scale"]; ok {
+			if c, err = parseScale(c, scale); err != nil {
+				return nil, err
+			}
+			c.Kind, c.Unit = KindAnalog, ""
+		}
+		for key, v := range opts {
+			switch key {
+			case "kind":
+				c.Kind = v
+			case "unit":
+				c.Unit = v
+			case "scale":
+			default:
+				return nil, gpio.NewError(gpio.CodeInvalidArguments, "", "Unknown option ch"+strconv.Itoa(n)+"."+key+" for "+strings.ToLower(model)+", must be kind, unit or scale")
+			}
+		}
+		m.Channels = append(m.Channels, c)
+	}
+	sort.Slice(m.Channels, func(i, j int) bool { return m.Channels[i].Channel < m.Channels[j].Channel })
+
+	if m.spi, err = openSPI(byte(cs), speed); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseScale sets the scaling of c from two points, "v0:value0,v1:value1".
+func parseScale(c ADCChannel, scale string) (ADCChannel, error) {
+	invalid := gpio.NewError(gpio.CodeInvalidValue, "", "Invalid scale for channel "+strconv.Itoa(c.Channel)+", must be v0:value0,v1:value1 : "+scale)
+	points := strings.Split(scale, ",")
+	if len(points) != 2 {
+		return c, invalid
+	}
+	var values [4]float64
+	for i, point := range points {
+		pair := strings.Split(point, ":")
+		if len(pair) != 2 {
+			return c, invalid
+		}
+		for j, field := range pair {
+			v, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+			if err != nil {
+				return c, invalid
+			}
+			values[i*2+j] = v
+		}
+	}
+	c.V0, c.Value0, c.V1, c.Value1 = values[0], values[1], values[2], values[3]
+	if c.V0 == c.V1 {
+		return c, invalid
+	}
+	return c, nil
+}
+
+// Sample returns the raw reading of channel n.
+func (m *MCP3x08) Sample(n int) (int, error) {
+	var data []byte
+	if m.Bits == 12 {
+		// start bit, single ended, and the channel's top bit
+		data = []byte{0x06 | byte(n>>2), byte(n&3) << 6, 0}
+	} else {
+		data = []byte{0x01, byte(0x08|n) << 4, 0}
+	}
+	if err := m.spi.Transfer(data); err != nil {
+		return 0, err
+	}
+	mask := byte(1<<(m.Bits-8) - 1)
+	return int(data[1]&mask)<<8 | int(data[2]), nil
+}
+
+// Read reads every channel.
+func (m *MCP3x08) Read() ([]Reading, error) {
+	readings := make([]Reading, 0, len(m.Channels))
+	for _, c := range m.Channels {
+		r := Reading{Id: c.Id, Model: m.Model, Kind: c.Kind, Unit: c.Unit, Quality: QualityGood}
+		raw, err := m.Sample(c.Channel)
+		if err != nil {
+			r.Quality = QualityBad
+			r.Error = "Failed to read " + c.Id + " : " + err.Error()
+		} else {
+			r.Value = c.value(float64(raw) * m.Vref / float64(int(1)<<m.Bits))
+			r.Time = time.Now()
+		}
+		readings = append(readings, r)
+	}
+	return readings, nil
+}
+
+// Close closes the SPI device.
+func (m *MCP3x08) Close() error {
+	return m.spi.Close()
+}
@@ -0,0 +1,121 @@
+package sensor
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+func TestMCP3x08Sample(t *testing.T) {
+	tests := []struct {
+		model   string
+		bits    uint
+		channel int
+		sent    []byte
+		reply   []byte
+		want    int
+	}{
+		// start bit, then single ended and the channel in the next nibble;
+		// bits above the 10 of the result are noise
+		{"MCP3008", 10, 0, []byte{0x01, 0x80, 0x00}, []byte{0xff, 0xfc, 0x00}, 0},
+		{"MCP3008", 10, 5, []byte{0x01, 0xd0, 0x00}, []byte{0xff, 0xfe, 0x9a}, 0x29a},
+		{"MCP3008", 10, 7, []byte{0x01, 0xf0, 0x00}, []byte{0x00, 0x03, 0xff}, 1023},
+		// start bit, single ended and the channel's top bit, then its low
+		// bits at the top of the next byte; 12 bit results
+		{"MCP3208", 12, 0, []byte{0x06, 0x00, 0x00}, []byte{0xff, 0xf0, 0x00}, 0},
+		{"MCP3208", 12, 5, []byte{0x07, 0x40, 0x00}, []byte{0xff, 0xea, 0xbc}, 0xabc},
+		{"MCP3208", 12, 3, []byte{0x06, 0xc0, 0x00}, []byte{0x00, 0x0f, 0xff}, 4095},
+	}
+	for _, test := range tests {
+		spi := &fakeSPI{reply: func([]byte) []byte { return test.reply }}
+		m := &MCP3x08{Model: test.model, Bits: test.bits, Vref: 3.3, spi: spi}
+		got, err := m.Sample(test.channel)
+		if err != nil {
+			t.Errorf("%s channel %d: %v", test.model, test.channel, err)
+			continue
+		}
+		if len(spi.sent) != 1 || !bytes.Equal(spi.sent[0], test.sent) {
+			t.Errorf("%s channel %d: sent % x, want % x", test.model, test.channel, spi.sent, test.sent)
+		}
+		if got != test.want {
+			t.Errorf("%s channel %d: got %d, want %d", test.model, test.channel, got, test.want)
+		}
+	}
+}
+
+func TestMCP3x08Read(t *testing.T) {
+	// channel 0 as a voltage, and channel 1 a 0.5-4.5V sensor of 0-10 bar
+	pressure, err := parseScale(ADCChannel{Channel: 1, Id: "adc_1", Kind: "pressure", Unit: "bar"}, "0.5:0,4.5:10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	channels := []ADCChannel{
+		{Channel: 0, Id: "adc_0", Kind: KindVoltage, Unit: UnitVolt, V1: 5, Value1: 5},
+		pressure,
+	}
+	spi := &fakeSPI{reply: func(sent []byte) []byte {
+		// half of vref on channel 0, and a quarter on channel 1
+		if sent[1]>>4&7 == 0 {
+			return []byte{0, 0x02, 0x00}
+		}
+		return []byte{0, 0x01, 0x00}
+	}}
+	m := &MCP3x08{Model: "MCP3008", Bits: 10, Vref: 5, Channels: channels, spi: spi}
+	readings, err := m.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{2.5, 1.875}
+	if len(readings) != len(want) {
+		t.Fatalf("got %d readings, want %d", len(readings), len(want))
+	}
+	for i, r := range readings {
+		if r.Id != channels[i].Id || r.Kind != channels[i].Kind || r.Unit != channels[i].Unit || r.Model != "MCP3008" {
+			t.Errorf("reading %d: got %s %s %s %s", i, r.Id, r.Model, r.Kind, r.Unit)
+		}
+		if r.Quality != QualityGood || math.Abs(r.Value-want[i]) > 1e-9 {
+			t.Errorf("%s: got %v %s, want %v", r.Id, r.Value, r.Quality, want[i])
+		}
+	}
+	if err := m.Close(); err != nil || !spi.closed {
+		t.Errorf("close: %v, closed %v", err, spi.closed)
+	}
+}
+
+func TestParseScale(t *testing.T) {
+	c, err := parseScale(ADCChannel{Channel: 2}, "0.5:0, 4.5:10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.value(0.5) != 0 || c.value(4.5) != 10 || c.value(2.5) != 5 {
+		t.Errorf("got %v, %v, %v for 0.5, 4.5 and 2.5V", c.value(0.5), c.value(4.5), c.value(2.5))
+	}
+	for _, scale := range []string{"", "0.5:0", "0.5:0,4.5", "0.5:0,4.5:x", "1:0,1:10", "0:0,1:1,2:2"} {
+		if _, err := parseScale(ADCChannel{Channel: 2}, scale); gpio.CodeOf(err) != gpio.CodeInvalidValue {
+			t.Errorf("scale %q: got %v, want an InvalidValue error", scale, err)
+		}
+	}
+}
+
+func TestMCP3x08Options(t *testing.T) {
+	tests := []struct {
+		options map[string]string
+		code    gpio.ErrorCode
+	}{
+		{map[string]string{"cs": "x"}, gpio.CodeInvalidValue},
+		{map[string]string{"speed": "0"}, gpio.CodeInvalidValue},
+		{map[string]string{"vref": "-1"}, gpio.CodeInvalidValue},
+		{map[string]string{"channels": "0,8"}, gpio.CodeInvalidValue},
+		{map[string]string{"ch8.kind": "pressure"}, gpio.CodeInvalidArguments},
+		{map[string]string{"ch1.colour": "red"}, gpio.CodeInvalidArguments},
+		{map[string]string{"gain": "2"}, gpio.CodeInvalidArguments},
+		{map[string]string{"ch1.scale": "1:0,1:10"}, gpio.CodeInvalidValue},
+	}
+	for _, test := range tests {
+		if _, err := openMCP3x08("adc", "MCP3008", 10, test.options); gpio.CodeOf(err) != test.code {
+			t.Errorf("%v: got %v, want a %s error", test.options, err, test.code)
+		}
+	}
+}
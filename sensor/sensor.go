@@ -0,0 +1,151 @@
+// Package sensor reads sensors that aren't GPIO pins, such as 1-Wire
+// thermometers, through pluggable drivers.
+package sensor
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+// Sensor kinds.
+const (
+	KindTemperature = "temperature"
+	KindHumidity    = "humidity"
+	KindPressure    = "pressure"
+	KindVoltage     = "voltage"
+	KindWeight      = "weight"
+)
+
+// Units.
+const (
+	UnitCelsius  = "C"
+	UnitPercent  = "%"
+	UnitPascal   = "Pa"
+	UnitVolt     = "V"
+	UnitKilogram = "kg"
+)
+
+// Quality tells whether a reading can be trusted.
+type Quality string
+
+const (
+	// QualityGood is for a value just read.
+	QualityGood Quality = "Good"
+	// QualityBad is for a sensor whose last read failed. The value, if any,
+	// is the last good one.
+	QualityBad Quality = "Bad"
+)
+
+// Reading is the state of a sensor. Time is when Value was read, and Error
+// describes why the last read failed when Quality is bad.
+type Reading struct {
+	Id      string
+	Model   string `json:",omitempty"`
+	Kind    string
+	Unit    string
+	Value   float64
+	Time    time.Time
+	Quality Quality
+	Error   string `json:",omitempty"`
+}
+
+// Driver reads the sensors of a device, or a bus of them.
+type Driver interface {
+	// Read reads every sensor. A sensor that fails is reported with a bad
+	// Quality, while an error means none could be read.
+	Read() ([]Reading, error)
+
+	// Close releases the device.
+	Close() error
+}
+
+// Scale is a Driver weighing with a load cell, which can be tared and
+// calibrated while it runs. Tare returns the offset option, and Calibrate
+// the scale option, that keep the change when the driver is opened again.
+type Scale interface {
+	Driver
+
+	// Tare makes the current weight read as zero.
+	Tare() (map[string]string, error)
+
+	// Calibrate makes the current weight, over the tare, read as weight.
+	Calibrate(weight float64) (map[string]string, error)
+}
+
+// Config declares a sensor driver to run, as saved in state and config
+// files. Options are specific to the driver, and Interval is how often it is
+// read, defaulting to the server's.
+type Config struct {
+	Driver   string
+	Interval string            `json:",omitempty"`
+	Options  map[string]string `json:",omitempty"`
+}
+
+// OpenFunc opens a driver named name with the given options. Drivers that
+// drive pins of the board directly claim them from pins, which is nil when
+// the GPIO backend's pins can't be claimed.
+type OpenFunc func(name string, options map[string]string, pins gpio.Claimer) (Driver, error)
+
+var (
+	driversMu sync.Mutex
+	drivers   = make(map[string]OpenFunc)
+)
+
+// Register makes a driver available to Open. Drivers register themselves
+// from init functions.
+func Register(driver string, open OpenFunc) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	drivers[strings.ToLower(driver)] = open
+}
+
+// Drivers returns the names of the registered drivers.
+func Drivers() []string {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open checks c and opens its driver, naming it name, claiming any pins it
+// drives directly from pins.
+func Open(name string, c Config, pins gpio.Claimer) (Driver, error) {
+	driversMu.Lock()
+	open, ok := drivers[strings.ToLower(c.Driver)]
+	driversMu.Unlock()
+	if !ok {
+		return nil, gpio.NewError(gpio.CodeNotFound, "", "Unknown sensor driver "+c.Driver+", must be one of "+strings.Join(Drivers(), ", "))
+	}
+	if c.Interval != "" {
+		if d, err := time.ParseDuration(c.Interval); err != nil || d <= 0 {
+			return nil, gpio.NewError(gpio.CodeInvalidValue, "", "Invalid interval : "+c.Interval)
+		}
+	}
+	options := c.Options
+	if options == nil {
+		options = make(map[string]string)
+	}
+	return open(name, options, pins)
+}
+
+// checkOptions verifies options only holds the given keys.
+func checkOptions(driver string, options map[string]string, keys ...string) error {
+	for key := range options {
+		known := false
+		for _, k := range keys {
+			known = known || k == key
+		}
+		if !known {
+			return gpio.NewError(gpio.CodeInvalidArguments, "", "Unknown option "+key+" for "+driver+", must be one of "+strings.Join(keys, ", "))
+		}
+	}
+	return nil
+}
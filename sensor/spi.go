@@ -0,0 +1,9 @@
+package sensor
+
+// SPI is a full duplex SPI transport to one device. Devices on the board's
+// bus 0 are opened by chip select with openSPI, clocked in mode 0.
+type SPI interface {
+	// Transfer sends data, replacing it with the bytes received meanwhile.
+	Transfer(data []byte) error
+	Close() error
+}
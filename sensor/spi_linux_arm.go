@@ -0,0 +1,51 @@
+//go:build linux && arm
+// +build linux,arm
+
+package sensor
+
+import (
+	"sync"
+
+	"github.com/kidoman/embd"
+)
+
+var (
+	// guards spiUsers, the number of devices open, as embd's SPI driver is
+	// initialised and closed once for all of them
+	spiMu    sync.Mutex
+	spiUsers int
+)
+
+// spiDevice is a device on /dev/spidev0.<cs>, driven through embd.
+type spiDevice struct {
+	bus embd.SPIBus
+}
+
+func openSPI(cs byte, speed int) (SPI, error) {
+	spiMu.Lock()
+	defer spiMu.Unlock()
+	if spiUsers == 0 {
+		if err := embd.InitSPI(); err != nil {
+			return nil, err
+		}
+	}
+	spiUsers++
+	return &spiDevice{embd.NewSPIBus(embd.SPIMode0, cs, speed, 8, 0)}, nil
+}
+
+func (d *spiDevice) Transfer(data []byte) error {
+	return d.bus.TransferAndReceiveData(data)
+}
+
+func (d *spiDevice) Close() error {
+	err := d.bus.Close()
+	spiMu.Lock()
+	defer spiMu.Unlock()
+	spiUsers--
+	if spiUsers == 0 {
+		if cerr := embd.CloseSPI(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build !linux || !arm
+// +build !linux !arm
+
+package sensor
+
+import "github.com/benjamind/gpio-json-server/gpio"
+
+func openSPI(cs byte, speed int) (SPI, error) {
+	return nil, gpio.NewError(gpio.CodeUnsupported, "", "SPI is not supported on this board")
+}
@@ -0,0 +1,31 @@
+package sensor
+
+// fakeSPI is an SPI transport recording every transfer, and answering with
+// the bytes reply returns.
+type fakeSPI struct {
+	// reply returns the bytes received for those sent, or nil to receive
+	// zeroes.
+	reply  func(sent []byte) []byte
+	sent   [][]byte
+	closed bool
+}
+
+func (f *fakeSPI) Transfer(data []byte) error {
+	f.sent = append(f.sent, append([]byte{}, data...))
+	var reply []byte
+	if f.reply != nil {
+		reply = f.reply(data)
+	}
+	for i := range data {
+		data[i] = 0
+		if i < len(reply) {
+			data[i] = reply[i]
+		}
+	}
+	return nil
+}
+
+func (f *fakeSPI) Close() error {
+	f.closed = true
+	return nil
+}
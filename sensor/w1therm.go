@@ -0,0 +1,181 @@
+package sensor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+// DefaultW1Dir is where the kernel's w1 driver lists 1-Wire devices.
+const DefaultW1Dir = "/sys/bus/w1/devices"
+
+// w1ThermFamilies are the family codes, the prefix of a 1-Wire device id,
+// of the thermometers the w1_therm driver supports.
+var w1ThermFamilies = map[string]string{
+	"10": "DS18S20",
+	"22": "DS1822",
+	"28": "DS18B20",
+	"3b": "DS1825",
+	"42": "DS28EA00",
+}
+
+func init() {
+	Register("w1therm", func(name string, options map[string]string, pins gpio.Claimer) (Driver, error) {
+		if err := checkOptions("w1therm", options, "dir"); err != nil {
+			return nil, err
+		}
+		w := &W1Therm{Dir: options["dir"]}
+		if w.Dir == "" {
+			w.Dir = DefaultW1Dir
+		}
+		return w, nil
+	})
+}
+
+// W1Therm reads 1-Wire thermometers like the DS18B20 through the w1_therm
+// kernel driver. As a Driver, it reads every thermometer on the bus, each
+// identified by its 1-Wire id. Its only option is dir, the directory devices
+// are listed in.
+type W1Therm struct {
+	// Dir is the directory devices are listed in, DefaultW1Dir on Linux.
+	Dir string
+}
+
+// Read reads every thermometer on the bus. They are discovered again on
+// every read, so they can be plugged in at any time.
+func (w *W1Therm) Read() ([]Reading, error) {
+	ids, err := w.Devices()
+	if err != nil {
+		return nil, err
+	}
+	readings := make([]Reading, 0, len(ids))
+	for _, id := range ids {
+		r := Reading{Id: id, Model: w.Model(id), Kind: KindTemperature, Unit: UnitCelsius, Quality: QualityGood}
+		if r.Value, err = w.Temperature(id); err != nil {
+			r.Quality = QualityBad
+			r.Error = err.Error()
+		} else {
+			r.Time = time.Now()
+		}
+		readings = append(readings, r)
+	}
+	return readings, nil
+}
+
+// Close does nothing, as the bus is read through files opened on each read.
+func (w *W1Therm) Close() error {
+	return nil
+}
+
+// Devices returns the ids of the thermometers on the bus, such as
+// 28-0316a2793cff.
+func (w *W1Therm) Devices() ([]string, error) {
+	entries, err := ioutil.ReadDir(w.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		id := entry.Name()
+		i := strings.Index(id, "-")
+		if i < 0 {
+			// the bus masters are listed too
+			continue
+		}
+		if _, ok := w1ThermFamilies[strings.ToLower(id[:i])]; ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// Model returns the name of the thermometer with the given id.
+func (w *W1Therm) Model(id string) string {
+	if i := strings.Index(id, "-"); i > 0 {
+		return w1ThermFamilies[strings.ToLower(id[:i])]
+	}
+	return ""
+}
+
+// Temperature returns the temperature of thermometer id in degrees Celsius.
+// Reading takes up to 750ms while the thermometer converts. Readings that
+// fail their CRC, or that come from a thermometer which has dropped off the
+// bus, are errors.
+func (w *W1Therm) Temperature(id string) (float64, error) {
+	data, err := ioutil.ReadFile(filepath.Join(w.Dir, id, "w1_slave"))
+	if os.IsNotExist(err) {
+		return 0, gpio.NewError(gpio.CodeUnknownPin, id, "No 1-Wire device "+id)
+	}
+	if err != nil {
+		return 0, gpio.NewError(gpio.CodeHardwareFailure, id, "Failed to read "+id+" : "+err.Error())
+	}
+	return parseW1Slave(id, string(data))
+}
+
+// parseW1Slave parses the w1_slave file of a thermometer, which holds the
+// scratchpad and the driver's CRC check on the first line, and the
+// temperature in thousandths of a degree on the second:
+//
+//	72 01 4b 46 7f ff 0e 10 57 : crc=57 YES
+//	72 01 4b 46 7f ff 0e 10 57 t=23125
+func parseW1Slave(id string, data string) (float64, error) {
+	invalid := gpio.NewError(gpio.CodeHardwareFailure, id, "Invalid reading from "+id+" : "+strings.TrimSpace(data))
+	lines := strings.Split(strings.TrimSpace(data), "\n")
+	if len(lines) != 2 {
+		return 0, invalid
+	}
+	if !strings.HasSuffix(strings.TrimSpace(lines[0]), "YES") {
+		return 0, gpio.NewError(gpio.CodeHardwareFailure, id, "CRC check failed reading "+id)
+	}
+
+	// check the CRC ourselves, as the driver also says YES to a device that
+	// answers with all zeroes
+	fields := strings.Fields(lines[0])
+	if len(fields) < 9 {
+		return 0, invalid
+	}
+	scratchpad := make([]byte, 9)
+	zero := true
+	for i := range scratchpad {
+		b, err := strconv.ParseUint(fields[i], 16, 8)
+		if err != nil {
+			return 0, invalid
+		}
+		scratchpad[i] = byte(b)
+		zero = zero && b == 0
+	}
+	if zero || crc8(scratchpad[:8]) != scratchpad[8] {
+		return 0, gpio.NewError(gpio.CodeHardwareFailure, id, "CRC check failed reading "+id)
+	}
+
+	i := strings.Index(lines[1], "t=")
+	if i < 0 {
+		return 0, invalid
+	}
+	milli, err := strconv.Atoi(strings.TrimSpace(lines[1][i+2:]))
+	if err != nil {
+		return 0, invalid
+	}
+	return float64(milli) / 1000, nil
+}
+
+// crc8 computes the Dallas/Maxim 1-Wire CRC of data.
+func crc8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		for i := 0; i < 8; i++ {
+			mix := (crc ^ b) & 1
+			crc >>= 1
+			if mix != 0 {
+				crc ^= 0x8c
+			}
+			b >>= 1
+		}
+	}
+	return crc
+}
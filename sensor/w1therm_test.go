@@ -0,0 +1,108 @@
+package sensor
+
+import (
+	"testing"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+func TestCRC8(t *testing.T) {
+	tests := []struct {
+		data []byte
+		crc  byte
+	}{
+		{nil, 0},
+		{[]byte{0x72, 0x01, 0x4b, 0x46, 0x7f, 0xff, 0x0e, 0x10}, 0x57},
+		{[]byte{0x90, 0xfc, 0x4b, 0x46, 0x7f, 0xff, 0x10, 0x10}, 0xee},
+		// a ROM code, whose last byte is the CRC of the others
+		{[]byte{0x02, 0x1c, 0xb8, 0x01, 0x00, 0x00, 0x00}, 0xa2},
+	}
+	for _, test := range tests {
+		if crc := crc8(test.data); crc != test.crc {
+			t.Errorf("crc8(% x) = %02x, want %02x", test.data, crc, test.crc)
+		}
+	}
+}
+
+func TestParseW1Slave(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want float64
+		ok   bool
+	}{
+		{"positive", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=23125\n", 23.125, true},
+		{"negative", "90 fc 4b 46 7f ff 10 10 ee : crc=ee YES\n90 fc 4b 46 7f ff 10 10 ee t=-55000\n", -55, true},
+		{"driver crc failed", "50 05 4b 46 7f ff 0c 10 1d : crc=1c NO\n50 05 4b 46 7f ff 0c 10 1d t=85000\n", 0, false},
+		{"all zeroes", "00 00 00 00 00 00 00 00 00 : crc=00 YES\n00 00 00 00 00 00 00 00 00 t=0\n", 0, false},
+		{"wrong crc", "72 01 4b 46 7f ff 0e 10 58 : crc=58 YES\n72 01 4b 46 7f ff 0e 10 58 t=23125\n", 0, false},
+		{"one line", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n", 0, false},
+		{"short scratchpad", "72 01 4b : crc=57 YES\n72 01 4b t=23125\n", 0, false},
+		{"no temperature", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57\n", 0, false},
+		{"bad temperature", "72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=hot\n", 0, false},
+	}
+	for _, test := range tests {
+		got, err := parseW1Slave("28-0316a2793cff", test.data)
+		if !test.ok {
+			if err == nil {
+				t.Errorf("%s: got %v, want an error", test.name, got)
+			} else if code := gpio.CodeOf(err); code != gpio.CodeHardwareFailure {
+				t.Errorf("%s: got code %s, want %s", test.name, code, gpio.CodeHardwareFailure)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("%s: got %v, %v, want %v", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestW1ThermRead(t *testing.T) {
+	w := &W1Therm{Dir: "testdata/w1"}
+	readings, err := w.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]struct {
+		model   string
+		value   float64
+		quality Quality
+	}{
+		"10-000802b4a1c2": {"DS18S20", 85, QualityGood},
+		"28-000000000000": {"DS18B20", 0, QualityBad},
+		"28-00000a1b2c3d": {"DS18B20", 0, QualityBad},
+		"28-0316a2793cff": {"DS18B20", 23.125, QualityGood},
+		"28-0417c1b5f2ff": {"DS18B20", -55, QualityGood},
+		"28-0516a0f7c1ff": {"DS18B20", 0, QualityBad},
+	}
+	if len(readings) != len(want) {
+		t.Errorf("got %d readings, want %d", len(readings), len(want))
+	}
+	for _, r := range readings {
+		w, ok := want[r.Id]
+		if !ok {
+			t.Errorf("unexpected reading of %s", r.Id)
+			continue
+		}
+		if r.Model != w.model || r.Value != w.value || r.Quality != w.quality {
+			t.Errorf("%s: got %s %v %s, want %s %v %s", r.Id, r.Model, r.Value, r.Quality, w.model, w.value, w.quality)
+		}
+		if r.Kind != KindTemperature || r.Unit != UnitCelsius {
+			t.Errorf("%s: got %s in %s, want temperature in C", r.Id, r.Kind, r.Unit)
+		}
+		if (r.Quality == QualityBad) != (r.Error != "") || (r.Quality == QualityGood) == r.Time.IsZero() {
+			t.Errorf("%s: got error %q and time %v for quality %s", r.Id, r.Error, r.Time, r.Quality)
+		}
+	}
+}
+
+func TestW1ThermRemoved(t *testing.T) {
+	w := &W1Therm{Dir: "testdata/w1"}
+	if _, err := w.Temperature("28-ffffffffffff"); gpio.CodeOf(err) != gpio.CodeUnknownPin {
+		t.Errorf("got %v, want an UnknownPin error", err)
+	}
+	w.Dir = "testdata/missing"
+	if _, err := w.Read(); err == nil {
+		t.Error("reading a missing bus succeeded")
+	}
+}
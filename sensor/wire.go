@@ -0,0 +1,18 @@
+package sensor
+
+import "time"
+
+// Wire is a GPIO pin a single-wire sensor, such as a DHT22, is bit-banged
+// through. It bypasses the GPIO backend, which can't keep up with the
+// microseconds the sensor's bits last. openWire opens a pin, given by id or
+// alias as listed in the board's pin map, as a line, which must not be
+// initialised.
+type Wire interface {
+	// Exchange drives the line low for start, then releases it to its
+	// pull-up and times the levels the sensor answers with, until the line
+	// has stayed at one level for idle. It returns how long each level
+	// lasted, starting with the high after release, which may last 0, and
+	// leaving out the idle level.
+	Exchange(start time.Duration, idle time.Duration) ([]time.Duration, error)
+	Close() error
+}
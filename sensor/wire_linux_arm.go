@@ -0,0 +1,60 @@
+//go:build linux && arm
+// +build linux,arm
+
+package sensor
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+// maxLevels bounds the levels timed in one exchange, should the line keep
+// changing.
+const maxLevels = 256
+
+// gpioWire is a single-wire line on a pin of a Raspberry Pi.
+type gpioWire struct {
+	*gpioMem
+}
+
+func openWire(pins gpio.Claimer, pinId string) (Wire, error) {
+	g, err := openGPIOMem(pins, pinId, "Single-wire sensors")
+	if err != nil {
+		return nil, err
+	}
+	return gpioWire{g}, nil
+}
+
+func (w gpioWire) Exchange(start time.Duration, idle time.Duration) ([]time.Duration, error) {
+	// stay on one thread while polling, to be interrupted as little as
+	// possible
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	w.set(false)
+	w.setOutput(true)
+	time.Sleep(start)
+	w.setOutput(false)
+
+	levels := make([]time.Duration, 0, 96)
+	level := uint32(1)
+	since := time.Now()
+	for len(levels) < maxLevels {
+		now := time.Now()
+		if w.level() != level {
+			levels = append(levels, now.Sub(since))
+			level ^= 1
+			since = now
+		} else if now.Sub(since) >= idle {
+			break
+		}
+	}
+	return levels, nil
+}
+
+// Close leaves the pin an input, and unmaps the registers.
+func (w gpioWire) Close() error {
+	return w.close()
+}
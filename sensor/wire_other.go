@@ -0,0 +1,10 @@
+//go:build !linux || !arm
+// +build !linux !arm
+
+package sensor
+
+import "github.com/benjamind/gpio-json-server/gpio"
+
+func openWire(pins gpio.Claimer, pinId string) (Wire, error) {
+	return nil, gpio.NewError(gpio.CodeUnsupported, pinId, "Single-wire sensors are not supported on this board")
+}
@@ -0,0 +1,25 @@
+package sensor
+
+import "time"
+
+// fakeWire is a Wire answering every exchange with the levels answer
+// returns.
+type fakeWire struct {
+	// answer returns the levels of the next answer, or nil for none.
+	answer    func() []time.Duration
+	exchanges int
+	closed    bool
+}
+
+func (f *fakeWire) Exchange(start time.Duration, idle time.Duration) ([]time.Duration, error) {
+	f.exchanges++
+	if f.answer == nil {
+		return nil, nil
+	}
+	return f.answer(), nil
+}
+
+func (f *fakeWire) Close() error {
+	f.closed = true
+	return nil
+}
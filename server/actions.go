@@ -0,0 +1,210 @@
+package server
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+)
+
+// actionUsage describes the actions commands accept.
+const actionUsage = "setpin <pin> <value>, pulse <pin> <duration> [value], fade <pin> <duration> <value> or scene <scene>"
+
+// fadeStep is how often a fading pin is updated.
+const fadeStep = 50 * time.Millisecond
+
+// isAction reports whether arg names an action.
+func isAction(arg string) bool {
+	switch strings.ToLower(arg) {
+	case protocol.ActionSetPin, protocol.ActionPulse, protocol.ActionFade, protocol.ActionScene:
+		return true
+	}
+	return false
+}
+
+// parseAction parses an action given to a command, e.g. "pulse pump 5s".
+// It must only be called from the hub goroutine.
+func (h *hub) parseAction(args []string) (protocol.Action, error) {
+	usage := gpio.NewError(gpio.CodeInvalidArguments, "", "Action must be "+actionUsage)
+	if len(args) == 0 {
+		return protocol.Action{}, usage
+	}
+	a := protocol.Action{Type: strings.ToLower(args[0])}
+	args = args[1:]
+	switch a.Type {
+	case protocol.ActionSetPin, protocol.ActionPulse, protocol.ActionFade:
+		switch {
+		case a.Type == protocol.ActionSetPin && len(args) != 2,
+			a.Type == protocol.ActionPulse && (len(args) < 2 || len(args) > 3),
+			a.Type == protocol.ActionFade && len(args) != 3:
+			return a, usage
+		}
+		pin, err := h.resolvePin(args[0])
+		if err != nil {
+			return a, err
+		}
+		a.Pin = pin
+		valueStr := args[len(args)-1]
+		if a.Type != protocol.ActionSetPin {
+			a.Duration = args[1]
+		}
+		if a.Type == protocol.ActionPulse && len(args) == 2 {
+			valueStr = "1"
+		}
+		if a.Value, err = parseValue(valueStr); err != nil {
+			return a, withPin(err, pin)
+		}
+	case protocol.ActionScene:
+		if len(args) != 1 {
+			return a, usage
+		}
+		if _, ok := h.scenes[args[0]]; !ok {
+			return a, gpio.NewError(gpio.CodeNotFound, "", "Unknown scene "+args[0])
+		}
+		a.Scene = args[0]
+	default:
+		return a, usage
+	}
+	return a, checkAction(a)
+}
+
+// checkAction verifies an action, which may come from a config file, can be
+// run.
+func checkAction(a protocol.Action) error {
+	switch a.Type {
+	case protocol.ActionSetPin:
+		return nil
+	case protocol.ActionPulse, protocol.ActionFade:
+		if d, err := time.ParseDuration(a.Duration); err != nil || d <= 0 {
+			return gpio.NewError(gpio.CodeInvalidValue, a.Pin, "Invalid "+a.Type+" duration : "+a.Duration)
+		}
+		return nil
+	case protocol.ActionScene:
+		return nil
+	}
+	return gpio.NewError(gpio.CodeInvalidValue, "", "Unknown action "+a.Type+", must be "+actionUsage)
+}
+
+// runAction runs a, reporting failures against command cmd. It must only be
+// called from the hub goroutine.
+func (h *hub) runAction(cmd string, a protocol.Action) error {
+	switch a.Type {
+	case protocol.ActionSetPin:
+		pin, err := h.resolvePin(a.Pin)
+		if err != nil {
+			return err
+		}
+		return withPin(h.gpio.PinSet(pin, a.Value), pin)
+	case protocol.ActionPulse, protocol.ActionFade:
+		pin, err := h.resolvePin(a.Pin)
+		if err != nil {
+			return err
+		}
+		d, err := time.ParseDuration(a.Duration)
+		if err != nil {
+			return gpio.NewError(gpio.CodeInvalidValue, pin, "Invalid "+a.Type+" duration : "+a.Duration)
+		}
+		pinStates, err := h.gpio.PinStates()
+		if err != nil {
+			return err
+		}
+		ps, ok := pinStates[pin]
+		if !ok {
+			return gpio.NewError(gpio.CodeUnknownPin, pin, "Pin "+pin+" is not initialised")
+		}
+		if a.Type == protocol.ActionFade {
+			return h.fade(cmd, pin, ps.State, a.Value, d)
+		}
+		return h.pulse(cmd, pin, ps.State, a.Value, d)
+	case protocol.ActionScene:
+		return h.applyScene(protocol.CmdApplyScene, a.Scene)
+	}
+	return checkAction(a)
+}
+
+// pulse is a pulse running on a pin at value, which is set back to prev
+// once it ends.
+type pulse struct {
+	prev  byte
+	value byte
+	timer *time.Timer
+}
+
+// pulse sets pin to value for d, then back to the value it had before, from
+// state. A pulse started while another runs on the same pin extends it, and
+// still ends at the value from before the first. Like a fade, the pin is
+// left alone if anything else changes it meanwhile. It must only be called
+// from the hub goroutine.
+func (h *hub) pulse(cmd string, pin string, state byte, value byte, d time.Duration) error {
+	if err := h.gpio.PinSet(pin, value); err != nil {
+		return withPin(err, pin)
+	}
+	p := &pulse{prev: state, value: value}
+	if running, ok := h.pulses[pin]; ok {
+		running.timer.Stop()
+		p.prev = running.prev
+	}
+	h.pulses[pin] = p
+	p.timer = h.after(d, func() {
+		if h.pulses[pin] != p {
+			// replaced by a later pulse, which ends it
+			return
+		}
+		delete(h.pulses, pin)
+		pinStates, err := h.gpio.PinStates()
+		if ps, ok := pinStates[pin]; err != nil || !ok || ps.State != p.value {
+			// changed by someone else, or removed
+			return
+		}
+		if err := h.gpio.PinSet(pin, p.prev); err != nil {
+			log.Println("Failed to end pulse on " + pin + " : " + err.Error())
+			go h.sendErr(cmd, withPin(err, pin))
+		}
+	})
+	return nil
+}
+
+// fade ramps pin from one value to another over d, in steps of fadeStep.
+// The fade stops early if anything else changes the pin meanwhile. It must
+// only be called from the hub goroutine.
+func (h *hub) fade(cmd string, pin string, from, to byte, d time.Duration) error {
+	steps := int(d / fadeStep)
+	if steps < 1 {
+		steps = 1
+	}
+	last := from
+	var step func(i int) error
+	step = func(i int) error {
+		if pinStates, err := h.gpio.PinStates(); err != nil || pinStates[pin].State != last {
+			// changed by someone else, or removed
+			return nil
+		}
+		last = byte(int(from) + (int(to)-int(from))*i/steps)
+		if err := h.gpio.PinSet(pin, last); err != nil {
+			return withPin(err, pin)
+		}
+		if i < steps {
+			h.after(fadeStep, func() {
+				if err := step(i + 1); err != nil {
+					log.Println("Failed to fade " + pin + " : " + err.Error())
+					go h.sendErr(cmd, err)
+				}
+			})
+		}
+		return nil
+	}
+	return step(1)
+}
+
+// after runs f on the hub goroutine once d has passed, unless the hub has
+// stopped by then.
+func (h *hub) after(d time.Duration, f func()) *time.Timer {
+	return time.AfterFunc(d, func() {
+		select {
+		case h.deferred <- f:
+		case <-h.done:
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+// newTestHub returns a hub, not running, driving a fake board with pins
+// initialised as outputs.
+func newTestHub(t *testing.T, pins ...string) (*hub, *gpio.GPIO) {
+	t.Helper()
+	g := &gpio.GPIO{}
+	g.Init(make(chan gpio.PinState, 100), make(chan gpio.PinState, 100), make(chan string, 100), map[string]gpio.PinState{})
+	t.Cleanup(func() { g.Close() })
+	for _, pin := range pins {
+		if err := g.PinInit(pin, gpio.Out, gpio.Pull_None, pin); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return newHub(g), g
+}
+
+// pinState returns the state of pin on g.
+func pinState(g *gpio.GPIO, pin string) byte {
+	states, _ := g.PinStates()
+	return states[pin].State
+}
+
+// runDeferred runs the next function the hub was given to run later.
+func runDeferred(t *testing.T, h *hub) {
+	t.Helper()
+	select {
+	case f := <-h.deferred:
+		f()
+	case <-time.After(time.Second):
+		t.Fatal("nothing was run later")
+	}
+}
+
+func TestPulse(t *testing.T) {
+	tests := []struct {
+		name string
+		// run while the pulse is on
+		during func(h *hub, g *gpio.GPIO)
+		want   byte
+	}{
+		{"ends", func(h *hub, g *gpio.GPIO) {}, 10},
+		{"set meanwhile", func(h *hub, g *gpio.GPIO) { g.PinSet("P8_07", 50) }, 50},
+		{"set back meanwhile", func(h *hub, g *gpio.GPIO) { g.PinSet("P8_07", 10) }, 10},
+		{"removed meanwhile", func(h *hub, g *gpio.GPIO) { g.PinRemove("P8_07") }, 0},
+	}
+	for _, test := range tests {
+		h, g := newTestHub(t)
+		g.PinInit("P8_07", gpio.PWM, gpio.Pull_None, "P8_07")
+		g.PinSet("P8_07", 10)
+		if err := h.pulse("pulse", "P8_07", 10, 200, time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		if got := pinState(g, "P8_07"); got != 200 {
+			t.Fatalf("%s: pulsed to %d, want 200", test.name, got)
+		}
+		test.during(h, g)
+		runDeferred(t, h)
+		if got := pinState(g, "P8_07"); got != test.want {
+			t.Errorf("%s: ended at %d, want %d", test.name, got, test.want)
+		}
+		if len(h.pulses) != 0 {
+			t.Errorf("%s: %d pulses left running", test.name, len(h.pulses))
+		}
+	}
+}
+
+func TestPulseExtended(t *testing.T) {
+	h, g := newTestHub(t, "P8_07")
+	if err := h.pulse("pulse", "P8_07", 0, 1, time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	// a second pulse while the first runs ends at the value from before both
+	if err := h.pulse("pulse", "P8_07", 1, 1, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	runDeferred(t, h)
+	if got := pinState(g, "P8_07"); got != 0 {
+		t.Errorf("ended at %d, want 0", got)
+	}
+	select {
+	case <-h.deferred:
+		t.Error("the first pulse still ended")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
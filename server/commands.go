@@ -0,0 +1,458 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+)
+
+// command is a command clients can send: its schema, and the handler run on
+// the hub goroutine with the arguments that followed the command name.
+type command struct {
+	protocol.CommandSchema
+	run func(h *hub, c *connection, args []string) error
+}
+
+var (
+	commands       []*command
+	commandsByName = make(map[string]*command)
+)
+
+// registerCommand adds a command to the registry checkCmd dispatches
+// through. Commands are advertised in the order they are registered.
+func registerCommand(cmd *command) {
+	commands = append(commands, cmd)
+	commandsByName[cmd.Name] = cmd
+}
+
+// commandSchema returns the schema of every registered command.
+func commandSchema() []protocol.CommandSchema {
+	schema := make([]protocol.CommandSchema, len(commands))
+	for i, cmd := range commands {
+		schema[i] = cmd.CommandSchema
+	}
+	return schema
+}
+
+// checkArgs verifies args has as many values as the command requires, and
+// no more than it accepts.
+func (cmd *command) checkArgs(args []string) error {
+	required := 0
+	variadic := false
+	for _, arg := range cmd.Args {
+		if !arg.Optional {
+			required++
+		}
+		variadic = variadic || arg.Variadic
+	}
+	if len(args) < required || (!variadic && len(args) > len(cmd.Args)) {
+		return gpio.NewError(gpio.CodeInvalidArguments, "", "Usage: "+cmd.Usage())
+	}
+	return nil
+}
+
+func (s *Server) commandsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(commandSchema()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+var (
+	pinArg = protocol.ArgSchema{
+		Name:        "pin",
+		Type:        protocol.ArgPin,
+		Description: "Pin id or alias, as listed in the pin map, or the name of an initialised pin",
+	}
+	valueArg = protocol.ArgSchema{
+		Name:        "value",
+		Type:        protocol.ArgValue,
+		Description: "0 or low, 1 or high, 0-255 for PWM pins, or an angle of 0-180 for servos",
+		Min:         intPtr(0),
+		Max:         intPtr(255),
+	}
+)
+
+func init() {
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdGetHost,
+			Description: "Reply with the name of the board the server runs on",
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			hostname, err := h.gpio.Host()
+			if err != nil {
+				return err
+			}
+			go h.sendMsg(protocol.TypeHost, hostname)
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdGetPinMap,
+			Description: "Reply with every pin the board provides",
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			pinMap, err := h.gpio.PinMap()
+			if err != nil {
+				return err
+			}
+			go h.sendMsg(protocol.TypePinMap, pinMap)
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdGetPinStates,
+			Description: "Reply with the state of every initialised pin",
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			pinStates, err := h.gpio.PinStates()
+			if err != nil {
+				return err
+			}
+			go h.sendMsg(protocol.TypePinStates, pinStates)
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdInitPin,
+			Description: "Initialise a pin, or reconfigure one already initialised",
+			Args: []protocol.ArgSchema{
+				pinArg,
+				{
+					Name:        "dir",
+					Type:        protocol.ArgEnum,
+					Description: "Pin direction",
+					Enum:        []string{"in", "out", "pwm", "servo", "analog", "counter", "encoder"},
+				},
+				{
+					Name:        "pullup",
+					Type:        protocol.ArgEnum,
+					Description: "Pull resistor, emulated with an initial state where unsupported",
+					Enum:        []string{"none", "up", "down"},
+				},
+				{
+					Name:        "name",
+					Type:        protocol.ArgString,
+					Description: "Display name, defaults to the pin id",
+					Optional:    true,
+				},
+			},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : initpin pinId dir pullup [name]
+			pin := args[0]
+			if pinId, err := h.resolvePin(pin); err == nil {
+				pin = pinId
+			}
+			name := pin
+			if len(args) > 3 {
+				name = args[3]
+			}
+			dir, err := parseDirection(args[1])
+			if err != nil {
+				return withPin(err, pin)
+			}
+			if err := h.checkPinName(pin, name); err != nil {
+				return err
+			}
+			return h.gpio.PinInit(pin, dir, parsePullUp(args[2]), name)
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdSetPin,
+			Description: "Set the state of an output or PWM pin",
+			Args:        []protocol.ArgSchema{pinArg, valueArg},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : setpin pinId high/low/1/0
+			pin, err := h.resolvePin(args[0])
+			if err != nil {
+				return err
+			}
+			state, err := parseValue(args[1])
+			if err != nil {
+				return withPin(err, pin)
+			}
+			return h.gpio.PinSet(pin, state)
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdSetSampling,
+			Description: "Set how often an analog pin is read, how many readings are averaged, and by how much the average must change to be reported",
+			Args: []protocol.ArgSchema{
+				pinArg,
+				{
+					Name:        "interval",
+					Type:        protocol.ArgString,
+					Description: "Time between readings",
+					Default:     gpio.DefaultAnalogInterval.String(),
+					Optional:    true,
+				},
+				{
+					Name:        "samples",
+					Type:        protocol.ArgInt,
+					Description: "Number of readings averaged",
+					Min:         intPtr(1),
+					Default:     strconv.Itoa(gpio.DefaultAnalogSamples),
+					Optional:    true,
+				},
+				{
+					Name:        "threshold",
+					Type:        protocol.ArgInt,
+					Description: "Smallest change reported, in raw units",
+					Min:         intPtr(1),
+					Default:     strconv.Itoa(gpio.DefaultAnalogThreshold),
+					Optional:    true,
+				},
+			},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : setsampling pinId [interval] [samples] [threshold]
+			pin, err := h.resolvePin(args[0])
+			if err != nil {
+				return err
+			}
+			var config gpio.AnalogConfig
+			if len(args) > 1 {
+				config.Interval = args[1]
+			}
+			for i, field := range []*int{&config.Samples, &config.Threshold} {
+				if len(args) <= i+2 {
+					break
+				}
+				if *field, err = strconv.Atoi(args[i+2]); err != nil || *field < 1 {
+					return gpio.NewError(gpio.CodeInvalidValue, pin, "Invalid "+args[i+2]+", samples and threshold must be at least 1")
+				}
+			}
+			return h.gpio.PinSetSampling(pin, config)
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdSetCounter,
+			Description: "Set how often a counter or encoder pin reports its count and rate, its pulses per revolution, and an encoder's B pin",
+			Args: []protocol.ArgSchema{
+				pinArg,
+				{
+					Name:        "interval",
+					Type:        protocol.ArgString,
+					Description: "Time between reports",
+					Default:     gpio.DefaultCounterInterval.String(),
+					Optional:    true,
+				},
+				{
+					Name:        "pulses",
+					Type:        protocol.ArgInt,
+					Description: "Pulses per revolution, for the RPM",
+					Min:         intPtr(1),
+					Default:     strconv.Itoa(gpio.DefaultPulsesPerRev),
+					Optional:    true,
+				},
+				{
+					Name:        "pinb",
+					Type:        protocol.ArgPin,
+					Description: "B pin of an encoder, which must not be initialised",
+					Optional:    true,
+				},
+			},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : setcounter pinId [interval] [pulses] [pinb]
+			pin, err := h.resolvePin(args[0])
+			if err != nil {
+				return err
+			}
+			var config gpio.CounterConfig
+			if len(args) > 1 {
+				config.Interval = args[1]
+			}
+			if len(args) > 2 {
+				if config.PulsesPerRev, err = strconv.Atoi(args[2]); err != nil || config.PulsesPerRev < 1 {
+					return gpio.NewError(gpio.CodeInvalidValue, pin, "Invalid pulses per revolution, must be at least 1 : "+args[2])
+				}
+			}
+			if len(args) > 3 {
+				if config.PinB, err = h.resolvePin(args[3]); err != nil {
+					return err
+				}
+			}
+			return h.gpio.PinSetCounter(pin, config)
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdResetCounter,
+			Description: "Set the count of a counter or encoder pin back to zero",
+			Args:        []protocol.ArgSchema{pinArg},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : resetcounter pinId
+			pin, err := h.resolvePin(args[0])
+			if err != nil {
+				return err
+			}
+			return h.gpio.PinResetCounter(pin)
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdRemovePin,
+			Description: "Release a pin",
+			Args:        []protocol.ArgSchema{pinArg},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : removepin pinId
+			pin, err := h.resolvePin(args[0])
+			if err != nil {
+				return err
+			}
+			return h.gpio.PinRemove(pin)
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdGetPin,
+			Description: "Reply with the state of one initialised pin",
+			Args:        []protocol.ArgSchema{pinArg},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : getpin pinId
+			pin, err := h.resolvePin(args[0])
+			if err != nil {
+				return err
+			}
+			pinStates, err := h.gpio.PinStates()
+			if err != nil {
+				return err
+			}
+			pinState, ok := pinStates[pin]
+			if !ok {
+				return gpio.NewError(gpio.CodeUnknownPin, pin, "Pin "+pin+" is not initialised")
+			}
+			go h.sendMsg(protocol.TypePin, pinState)
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdSubscribe,
+			Description: "Only receive pin events matching the given filters, added to any given before",
+			Args: []protocol.ArgSchema{{
+				Name:        "filter",
+				Type:        protocol.ArgString,
+				Description: "Pin id, name glob or event type, optionally prefixed with pin:, name: or type:",
+				Variadic:    true,
+			}},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : subscribe [pin:|name:|type:]filter ...
+			if c.sub == nil {
+				c.sub = newSubscription()
+			}
+			for _, arg := range args {
+				c.sub.add(h.canonicalFilter(parseFilter(arg)))
+			}
+			h.sendTo(c, protocol.TypeSubscriptions, c.sub.info())
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdUnsubscribe,
+			Description: "Remove subscription filters, or all of them if none are given",
+			Args: []protocol.ArgSchema{{
+				Name:        "filter",
+				Type:        protocol.ArgString,
+				Description: "A filter previously given to subscribe",
+				Optional:    true,
+				Variadic:    true,
+			}},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : unsubscribe [filter ...], with no filters removes them all
+			if len(args) == 0 || c.sub == nil {
+				c.sub = nil
+			} else {
+				for _, arg := range args {
+					c.sub.remove(h.canonicalFilter(parseFilter(arg)))
+				}
+				if c.sub.empty() {
+					c.sub = nil
+				}
+			}
+			info := newSubscription().info()
+			if c.sub != nil {
+				info = c.sub.info()
+			}
+			h.sendTo(c, protocol.TypeSubscriptions, info)
+			return nil
+		},
+	})
+}
+
+// withPin records the pin a coded error concerns.
+func withPin(err error, pinId string) error {
+	if e, ok := err.(*gpio.Error); ok && e.PinId == "" {
+		e.PinId = pinId
+	}
+	return err
+}
+
+func parseDirection(dirStr string) (gpio.Direction, error) {
+	switch strings.ToLower(dirStr) {
+	case "1", "out", "output":
+		return gpio.Out, nil
+	case "0", "in", "input":
+		return gpio.In, nil
+	case "pwm":
+		return gpio.PWM, nil
+	case "servo":
+		return gpio.Servo, nil
+	case "analog", "ain":
+		return gpio.Analog, nil
+	case "counter":
+		return gpio.Counter, nil
+	case "encoder":
+		return gpio.Encoder, nil
+	}
+	return gpio.In, gpio.NewError(gpio.CodeInvalidValue, "", "Invalid direction, must be in, out, pwm, servo, analog, counter or encoder : "+dirStr)
+}
+
+func parsePullUp(pullStr string) gpio.PullUp {
+	switch strings.ToLower(pullStr) {
+	case "1", "up":
+		return gpio.Pull_Up
+	case "0", "down":
+		return gpio.Pull_Down
+	}
+	return gpio.Pull_None
+}
+
+func parseValue(stateStr string) (byte, error) {
+	switch strings.ToLower(stateStr) {
+	case "1", "high":
+		return 1, nil
+	case "0", "low":
+		return 0, nil
+	}
+	// assume its a pwm value...if it converts to integer in 0-255 range
+	s, err := strconv.Atoi(stateStr)
+	if err != nil || s < 0 || s > 255 {
+		return 0, gpio.NewError(gpio.CodeInvalidValue, "", "Invalid value, must be between 0 and 255 : "+stateStr)
+	}
+	return byte(s), nil
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+)
+
+func TestCheckArgs(t *testing.T) {
+	pin := protocol.ArgSchema{Name: "pin", Type: protocol.ArgPin}
+	optional := protocol.ArgSchema{Name: "value", Type: protocol.ArgValue, Optional: true}
+	variadic := protocol.ArgSchema{Name: "pins", Type: protocol.ArgPin, Optional: true, Variadic: true}
+	tests := []struct {
+		args []protocol.ArgSchema
+		n    int
+		ok   bool
+	}{
+		{nil, 0, true},
+		{nil, 1, false},
+		{[]protocol.ArgSchema{pin}, 0, false},
+		{[]protocol.ArgSchema{pin}, 1, true},
+		{[]protocol.ArgSchema{pin}, 2, false},
+		{[]protocol.ArgSchema{pin, optional}, 1, true},
+		{[]protocol.ArgSchema{pin, optional}, 2, true},
+		{[]protocol.ArgSchema{pin, optional}, 3, false},
+		{[]protocol.ArgSchema{pin, variadic}, 0, false},
+		{[]protocol.ArgSchema{pin, variadic}, 1, true},
+		{[]protocol.ArgSchema{pin, variadic}, 5, true},
+	}
+	for _, test := range tests {
+		cmd := &command{CommandSchema: protocol.CommandSchema{Name: "test", Args: test.args}}
+		err := cmd.checkArgs(make([]string, test.n))
+		if (err == nil) != test.ok {
+			t.Errorf("%s with %d args: got %v, want ok %v", cmd.Usage(), test.n, err, test.ok)
+		}
+		if err != nil && gpio.CodeOf(err) != gpio.CodeInvalidArguments {
+			t.Errorf("%s with %d args: got code %s, want %s", cmd.Usage(), test.n, gpio.CodeOf(err), gpio.CodeInvalidArguments)
+		}
+	}
+}
+
+// TestCommandSchema checks the schema every command publishes is one
+// clients can build forms from.
+func TestCommandSchema(t *testing.T) {
+	for _, cmd := range commands {
+		if commandsByName[cmd.Name] != cmd {
+			t.Errorf("%s: registered twice", cmd.Name)
+		}
+		if cmd.Description == "" {
+			t.Errorf("%s: no description", cmd.Name)
+		}
+		for i, arg := range cmd.Args {
+			last := i == len(cmd.Args)-1
+			switch {
+			case arg.Name == "" || arg.Type == "":
+				t.Errorf("%s: argument %d has no name or type", cmd.Name, i)
+			case arg.Variadic && !last:
+				t.Errorf("%s: variadic argument %s isn't last", cmd.Name, arg.Name)
+			case arg.Type == protocol.ArgJSON && !last:
+				t.Errorf("%s: JSON argument %s isn't last", cmd.Name, arg.Name)
+			case arg.Type == protocol.ArgEnum && len(arg.Enum) == 0:
+				t.Errorf("%s: enum argument %s has no values", cmd.Name, arg.Name)
+			case arg.Optional && !last && !cmd.Args[i+1].Optional:
+				t.Errorf("%s: optional argument %s comes before a required one", cmd.Name, arg.Name)
+			}
+		}
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		code gpio.ErrorCode
+	}{
+		{"frobnicate P8_07", gpio.CodeUnknownCommand},
+		{"setpin", gpio.CodeInvalidArguments},
+		{"setpin P8_07 1 2", gpio.CodeInvalidArguments},
+		{"initpin P8_07 sideways", gpio.CodeInvalidArguments},
+		{"setpin P8_07 lots", gpio.CodeInvalidValue},
+		{"setpin P9_99 1", gpio.CodeUnknownPin},
+	}
+	for _, test := range tests {
+		h, _ := newTestHub(t, "P8_07")
+		h.checkCmd(nil, []byte(test.cmd))
+		select {
+		case e := <-h.broadcastSys:
+			err, ok := e.payload.(protocol.Error)
+			if e.Type != protocol.TypeError || !ok {
+				t.Errorf("%s: got a %s, want an error", test.cmd, e.Type)
+			} else if err.Code != test.code {
+				t.Errorf("%s: got %s (%s), want %s", test.cmd, err.Code, err.Message, test.code)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%s: no error sent", test.cmd)
+		}
+	}
+}
+
+func TestSetSampling(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want gpio.AnalogConfig
+		code gpio.ErrorCode
+	}{
+		{"setsampling level", gpio.AnalogConfig{}, ""},
+		{"setsampling level 250ms", gpio.AnalogConfig{Interval: "250ms"}, ""},
+		{"setsampling P8_08 1s 8 20", gpio.AnalogConfig{Interval: "1s", Samples: 8, Threshold: 20}, ""},
+		{"setsampling level 1s 0", gpio.AnalogConfig{}, gpio.CodeInvalidValue},
+		{"setsampling level 1s 8 -5", gpio.AnalogConfig{}, gpio.CodeInvalidValue},
+		{"setsampling level 1s many", gpio.AnalogConfig{}, gpio.CodeInvalidValue},
+		{"setsampling level soon", gpio.AnalogConfig{}, gpio.CodeInvalidValue},
+		{"setsampling level 100us", gpio.AnalogConfig{}, gpio.CodeInvalidValue},
+		{"setsampling P8_07", gpio.AnalogConfig{}, gpio.CodeUnsupported},
+		{"setsampling P8_09", gpio.AnalogConfig{}, gpio.CodeUnknownPin},
+	}
+	for _, test := range tests {
+		h, g := newTestHub(t, "P8_07")
+		if err := g.PinInit("P8_08", gpio.Analog, gpio.Pull_None, "level"); err != nil {
+			t.Fatal(err)
+		}
+		if test.code != "" {
+			e := runCmd(t, h, test.cmd)
+			if err, ok := e.payload.(protocol.Error); !ok || err.Code != test.code {
+				t.Errorf("%s: got %s %v, want a %s error", test.cmd, e.Type, e.payload, test.code)
+			}
+			continue
+		}
+		h.checkCmd(nil, []byte(test.cmd))
+		states, _ := g.PinStates()
+		if got := states["P8_08"].Analog; got == nil || *got != test.want {
+			t.Errorf("%s: got sampling %+v, want %+v", test.cmd, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Supports Windows, Linux, Mac, and Raspberry Pi
+
+package server
+
+import (
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// connConfig holds the keepalive and limit settings of a connection.
+type connConfig struct {
+	pingInterval   time.Duration
+	pongWait       time.Duration
+	writeTimeout   time.Duration
+	maxMessageSize int64
+}
+
+type connection struct {
+	// The hub the connection is registered with.
+	h *hub
+
+	// The websocket connection.
+	ws *websocket.Conn
+
+	// Buffered channel of outbound messages.
+	send chan []byte
+
+	// When set before send is closed, the writer finishes with a close frame
+	// carrying this reason.
+	closeReason string
+
+	// Messages that didn't fit in send, oldest first. Only touched by the hub
+	// goroutine.
+	backlog []*event
+
+	// Non-zero while backlog isn't empty, so the writer knows to tell the hub
+	// when it has room.
+	backlogged int32
+
+	// Filters applied to pin events, nil to receive all of them. Only
+	// touched by the hub goroutine.
+	sub *subscription
+
+	cfg connConfig
+}
+
+func (c *connection) reader() {
+	c.ws.SetReadLimit(c.cfg.maxMessageSize)
+	c.ws.SetReadDeadline(time.Now().Add(c.cfg.pongWait))
+	c.ws.SetPongHandler(func(string) error {
+		c.ws.SetReadDeadline(time.Now().Add(c.cfg.pongWait))
+		return nil
+	})
+	for {
+		_, message, err := c.ws.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Println("Websocket read failed : " + err.Error())
+			}
+			break
+		}
+		c.ws.SetReadDeadline(time.Now().Add(c.cfg.pongWait))
+
+		select {
+		case c.h.broadcast <- &inbound{c, message}:
+		case <-c.h.done:
+		}
+	}
+	c.ws.Close()
+}
+
+func (c *connection) writer() {
+	ticker := time.NewTicker(c.cfg.pingInterval)
+	defer func() {
+		ticker.Stop()
+		c.ws.Close()
+		c.h.writers.Done()
+	}()
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.ws.SetWriteDeadline(time.Now().Add(c.cfg.writeTimeout))
+			if !ok {
+				if c.closeReason != "" {
+					msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, c.closeReason)
+					c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(c.cfg.writeTimeout))
+				}
+				return
+			}
+			if err := c.ws.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+			if len(c.send) == 0 && atomic.LoadInt32(&c.backlogged) != 0 {
+				c.h.wake(c)
+			}
+		case <-ticker.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.cfg.writeTimeout)); err != nil {
+				return
+			}
+			if atomic.LoadInt32(&c.backlogged) != 0 {
+				c.h.wake(c)
+			}
+		}
+	}
+}
+
+func (s *Server) wsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Print("Started a new websocket handler")
+	ws, err := websocket.Upgrade(w, r, nil, 1024, 1024)
+	if _, ok := err.(websocket.HandshakeError); ok {
+		http.Error(w, "Not a websocket handshake", 400)
+		return
+	} else if err != nil {
+		return
+	}
+	c := &connection{h: s.hub, send: make(chan []byte, 256), ws: ws, cfg: connConfig{
+		pingInterval:   s.PingInterval,
+		pongWait:       s.PongWait,
+		writeTimeout:   s.WriteTimeout,
+		maxMessageSize: s.MaxMessageSize,
+	}}
+	select {
+	case s.hub.register <- c:
+	case <-s.hub.done:
+		// the server has shut down
+		msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, s.hub.closeReason)
+		ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(s.WriteTimeout))
+		ws.Close()
+		return
+	}
+	defer func() {
+		select {
+		case s.hub.unregister <- c:
+		case <-s.hub.done:
+		}
+	}()
+	go c.writer()
+	c.reader()
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+// schedule decides when a job runs.
+type schedule interface {
+	// next returns the first time after t the job runs, or the zero time
+	// if it never does.
+	next(t time.Time) time.Time
+}
+
+// interval runs a job at a fixed interval.
+type interval time.Duration
+
+func (d interval) next(t time.Time) time.Time {
+	return t.Add(time.Duration(d))
+}
+
+// cronSchedule runs a job at the minutes matching a cron expression. Each
+// field is a bit set of the values it matches.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// Set when the day of month or week field starts with *, like * or */2.
+	// If neither does, a day matching either field matches, as in cron.
+	domStar, dowStar bool
+}
+
+// cronDescriptors are the shorthands accepted in place of a cron expression.
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseSchedule parses a cron expression, descriptor or "@every <duration>".
+func parseSchedule(spec string) (schedule, error) {
+	fields := strings.Fields(strings.ToLower(spec))
+	if len(fields) == 2 && fields[0] == "@every" {
+		d, err := time.ParseDuration(fields[1])
+		if err != nil || d < time.Second {
+			return nil, gpio.NewError(gpio.CodeInvalidValue, "", "Invalid interval, must be a duration of at least 1s : "+fields[1])
+		}
+		return interval(d), nil
+	}
+	if len(fields) == 1 {
+		if expr, ok := cronDescriptors[fields[0]]; ok {
+			fields = strings.Fields(expr)
+		}
+	}
+	if len(fields) != 5 {
+		return nil, gpio.NewError(gpio.CodeInvalidValue, "", "Invalid schedule, must be a cron expression with 5 fields, a descriptor like @daily, or @every <duration> : "+spec)
+	}
+
+	s := &cronSchedule{
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+	bounds := []struct {
+		field    *uint64
+		min, max int
+	}{
+		{&s.minute, 0, 59},
+		{&s.hour, 0, 23},
+		{&s.dom, 1, 31},
+		{&s.month, 1, 12},
+		{&s.dow, 0, 7},
+	}
+	for i, b := range bounds {
+		bits, err := parseCronField(fields[i], b.min, b.max)
+		if err != nil {
+			return nil, err
+		}
+		*b.field = bits
+	}
+	// 7 is another name for Sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges (1-5) and
+// steps (*/15 or 1-30/5) into a bit set.
+func parseCronField(field string, min, max int) (uint64, error) {
+	invalid := gpio.NewError(gpio.CodeInvalidValue, "", "Invalid cron field, values must be between "+strconv.Itoa(min)+" and "+strconv.Itoa(max)+" : "+field)
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, invalid
+			}
+			part = part[:i]
+		}
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, invalid
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, invalid
+				}
+			} else if step > 1 {
+				// 5/15 means from 5 onwards
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, invalid
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// a schedule that matches no day within a few years never will
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		want     []int
+	}{
+		{"*", 0, 5, []int{0, 1, 2, 3, 4, 5}},
+		{"3", 0, 59, []int{3}},
+		{"1,3,5", 0, 59, []int{1, 3, 5}},
+		{"10-13", 0, 59, []int{10, 11, 12, 13}},
+		{"*/15", 0, 59, []int{0, 15, 30, 45}},
+		{"1-10/4", 0, 59, []int{1, 5, 9}},
+		{"50/5", 0, 59, []int{50, 55}},
+		{"1-2,20-21", 1, 31, []int{1, 2, 20, 21}},
+		{"0,7", 0, 7, []int{0, 7}},
+	}
+	for _, test := range tests {
+		got, err := parseCronField(test.field, test.min, test.max)
+		if err != nil {
+			t.Errorf("%q: %v", test.field, err)
+			continue
+		}
+		var want uint64
+		for _, v := range test.want {
+			want |= 1 << uint(v)
+		}
+		if got != want {
+			t.Errorf("%q: got %b, want %b", test.field, got, want)
+		}
+	}
+	for _, field := range []string{"", "60", "-1", "5-1", "*/0", "*/x", "a", "1-", "0"} {
+		if _, err := parseCronField(field, 1, 59); gpio.CodeOf(err) != gpio.CodeInvalidValue {
+			t.Errorf("%q: got %v, want an InvalidValue error", field, err)
+		}
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "* * * * * *", "61 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "@often", "@every 10ms", "@every soon"} {
+		if _, err := parseSchedule(spec); gpio.CodeOf(err) != gpio.CodeInvalidValue {
+			t.Errorf("%q: got %v, want an InvalidValue error", spec, err)
+		}
+	}
+	s, err := parseSchedule("@every 90s")
+	if err != nil || s != interval(90*time.Second) {
+		t.Errorf("@every 90s: got %v, %v", s, err)
+	}
+	// descriptors are cron expressions
+	for descriptor, expr := range cronDescriptors {
+		got, err := parseSchedule(descriptor)
+		if err != nil {
+			t.Fatalf("%s: %v", descriptor, err)
+		}
+		want, _ := parseSchedule(expr)
+		if *got.(*cronSchedule) != *want.(*cronSchedule) {
+			t.Errorf("%s: got %+v, want %+v", descriptor, got, want)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	tests := []struct {
+		spec string
+		from string
+		want string
+	}{
+		{"* * * * *", "2024-03-10 10:15", "2024-03-10 10:16"},
+		{"*/15 * * * *", "2024-03-10 10:15", "2024-03-10 10:30"},
+		{"0 * * * *", "2024-03-10 23:30", "2024-03-11 00:00"},
+		{"30 6 * * *", "2024-03-10 07:00", "2024-03-11 06:30"},
+		// across the end of a month and a year
+		{"0 0 1 * *", "2024-01-31 12:00", "2024-02-01 00:00"},
+		{"@yearly", "2024-06-01 00:00", "2025-01-01 00:00"},
+		{"0 12 31 * *", "2024-04-01 00:00", "2024-05-31 12:00"},
+		// only leap years have a 29th of February
+		{"0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		// Sunday is 0 or 7; 2024-03-10 is a Sunday
+		{"0 9 * * 0", "2024-03-10 10:00", "2024-03-17 09:00"},
+		{"0 9 * * 7", "2024-03-10 08:00", "2024-03-10 09:00"},
+		{"0 9 * * 1-5", "2024-03-08 10:00", "2024-03-11 09:00"},
+		// both day fields restricted match either, so the 15th, a Friday,
+		// or the Monday before it
+		{"0 0 15 * 1", "2024-03-05 00:00", "2024-03-11 00:00"},
+		{"0 0 15 * 1", "2024-03-12 00:00", "2024-03-15 00:00"},
+		// a day field starting with * doesn't widen the other
+		{"0 0 */2 * 1", "2024-03-05 00:00", "2024-03-11 00:00"},
+		{"0 0 13 * */3", "2024-03-01 00:00", "2024-03-13 00:00"},
+		// while a range is a restriction, even of every day
+		{"0 0 1-31 * 1", "2024-03-05 00:00", "2024-03-06 00:00"},
+	}
+	for _, test := range tests {
+		s, err := parseSchedule(test.spec)
+		if err != nil {
+			t.Errorf("%s: %v", test.spec, err)
+			continue
+		}
+		if got := s.next(at(test.from)); !got.Equal(at(test.want)) {
+			t.Errorf("%s after %s: got %s, want %s", test.spec, test.from, got.Format("2006-01-02 15:04 Mon"), test.want)
+		}
+	}
+	s, _ := parseSchedule("0 0 31 2 *")
+	if got := s.next(at("2024-01-01 00:00")); !got.IsZero() {
+		t.Errorf("February 31st: got %s, want never", got)
+	}
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"log"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+)
+
+// event is a message on its way to the connections. Events about a pin carry
+// its id, and its name when known, so the hub can filter them, and are
+// numbered by the hub before being encoded. Events about several pins carry
+// their names keyed by id in Pins instead.
+type event struct {
+	Type  string
+	PinId string
+	Name  string
+	Pins  map[string]string
+	Seq   uint64
+
+	payload interface{}
+	data    []byte
+}
+
+// newEvent creates a message of type typ.
+func newEvent(typ string, payload interface{}) *event {
+	return &event{Type: typ, payload: payload}
+}
+
+// newPinEvent creates a PinState or PinAdded event.
+func newPinEvent(typ string, pinState gpio.PinState) *event {
+	e := newEvent(typ, pinState)
+	e.PinId = pinState.PinId
+	e.Name = pinState.Name
+	return e
+}
+
+// newPinRemovedEvent creates a PinRemoved event.
+func newPinRemovedEvent(pinId string) *event {
+	e := newEvent(protocol.TypePinRemoved, pinId)
+	e.PinId = pinId
+	return e
+}
+
+// newPinsEvent creates a PinsChanged or SceneApplied event.
+func newPinsEvent(typ string, changed protocol.PinsChanged) *event {
+	e := newEvent(typ, changed)
+	e.Pins = make(map[string]string, len(changed.PinStates))
+	for pinId, ps := range changed.PinStates {
+		e.Pins[pinId] = ps.Name
+	}
+	return e
+}
+
+// newErrorEvent creates the Error message reporting err, raised running
+// command cmd.
+func newErrorEvent(cmd string, err error) *event {
+	e := newError(cmd, err)
+	log.Println("Error: " + e.Message)
+	return newEvent(protocol.TypeError, e)
+}
+
+// newError describes err, raised running command cmd, to clients.
+func newError(cmd string, err error) protocol.Error {
+	e := protocol.Error{Code: gpio.CodeOf(err), Message: err.Error(), Command: cmd}
+	if gerr, ok := err.(*gpio.Error); ok {
+		e.PinId = gerr.PinId
+	}
+	return e
+}
+
+// eventPinStates returns the pin states carried by a pin event.
+func eventPinStates(e *event) []gpio.PinState {
+	var states []gpio.PinState
+	switch payload := e.payload.(type) {
+	case gpio.PinState:
+		states = append(states, payload)
+	case protocol.PinsChanged:
+		for _, ps := range payload.PinStates {
+			states = append(states, ps)
+		}
+	}
+	return states
+}
+
+// isPin reports whether e is about one or more pins.
+func (e *event) isPin() bool {
+	return e.PinId != "" || len(e.Pins) > 0
+}
+
+// encode marshals the event, unless it already has been.
+func (e *event) encode() error {
+	if e.data != nil {
+		return nil
+	}
+	data, err := protocol.EncodeSeq(e.Type, e.payload, e.Seq)
+	if err != nil {
+		return err
+	}
+	e.data = data
+	return nil
+}
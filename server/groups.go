@@ -0,0 +1,276 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+)
+
+// pinWrite is one pin of a multi-pin write.
+type pinWrite struct {
+	pinId string
+	value byte
+}
+
+// pinBatch is a multi-pin write. It collects the PinState events of its
+// pins, so the event pump can send them as a single event of type typ with
+// changed as its payload.
+type pinBatch struct {
+	writes  []pinWrite
+	pins    map[string]bool
+	typ     string
+	changed protocol.PinsChanged
+
+	// The Error reporting a failed write, sent ahead of the combined event.
+	err *event
+}
+
+func newPinBatch(typ string, writes []pinWrite) *pinBatch {
+	b := &pinBatch{
+		writes:  writes,
+		pins:    make(map[string]bool, len(writes)),
+		typ:     typ,
+		changed: protocol.PinsChanged{PinStates: make(map[string]gpio.PinState, len(writes))},
+	}
+	for _, w := range writes {
+		b.pins[w.pinId] = true
+	}
+	return b
+}
+
+// add collects pinState if it is about one of the batch's pins.
+func (b *pinBatch) add(pinState gpio.PinState) bool {
+	if !b.pins[pinState.PinId] {
+		return false
+	}
+	b.changed.PinStates[pinState.PinId] = pinState
+	return true
+}
+
+// event returns the combined event for the batch, or nil if no pin changed.
+func (b *pinBatch) event() *event {
+	if len(b.changed.PinStates) == 0 {
+		return nil
+	}
+	return newPinsEvent(b.typ, b.changed)
+}
+
+// setPins writes every pin of b as one operation for command cmd: clients
+// get a single event, and if any write fails the pins already written are
+// restored to their previous state. A failed write is reported ahead of the
+// combined event, so the restored states are never mistaken for a
+// successful write. It must only be called from the hub goroutine.
+func (h *hub) setPins(cmd string, b *pinBatch) error {
+	pinStates, err := h.gpio.PinStates()
+	if err != nil {
+		return err
+	}
+	writes := b.writes
+	prev := make([]byte, len(writes))
+	for i, w := range writes {
+		ps, ok := pinStates[w.pinId]
+		if !ok {
+			return gpio.NewError(gpio.CodeUnknownPin, w.pinId, "Pin "+w.pinId+" is not initialised")
+		}
+		prev[i] = ps.State
+	}
+
+	h.batches <- b
+	for i, w := range writes {
+		if err := h.gpio.PinSet(w.pinId, w.value); err != nil {
+			b.err = newErrorEvent(cmd, withPin(err, w.pinId))
+			for j := i - 1; j >= 0; j-- {
+				if err := h.gpio.PinSet(writes[j].pinId, prev[j]); err != nil {
+					log.Println("Failed to roll back pin " + writes[j].pinId + " : " + err.Error())
+				}
+			}
+			break
+		}
+	}
+	h.batches <- b
+	return nil
+}
+
+// copyGroups returns a copy of the groups, safe to hand to other goroutines.
+func (h *hub) copyGroups() map[string][]string {
+	groups := make(map[string][]string, len(h.groups))
+	for name, pins := range h.groups {
+		groups[name] = append([]string{}, pins...)
+	}
+	return groups
+}
+
+var groupArg = protocol.ArgSchema{
+	Name:        "group",
+	Type:        protocol.ArgString,
+	Description: "Group name",
+}
+
+func init() {
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdDefGroup,
+			Description: "Define a group of pins, or redefine an existing one",
+			Args: []protocol.ArgSchema{
+				groupArg,
+				{
+					Name:        "pin",
+					Type:        protocol.ArgPin,
+					Description: "Pins of the group, the first being bit 0 of bitmasks given to setgroup",
+					Variadic:    true,
+				},
+			},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : defgroup group pin ...
+			pins := make([]string, 0, len(args)-1)
+			seen := make(map[string]bool)
+			for _, arg := range args[1:] {
+				pin, err := h.resolvePin(arg)
+				if err != nil {
+					return err
+				}
+				if seen[pin] {
+					return gpio.NewError(gpio.CodeInvalidValue, pin, "Pin "+pin+" is listed twice")
+				}
+				seen[pin] = true
+				pins = append(pins, pin)
+			}
+			h.groups[args[0]] = pins
+			go h.sendMsg(protocol.TypeGroups, h.copyGroups())
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdDelGroup,
+			Description: "Delete a group of pins, leaving the pins as they are",
+			Args:        []protocol.ArgSchema{groupArg},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : delgroup group
+			if _, ok := h.groups[args[0]]; !ok {
+				return gpio.NewError(gpio.CodeNotFound, "", "Unknown group "+args[0])
+			}
+			delete(h.groups, args[0])
+			go h.sendMsg(protocol.TypeGroups, h.copyGroups())
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdGetGroups,
+			Description: "Reply with every group and its pins",
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			go h.sendMsg(protocol.TypeGroups, h.copyGroups())
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdSetGroup,
+			Description: "Set every pin of a group at once, rolling all of them back if any fails",
+			Args: []protocol.ArgSchema{
+				groupArg,
+				{
+					Name:        "value",
+					Type:        protocol.ArgString,
+					Description: "A value for every pin as for setpin, or a bitmask prefixed with 0b or 0x, bit 0 being the group's first pin",
+				},
+			},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : setgroup group value|bitmask
+			pins, ok := h.groups[args[0]]
+			if !ok {
+				return gpio.NewError(gpio.CodeNotFound, "", "Unknown group "+args[0])
+			}
+			values, err := parseGroupValue(args[1], len(pins))
+			if err != nil {
+				return err
+			}
+			writes := make([]pinWrite, len(pins))
+			for i, pin := range pins {
+				writes[i] = pinWrite{pin, values[i]}
+			}
+			b := newPinBatch(protocol.TypePinsChanged, writes)
+			b.changed.Group = args[0]
+			return h.setPins(protocol.CmdSetGroup, b)
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdSetPins,
+			Description: "Set several pins at once, rolling all of them back if any fails",
+			Args: []protocol.ArgSchema{{
+				Name:        "values",
+				Type:        protocol.ArgJSON,
+				Description: `Object mapping pins to values as for setpin, e.g. {"P1_11": 1, "fan": 128}`,
+				Variadic:    true,
+			}},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : setpins {"pin": value, ...}
+			var values map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(strings.Join(args, " ")), &values); err != nil {
+				return gpio.NewError(gpio.CodeInvalidArguments, "", "Invalid pin values, must be a JSON object : "+err.Error())
+			}
+			writes := make([]pinWrite, 0, len(values))
+			seen := make(map[string]bool)
+			for key, raw := range values {
+				pin, err := h.resolvePin(key)
+				if err != nil {
+					return err
+				}
+				if seen[pin] {
+					return gpio.NewError(gpio.CodeInvalidValue, pin, "Pin "+pin+" is given twice")
+				}
+				seen[pin] = true
+				var str string
+				if json.Unmarshal(raw, &str) != nil {
+					str = string(raw)
+				}
+				value, err := parseValue(str)
+				if err != nil {
+					return withPin(err, pin)
+				}
+				writes = append(writes, pinWrite{pin, value})
+			}
+			// write in a predictable order
+			sort.Slice(writes, func(i, j int) bool { return writes[i].pinId < writes[j].pinId })
+			return h.setPins(protocol.CmdSetPins, newPinBatch(protocol.TypePinsChanged, writes))
+		},
+	})
+}
+
+// parseGroupValue parses a setgroup value into a value for each of n pins.
+// Values prefixed with 0b or 0x are bitmasks, bit 0 being the first pin,
+// anything else is a single value for every pin.
+func parseGroupValue(str string, n int) ([]byte, error) {
+	values := make([]byte, n)
+	lower := strings.ToLower(str)
+	if strings.HasPrefix(lower, "0b") || strings.HasPrefix(lower, "0x") {
+		mask, err := strconv.ParseUint(lower, 0, 64)
+		if err != nil || (n < 64 && mask>>uint(n) != 0) {
+			return nil, gpio.NewError(gpio.CodeInvalidValue, "", "Invalid bitmask for a group of "+strconv.Itoa(n)+" pins : "+str)
+		}
+		for i := range values {
+			values[i] = byte(mask >> uint(i) & 1)
+		}
+		return values, nil
+	}
+	value, err := parseValue(str)
+	if err != nil {
+		return nil, err
+	}
+	for i := range values {
+		values[i] = value
+	}
+	return values, nil
+}
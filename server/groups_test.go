@@ -0,0 +1,106 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+)
+
+func TestParseGroupValue(t *testing.T) {
+	tests := []struct {
+		str  string
+		n    int
+		want []byte
+	}{
+		{"high", 3, []byte{1, 1, 1}},
+		{"0", 2, []byte{0, 0}},
+		{"128", 2, []byte{128, 128}},
+		// masks set the first pin from the lowest bit
+		{"0b101", 3, []byte{1, 0, 1}},
+		{"0b011", 3, []byte{1, 1, 0}},
+		{"0B1", 3, []byte{1, 0, 0}},
+		{"0x5", 4, []byte{1, 0, 1, 0}},
+		{"0XF0", 8, []byte{0, 0, 0, 0, 1, 1, 1, 1}},
+		{"0x0", 2, []byte{0, 0}},
+		// too many bits for the group
+		{"0b1000", 3, nil},
+		{"0x10", 4, nil},
+		{"0b12", 3, nil},
+		{"0x", 3, nil},
+		{"256", 2, nil},
+		{"-1", 2, nil},
+		{"on", 2, nil},
+	}
+	for _, test := range tests {
+		got, err := parseGroupValue(test.str, test.n)
+		if test.want == nil {
+			if gpio.CodeOf(err) != gpio.CodeInvalidValue {
+				t.Errorf("%s for %d pins: got %v, %v, want an InvalidValue error", test.str, test.n, got, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s for %d pins: got %v, %v, want %v", test.str, test.n, got, err, test.want)
+		}
+	}
+}
+
+func TestSetPinsRollsBack(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []pinWrite
+		// the states of P8_07, P8_08 and P8_09 after the write
+		want []byte
+		// the pin reported failing, if any
+		failed string
+	}{
+		{"all written", []pinWrite{{"P8_07", 1}, {"P8_08", 0}, {"P8_09", 1}}, []byte{1, 0, 1}, ""},
+		{"first fails", []pinWrite{{"P8_07", 5}, {"P8_08", 0}, {"P8_09", 0}}, []byte{0, 1, 1}, "P8_07"},
+		{"middle fails", []pinWrite{{"P8_07", 1}, {"P8_08", 5}, {"P8_09", 0}}, []byte{0, 1, 1}, "P8_08"},
+		{"last fails", []pinWrite{{"P8_07", 1}, {"P8_08", 0}, {"P8_09", 5}}, []byte{0, 1, 1}, "P8_09"},
+	}
+	for _, test := range tests {
+		h, g := newTestHub(t, "P8_07", "P8_08", "P8_09")
+		g.PinSet("P8_08", 1)
+		g.PinSet("P8_09", 1)
+		// the pump is sent the batch as it starts and again when done
+		batches := make(chan *pinBatch, 2)
+		go func() {
+			batches <- <-h.batches
+			batches <- <-h.batches
+		}()
+
+		b := newPinBatch(protocol.TypePinsChanged, test.writes)
+		if err := h.setPins(protocol.CmdSetPins, b); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		<-batches
+		<-batches
+		got := []byte{pinState(g, "P8_07"), pinState(g, "P8_08"), pinState(g, "P8_09")}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got states %v, want %v", test.name, got, test.want)
+		}
+		switch {
+		case test.failed == "" && b.err != nil:
+			t.Errorf("%s: got error %v", test.name, b.err.payload)
+		case test.failed != "" && b.err == nil:
+			t.Errorf("%s: no error reported", test.name)
+		case test.failed != "":
+			if err := b.err.payload.(protocol.Error); err.PinId != test.failed || err.Command != protocol.CmdSetPins {
+				t.Errorf("%s: got error %+v, want one for %s running %s", test.name, err, test.failed, protocol.CmdSetPins)
+			}
+		}
+	}
+
+	// pins that aren't initialised are refused before any is written
+	h, g := newTestHub(t, "P8_07")
+	b := newPinBatch(protocol.TypePinsChanged, []pinWrite{{"P8_07", 1}, {"P8_10", 1}})
+	if err := h.setPins(protocol.CmdSetPins, b); gpio.CodeOf(err) != gpio.CodeUnknownPin {
+		t.Errorf("writing an uninitialised pin: got %v, want an UnknownPin error", err)
+	}
+	if pinState(g, "P8_07") != 0 {
+		t.Error("wrote a pin of a batch that was refused")
+	}
+}
@@ -0,0 +1,473 @@
+package server
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+	"github.com/benjamind/gpio-json-server/sensor"
+)
+
+// maxBacklog is how many undelivered messages a connection may build up
+// before it is considered stuck and dropped.
+const maxBacklog = 1024
+
+type hub struct {
+	// Registered connections.
+	connections map[*connection]bool
+
+	// Inbound messages from the connections.
+	broadcast chan *inbound
+
+	// Inbound messages from the system
+	broadcastSys chan *event
+
+	// Register requests from the connections.
+	register chan *connection
+
+	// Unregister requests from connections.
+	unregister chan *connection
+
+	// Connections whose writer has emptied its send buffer while they
+	// have a backlog.
+	ready chan *connection
+
+	// Stop requests, after which commands are no longer executed. The hub
+	// replies with its state to persist, which no longer changes.
+	stop chan chan *State
+
+	// Shutdown requests, carrying the reason sent to every connection in its
+	// close frame. The hub returns once it has closed every connection.
+	shutdown chan string
+
+	// Closed once the hub has returned, after setting closeReason for the
+	// connections that arrive later.
+	done        chan struct{}
+	closeReason string
+
+	// Tracks connection writers so shutdown can wait for close frames to be sent.
+	writers sync.WaitGroup
+
+	stopped bool
+
+	// Sequence number of the last pin event delivered.
+	seq uint64
+
+	// Last known name of each pin, for matching events that don't carry one
+	// against name subscriptions.
+	pinNames map[string]string
+
+	// Pin groups, listing the pin ids of each in bit order.
+	groups map[string][]string
+
+	// Saved scenes.
+	scenes map[string]protocol.Scene
+
+	// Scheduled jobs.
+	jobs map[string]*job
+
+	// Rules, and the last value of each pin for evaluating them, as given by
+	// ruleValue.
+	rules      map[string]*rule
+	lastStates map[string]int64
+
+	// Last reading of each sensor, the drivers reading them, and how often
+	// drivers are read unless configured otherwise.
+	sensors        map[string]sensor.Reading
+	sensorDrivers  map[string]*sensorDriver
+	sensorInterval time.Duration
+
+	// The done channel of the last driver of each name stopped, which may
+	// still be closing, and a channel closed once every driver is closed
+	// after the hub stops.
+	closingSensors map[string]chan struct{}
+	sensorsClosed  chan struct{}
+
+	// Readings from the sensor drivers.
+	readings chan sensorReadings
+
+	// Stepper motors, and the progress of their moves, buffered so moves
+	// don't wait for a busy hub.
+	steppers       map[string]*stepper
+	stepperUpdates chan stepperUpdate
+
+	// Functions to run on the hub goroutine, sent by timers.
+	deferred chan func()
+
+	// Pulses running, by pin.
+	pulses map[string]*pulse
+
+	// Pin batches being written, sent to the event pump once when started
+	// and again when done.
+	batches chan *pinBatch
+
+	gpio gpio.GPIOInterface
+}
+
+// inbound is a message received from a connection.
+type inbound struct {
+	c    *connection
+	data []byte
+}
+
+func newHub(g gpio.GPIOInterface) *hub {
+	return &hub{
+		broadcast:     make(chan *inbound),
+		broadcastSys:  make(chan *event),
+		register:      make(chan *connection),
+		unregister:    make(chan *connection),
+		ready:         make(chan *connection),
+		stop:          make(chan chan *State),
+		shutdown:      make(chan string),
+		done:          make(chan struct{}),
+		connections:   make(map[*connection]bool),
+		pinNames:      make(map[string]string),
+		groups:        make(map[string][]string),
+		scenes:        make(map[string]protocol.Scene),
+		jobs:          make(map[string]*job),
+		rules:         make(map[string]*rule),
+		lastStates:    make(map[string]int64),
+		sensors:       make(map[string]sensor.Reading),
+		sensorDrivers: make(map[string]*sensorDriver),
+		readings:      make(chan sensorReadings),
+		deferred:      make(chan func()),
+		pulses:        make(map[string]*pulse),
+		batches:       make(chan *pinBatch),
+		gpio:          g,
+
+		steppers:       make(map[string]*stepper),
+		stepperUpdates: make(chan stepperUpdate, 16),
+		closingSensors: make(map[string]chan struct{}),
+		sensorsClosed:  make(chan struct{}),
+	}
+}
+
+func (h *hub) run() {
+	h.seed()
+	for {
+		select {
+		case c := <-h.register:
+			h.writers.Add(1)
+			h.connections[c] = true
+			// send supported commands
+			h.sendTo(c, protocol.TypeVersion, Version)
+			h.sendCommands(c)
+			h.sendTo(c, protocol.TypeSnapshot, h.snapshot())
+		case c := <-h.unregister:
+			if !h.connections[c] {
+				// already dropped by the hub, which closed c.send then
+				continue
+			}
+			h.drop(c, "")
+		case c := <-h.ready:
+			if h.connections[c] {
+				h.flush(c)
+			}
+		case m := <-h.broadcast:
+			/*log.Print("Got a broadcast")
+			log.Print(m)
+			log.Print(len(m))*/
+			if len(m.data) > 0 && !h.stopped {
+				/*log.Print(string(m))
+				log.Print(h.broadcast)*/
+				h.checkCmd(m.c, m.data)
+				//log.Print("-----")
+			}
+		case e := <-h.broadcastSys:
+			/*log.Printf("Got a system broadcast: %v\n", string(m))
+			log.Print(string(m))
+			log.Print("-----")*/
+			name := h.trackName(e)
+			if e.isPin() {
+				h.seq++
+				e.Seq = h.seq
+			}
+			if err := e.encode(); err != nil {
+				log.Println("Failed to marshal data!")
+				continue
+			}
+
+			for c := range h.connections {
+				if c.sub != nil && !c.sub.matches(e, name) {
+					continue
+				}
+				h.deliver(c, e)
+			}
+			if e.isPin() && !h.stopped {
+				h.checkLimits(e)
+				h.checkRules(e)
+			}
+		case f := <-h.deferred:
+			if !h.stopped {
+				f()
+			}
+		case r := <-h.readings:
+			if !h.stopped {
+				h.updateSensors(r)
+			}
+		case u := <-h.stepperUpdates:
+			if !h.stopped {
+				h.updateStepper(u)
+			}
+		case states := <-h.stop:
+			if !h.stopped {
+				h.stopSensors()
+				h.stopSteppers()
+			}
+			h.stopped = true
+			states <- h.state()
+		case reason := <-h.shutdown:
+			if !h.stopped {
+				h.stopSensors()
+				h.stopSteppers()
+			}
+			h.stopped = true
+			h.closeReason = reason
+			for c := range h.connections {
+				h.flush(c)
+				if len(c.backlog) > 0 {
+					log.Printf("Dropping %d undelivered messages for a slow client", len(c.backlog))
+				}
+				h.drop(c, reason)
+			}
+			close(h.done)
+			return
+		}
+	}
+}
+
+// deliver queues e on c. If c's send buffer is full the event is kept in
+// c's backlog instead, where a newer PinState for the same pin replaces an
+// older one, so a slow client catches up with the latest state of each pin
+// rather than being disconnected. Only a client whose backlog still grows
+// past maxBacklog is dropped.
+func (h *hub) deliver(c *connection, e *event) {
+	if len(c.backlog) > 0 {
+		h.flush(c)
+	}
+	if len(c.backlog) == 0 {
+		select {
+		case c.send <- e.data:
+			return
+		default:
+			atomic.StoreInt32(&c.backlogged, 1)
+		}
+	}
+
+	if e.Type == protocol.TypePinState {
+		for i, old := range c.backlog {
+			if old.Type == protocol.TypePinState && old.PinId == e.PinId {
+				c.backlog = append(c.backlog[:i], c.backlog[i+1:]...)
+				break
+			}
+		}
+	}
+	c.backlog = append(c.backlog, e)
+	if len(c.backlog) > maxBacklog {
+		log.Println("Dropping client that stopped reading")
+		h.drop(c, "client too slow")
+	}
+}
+
+// wake tells the hub that c's writer has room for its backlog, unless the
+// hub has returned. It is called from c's writer.
+func (h *hub) wake(c *connection) {
+	select {
+	case h.ready <- c:
+	case <-h.done:
+	}
+}
+
+// flush moves as much of c's backlog into its send buffer as fits.
+func (h *hub) flush(c *connection) {
+	for len(c.backlog) > 0 {
+		select {
+		case c.send <- c.backlog[0].data:
+			c.backlog[0] = nil
+			c.backlog = c.backlog[1:]
+		default:
+			return
+		}
+	}
+	c.backlog = nil
+	atomic.StoreInt32(&c.backlogged, 0)
+}
+
+// drop unregisters c and closes it with reason. It must only be called from
+// the hub goroutine.
+func (h *hub) drop(c *connection, reason string) {
+	delete(h.connections, c)
+	c.backlog = nil
+	c.closeReason = reason
+	close(c.send)
+}
+
+// snapshot captures everything a client needs to start in sync. Taken on the
+// hub goroutine, it is consistent with the events already delivered.
+func (h *hub) snapshot() protocol.Snapshot {
+	snap := protocol.Snapshot{Seq: h.seq}
+	var err error
+	if snap.Host, err = h.gpio.Host(); err != nil {
+		log.Println("Failed to get host for snapshot : " + err.Error())
+	}
+	if snap.PinMap, err = h.gpio.PinMap(); err != nil {
+		log.Println("Failed to get pin map for snapshot : " + err.Error())
+	}
+	if snap.PinStates, err = h.gpio.PinStates(); err != nil {
+		log.Println("Failed to get pin states for snapshot : " + err.Error())
+	}
+	snap.Sensors = h.copySensors()
+	snap.Groups = h.copyGroups()
+	snap.Scenes = h.copyScenes()
+	snap.Steppers = h.copySteppers(false)
+	return snap
+}
+
+// seed records the name and rule value of every pin the backend starts
+// with, so rules only fire on the changes that follow.
+func (h *hub) seed() {
+	pinStates, err := h.gpio.PinStates()
+	if err != nil {
+		log.Println("Failed to get pin states : " + err.Error())
+	}
+	for pinId, ps := range pinStates {
+		h.pinNames[pinId] = ps.Name
+		h.lastStates[pinId] = ruleValue(ps)
+	}
+}
+
+// trackName records the names of pins as events pass through, and returns
+// the name of the pin e is about.
+func (h *hub) trackName(e *event) string {
+	switch {
+	case len(e.Pins) > 0:
+		for pinId, name := range e.Pins {
+			h.pinNames[pinId] = name
+		}
+		return ""
+	case e.PinId == "":
+		return ""
+	case e.Type == protocol.TypePinRemoved:
+		name := h.pinNames[e.PinId]
+		delete(h.pinNames, e.PinId)
+		return name
+	case e.Name != "":
+		h.pinNames[e.PinId] = e.Name
+	}
+	return h.pinNames[e.PinId]
+}
+
+// sendErr reports err, raised running command cmd, to every connection.
+func (h *hub) sendErr(cmd string, err error) {
+	h.send(newErrorEvent(cmd, err))
+}
+
+func (h *hub) sendMsg(name string, msg interface{}) {
+	//log.Println("Sent: " + name)
+	h.send(newEvent(name, msg))
+}
+
+// send hands e to the hub to deliver, unless the hub has returned.
+func (h *hub) send(e *event) {
+	select {
+	case h.broadcastSys <- e:
+	case <-h.done:
+	}
+}
+
+// sendTo sends a message to a single connection. It must only be called from
+// the hub goroutine.
+func (h *hub) sendTo(c *connection, name string, msg interface{}) {
+	e := newEvent(name, msg)
+	if err := e.encode(); err != nil {
+		log.Println("Failed to marshal data!")
+		return
+	}
+	if h.connections[c] {
+		h.deliver(c, e)
+	}
+}
+
+// resolvePin returns the canonical id of the pin key refers to by id, alias
+// or name. Sensors aren't pins, so can't be used where one is expected.
+func (h *hub) resolvePin(key string) (string, error) {
+	pinMap, err := h.gpio.PinMap()
+	if err != nil {
+		return "", err
+	}
+	pinStates, err := h.gpio.PinStates()
+	if err != nil {
+		return "", err
+	}
+	pinId, err := gpio.Resolve(pinMap, pinStates, key)
+	if _, ok := h.sensors[key]; ok && err != nil {
+		return "", gpio.NewError(gpio.CodeUnsupported, key, key+" is a read-only sensor")
+	}
+	return pinId, err
+}
+
+// checkPinName verifies naming pin pinId name leaves every pin reachable by
+// its id, aliases and name.
+func (h *hub) checkPinName(pinId string, name string) error {
+	pinMap, err := h.gpio.PinMap()
+	if err != nil {
+		return err
+	}
+	pinStates, err := h.gpio.PinStates()
+	if err != nil {
+		return err
+	}
+	return gpio.CheckName(pinMap, pinStates, pinId, name)
+}
+
+// canonicalFilter resolves pin filters to canonical pin ids, as carried by
+// events.
+func (h *hub) canonicalFilter(kind, value string) (string, string) {
+	if kind == "pin" {
+		if pinId, err := h.resolvePin(value); err == nil {
+			return kind, pinId
+		}
+	}
+	return kind, value
+}
+
+// sendCommands sends the schema of every command to a single connection.
+func (h *hub) sendCommands(c *connection) {
+	bytes, err := protocol.EncodeCommands(commandSchema())
+	if err != nil {
+		log.Println("Failed to marshal data!")
+		return
+	}
+	h.deliver(c, &event{Type: protocol.TypeCommands, data: bytes})
+}
+
+func (h *hub) checkCmd(c *connection, m []byte) {
+	//log.Println("Inside checkCmd")
+	s := string(m[:])
+	s = strings.Replace(s, "\n", "", -1)
+	log.Print(s)
+
+	args := strings.Fields(s)
+	if len(args) == 0 {
+		return
+	}
+	name := strings.ToLower(args[0])
+	cmd, ok := commandsByName[name]
+	if !ok {
+		go h.sendErr(name, gpio.NewError(gpio.CodeUnknownCommand, "", "Unknown command "+args[0]))
+		return
+	}
+	if err := cmd.checkArgs(args[1:]); err != nil {
+		go h.sendErr(name, err)
+		return
+	}
+	if err := cmd.run(h, c, args[1:]); err != nil {
+		go h.sendErr(name, err)
+	}
+
+	//log.Println("Done with checkCmd")
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+	"github.com/benjamind/gpio-json-server/sensor"
+)
+
+// deliverState encodes a PinState event and delivers it to c.
+func deliverState(t *testing.T, h *hub, c *connection, typ string, pinId string, value byte) {
+	t.Helper()
+	e := newPinEvent(typ, gpio.PinState{PinId: pinId, State: value})
+	if err := e.encode(); err != nil {
+		t.Fatal(err)
+	}
+	h.deliver(c, e)
+}
+
+// received reads every message queued on c, as type pin=state.
+func received(t *testing.T, c *connection) []string {
+	t.Helper()
+	var got []string
+	for len(c.send) > 0 {
+		var msg map[string]json.RawMessage
+		var typ string
+		var ps gpio.PinState
+		if err := json.Unmarshal(<-c.send, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(msg["Type"], &typ); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(msg[typ], &ps); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, typ+" "+ps.PinId+"="+strconv.Itoa(int(ps.State)))
+	}
+	return got
+}
+
+func TestDeliverCoalesces(t *testing.T) {
+	h := newHub(nil)
+	c := &connection{h: h, send: make(chan []byte, 2)}
+	h.connections[c] = true
+
+	deliverState(t, h, c, protocol.TypePinState, "P8_07", 1)
+	deliverState(t, h, c, protocol.TypePinState, "P8_08", 1)
+	// the send buffer is full, so the rest are kept, with only the last
+	// state of each pin
+	deliverState(t, h, c, protocol.TypePinState, "P8_07", 2)
+	deliverState(t, h, c, protocol.TypePinAdded, "P8_09", 0)
+	deliverState(t, h, c, protocol.TypePinState, "P8_08", 2)
+	deliverState(t, h, c, protocol.TypePinState, "P8_07", 3)
+	if len(c.backlog) != 3 || c.backlogged == 0 {
+		t.Fatalf("got a backlog of %d, backlogged %d, want 3 and set", len(c.backlog), c.backlogged)
+	}
+
+	want := []string{"PinState P8_07=1", "PinState P8_08=1"}
+	if got := received(t, c); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	h.flush(c)
+	want = []string{"PinAdded P8_09=0", "PinState P8_08=2"}
+	if got := received(t, c); !reflect.DeepEqual(got, want) {
+		t.Errorf("after flushing got %v, want %v", got, want)
+	}
+	// an event delivered with a backlog queues behind it
+	deliverState(t, h, c, protocol.TypePinState, "P8_10", 1)
+	h.flush(c)
+	want = []string{"PinState P8_07=3", "PinState P8_10=1"}
+	if got := received(t, c); !reflect.DeepEqual(got, want) {
+		t.Errorf("after flushing again got %v, want %v", got, want)
+	}
+	if len(c.backlog) != 0 || c.backlogged != 0 {
+		t.Errorf("got a backlog of %d, backlogged %d, want none", len(c.backlog), c.backlogged)
+	}
+}
+
+func TestDeliverDropsStuckClients(t *testing.T) {
+	h := newHub(nil)
+	c := &connection{h: h, send: make(chan []byte, 1)}
+	h.connections[c] = true
+
+	// states of the same pin never outgrow the backlog
+	for i := 0; i < 2*maxBacklog; i++ {
+		deliverState(t, h, c, protocol.TypePinState, "P8_07", byte(i))
+	}
+	if !h.connections[c] {
+		t.Fatal("dropped a client whose backlog was coalesced")
+	}
+	for i := 0; i <= maxBacklog && h.connections[c]; i++ {
+		deliverState(t, h, c, protocol.TypePinAdded, "P8_07", 0)
+	}
+	if h.connections[c] {
+		t.Fatal("kept a client whose backlog kept growing")
+	}
+	if _, ok := <-c.send; !ok {
+		t.Fatal("closed the client without sending what fit")
+	}
+	if _, ok := <-c.send; ok {
+		t.Error("left the dropped client's send channel open")
+	}
+	if c.closeReason == "" {
+		t.Error("dropped a client without a reason")
+	}
+}
+
+// nextMessage decodes the next message sent to c.
+func nextMessage(t *testing.T, c *connection) *protocol.Message {
+	t.Helper()
+	select {
+	case data := <-c.send:
+		msg, err := protocol.Decode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message sent")
+		return nil
+	}
+}
+
+// connect registers a connection with the running hub h and returns it
+// with the snapshot it was sent.
+func connect(t *testing.T, h *hub) (*connection, *protocol.Snapshot) {
+	t.Helper()
+	c := &connection{h: h, send: make(chan []byte, 16)}
+	h.register <- c
+	for _, typ := range []string{protocol.TypeVersion, protocol.TypeCommands, protocol.TypeSnapshot} {
+		msg := nextMessage(t, c)
+		if msg.Type != typ {
+			t.Fatalf("got %s on connecting, want %s", msg.Type, typ)
+		}
+		if msg.Snapshot != nil {
+			return c, msg.Snapshot
+		}
+	}
+	t.Fatal("no snapshot sent")
+	return nil, nil
+}
+
+func TestSnapshot(t *testing.T) {
+	h, g := newTestHub(t, "P8_07")
+	if err := g.PinSet("P8_07", 1); err != nil {
+		t.Fatal(err)
+	}
+	h.groups["fans"] = []string{"P8_07"}
+	h.scenes["on"] = protocol.Scene{"P8_07": 1}
+	h.sensors["t1"] = sensor.Reading{Id: "t1", Kind: "temperature", Value: 21.5}
+	go h.run()
+	defer func() { h.shutdown <- "test over" }()
+
+	first, snap := connect(t, h)
+	if snap.Seq != 0 {
+		t.Errorf("got seq %d before any pin event, want 0", snap.Seq)
+	}
+	if snap.Host != "fake" || len(snap.PinMap) == 0 {
+		t.Errorf("got host %q and %d pins in the map, want the fake's", snap.Host, len(snap.PinMap))
+	}
+	if ps, ok := snap.PinStates["P8_07"]; !ok || ps.State != 1 {
+		t.Errorf("got pin states %v, want P8_07 at 1", snap.PinStates)
+	}
+	if len(snap.Groups["fans"]) != 1 || snap.Scenes["on"]["P8_07"] != 1 || snap.Sensors["t1"].Value != 21.5 {
+		t.Errorf("got groups %v, scenes %v and sensors %v, want those of the hub", snap.Groups, snap.Scenes, snap.Sensors)
+	}
+
+	// pin events are numbered, other messages aren't
+	h.broadcastSys <- newPinEvent(protocol.TypePinState, gpio.PinState{PinId: "P8_07", Dir: gpio.Out})
+	h.broadcastSys <- newEvent(protocol.TypeGroups, map[string][]string{})
+	h.broadcastSys <- newPinRemovedEvent("P8_08")
+	for _, want := range []uint64{1, 0, 2} {
+		if msg := nextMessage(t, first); msg.Seq != want {
+			t.Errorf("got %s numbered %d, want %d", msg.Type, msg.Seq, want)
+		}
+	}
+	if _, snap := connect(t, h); snap.Seq != 2 {
+		t.Errorf("got seq %d after two pin events, want 2", snap.Seq)
+	}
+}
@@ -0,0 +1,356 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+)
+
+// condition is a parsed protocol.Condition: a comparison of the pin's value
+// with value, or an edge when op is rising, falling or change.
+type condition struct {
+	pin   string
+	op    string
+	value int64
+}
+
+// ruleValue returns the value of a pin conditions are about: the count of a
+// counter or encoder, which its State only holds the low byte of, and the
+// State of any other pin.
+func ruleValue(ps gpio.PinState) int64 {
+	if ps.Dir == gpio.Counter || ps.Dir == gpio.Encoder {
+		return ps.Count
+	}
+	return int64(ps.State)
+}
+
+// comparisons are the operators conditions accept, longest first.
+var comparisons = []string{">=", "<=", "==", "!=", ">", "<"}
+
+// parseCondition parses c. Edges are only allowed in a rule's trigger.
+func parseCondition(c protocol.Condition, trigger bool) (condition, error) {
+	when := strings.ToLower(c.When)
+	cond := condition{pin: c.Pin, op: when}
+	switch when {
+	case "high":
+		cond.op = "!="
+		return cond, nil
+	case "low":
+		cond.op = "=="
+		return cond, nil
+	case "rising", "falling", "change":
+		if trigger {
+			return cond, nil
+		}
+		return cond, gpio.NewError(gpio.CodeInvalidValue, c.Pin, "Condition "+c.When+" is only allowed as a rule's trigger")
+	}
+	for _, op := range comparisons {
+		if strings.HasPrefix(when, op) {
+			// counts exceed a byte, and encoders count below zero
+			value, err := strconv.ParseInt(when[len(op):], 10, 64)
+			if err == nil {
+				cond.op = op
+				cond.value = value
+				return cond, nil
+			}
+			break
+		}
+	}
+	return cond, gpio.NewError(gpio.CodeInvalidValue, c.Pin, "Invalid condition, must be high, low, rising, falling, change or a comparison like >100 : "+c.When)
+}
+
+// edge reports whether the condition is about a change rather than a state.
+func (c condition) edge() bool {
+	switch c.op {
+	case "rising", "falling", "change":
+		return true
+	}
+	return false
+}
+
+// holds reports whether a pin's value v meets a state condition.
+func (c condition) holds(v int64) bool {
+	switch c.op {
+	case "==":
+		return v == c.value
+	case "!=":
+		return v != c.value
+	case ">":
+		return v > c.value
+	case ">=":
+		return v >= c.value
+	case "<":
+		return v < c.value
+	case "<=":
+		return v <= c.value
+	}
+	return false
+}
+
+// fires reports whether the pin's value changing to state, from prev if
+// hasPrev, triggers the condition. State conditions trigger when they start
+// to hold, so a rule runs once per change rather than on every event.
+func (c condition) fires(prev int64, hasPrev bool, state int64) bool {
+	switch c.op {
+	case "rising":
+		return hasPrev && state > prev
+	case "falling":
+		return hasPrev && state < prev
+	case "change":
+		return hasPrev && state != prev
+	}
+	return c.holds(state) && !(hasPrev && c.holds(prev))
+}
+
+// rule is a parsed protocol.Rule.
+type rule struct {
+	name string
+	protocol.Rule
+	trigger condition
+	conds   []condition
+	delay   time.Duration
+}
+
+// newRule checks a rule, which may come from a config file, and parses its
+// conditions.
+func newRule(name string, pr protocol.Rule) (*rule, error) {
+	r := &rule{name: name, Rule: pr}
+	var err error
+	if r.trigger, err = parseCondition(pr.Condition, true); err != nil {
+		return nil, err
+	}
+	for _, c := range pr.If {
+		cond, err := parseCondition(c, false)
+		if err != nil {
+			return nil, err
+		}
+		r.conds = append(r.conds, cond)
+	}
+	if pr.Delay != "" {
+		if r.delay, err = time.ParseDuration(pr.Delay); err != nil || r.delay < 0 {
+			return nil, gpio.NewError(gpio.CodeInvalidValue, "", "Invalid delay : "+pr.Delay)
+		}
+	}
+	if err := checkAction(pr.Action); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// checkRules runs the rules triggered by pin event e. It must only be called
+// from the hub goroutine.
+func (h *hub) checkRules(e *event) {
+	switch e.Type {
+	case protocol.TypePinRemoved:
+		delete(h.lastStates, e.PinId)
+		return
+	case protocol.TypePinAdded:
+		// a pin initialised, again or for the first time, starts from its
+		// state rather than changing to it
+		for _, ps := range eventPinStates(e) {
+			h.lastStates[ps.PinId] = ruleValue(ps)
+		}
+		return
+	}
+	states := eventPinStates(e)
+
+	names := make([]string, 0, len(h.rules))
+	for name := range h.rules {
+		names = append(names, name)
+	}
+	// run rules in a predictable order
+	sort.Strings(names)
+	for _, ps := range states {
+		value := ruleValue(ps)
+		prev, hasPrev := h.lastStates[ps.PinId]
+		h.lastStates[ps.PinId] = value
+		for _, name := range names {
+			r := h.rules[name]
+			if !r.Disabled && r.trigger.pin == ps.PinId && r.trigger.fires(prev, hasPrev, value) {
+				h.triggerRule(r)
+			}
+		}
+	}
+}
+
+// triggerRule runs r's action, after its delay if it has one.
+func (h *hub) triggerRule(r *rule) {
+	if r.delay == 0 {
+		h.runRule(r)
+		return
+	}
+	h.after(r.delay, func() {
+		if h.rules[r.name] != r || r.Disabled {
+			// removed, replaced or disabled meanwhile
+			return
+		}
+		if !r.trigger.edge() {
+			if state, ok := h.lastStates[r.trigger.pin]; !ok || !r.trigger.holds(state) {
+				return
+			}
+		}
+		h.runRule(r)
+	})
+}
+
+// runRule runs r's action if its conditions hold, and announces it with a
+// RuleFired event.
+func (h *hub) runRule(r *rule) {
+	for _, c := range r.conds {
+		if state, ok := h.lastStates[c.pin]; !ok || !c.holds(state) {
+			return
+		}
+	}
+	fired := protocol.RuleFired{Rule: r.name, Action: r.Action, Time: time.Now()}
+	if err := h.runAction(protocol.CmdAddRule, r.Action); err != nil {
+		e := newError(protocol.CmdAddRule, err)
+		fired.Error = &e
+	}
+	go h.sendMsg(protocol.TypeRuleFired, fired)
+}
+
+// copyRules returns a copy of the rules, safe to hand to other goroutines.
+func (h *hub) copyRules() map[string]protocol.Rule {
+	rules := make(map[string]protocol.Rule, len(h.rules))
+	for name, r := range h.rules {
+		pr := r.Rule
+		pr.If = append([]protocol.Condition{}, r.If...)
+		rules[name] = pr
+	}
+	return rules
+}
+
+// setRuleDisabled enables or disables the named rule.
+func (h *hub) setRuleDisabled(name string, disabled bool) error {
+	r, ok := h.rules[name]
+	if !ok {
+		return gpio.NewError(gpio.CodeNotFound, "", "Unknown rule "+name)
+	}
+	r.Disabled = disabled
+	go h.sendMsg(protocol.TypeRules, h.copyRules())
+	return nil
+}
+
+var ruleArg = protocol.ArgSchema{
+	Name:        "rule",
+	Type:        protocol.ArgString,
+	Description: "Rule name",
+}
+
+func init() {
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdAddRule,
+			Description: "Run an action whenever a pin changes to meet a condition, replacing any rule of the same name",
+			Args: []protocol.ArgSchema{
+				ruleArg,
+				pinArg,
+				{
+					Name:        "when",
+					Type:        protocol.ArgString,
+					Description: "high, low, rising, falling, change, or a comparison like >100",
+				},
+				{
+					Name:        "action",
+					Type:        protocol.ArgString,
+					Description: "Any number of 'if <pin> <condition>' clauses that must also hold, an optional 'after <duration>' delay, then the action: " + actionUsage,
+					Variadic:    true,
+				},
+			},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : addrule rule pin when [if pin when]... [after duration] action args...
+			pin, err := h.resolvePin(args[1])
+			if err != nil {
+				return err
+			}
+			pr := protocol.Rule{Condition: protocol.Condition{Pin: pin, When: args[2]}}
+			rest := args[3:]
+		clauses:
+			for len(rest) > 0 {
+				switch strings.ToLower(rest[0]) {
+				case "if":
+					if len(rest) < 3 {
+						return gpio.NewError(gpio.CodeInvalidArguments, "", "Usage: if <pin> <condition>")
+					}
+					pin, err := h.resolvePin(rest[1])
+					if err != nil {
+						return err
+					}
+					pr.If = append(pr.If, protocol.Condition{Pin: pin, When: rest[2]})
+					rest = rest[3:]
+				case "after":
+					if len(rest) < 2 {
+						return gpio.NewError(gpio.CodeInvalidArguments, "", "Usage: after <duration>")
+					}
+					pr.Delay = rest[1]
+					rest = rest[2:]
+				default:
+					break clauses
+				}
+			}
+			if pr.Action, err = h.parseAction(rest); err != nil {
+				return err
+			}
+			r, err := newRule(args[0], pr)
+			if err != nil {
+				return err
+			}
+			h.rules[r.name] = r
+			go h.sendMsg(protocol.TypeRules, h.copyRules())
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdDelRule,
+			Description: "Delete a rule",
+			Args:        []protocol.ArgSchema{ruleArg},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : delrule rule
+			if _, ok := h.rules[args[0]]; !ok {
+				return gpio.NewError(gpio.CodeNotFound, "", "Unknown rule "+args[0])
+			}
+			delete(h.rules, args[0])
+			go h.sendMsg(protocol.TypeRules, h.copyRules())
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdEnableRule,
+			Description: "Enable a disabled rule",
+			Args:        []protocol.ArgSchema{ruleArg},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : enablerule rule
+			return h.setRuleDisabled(args[0], false)
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdDisableRule,
+			Description: "Stop a rule from running until it is enabled again",
+			Args:        []protocol.ArgSchema{ruleArg},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : disablerule rule
+			return h.setRuleDisabled(args[0], true)
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdGetRules,
+			Description: "Reply with every rule",
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			go h.sendMsg(protocol.TypeRules, h.copyRules())
+			return nil
+		},
+	})
+}
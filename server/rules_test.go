@@ -0,0 +1,120 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+)
+
+func TestRulesOnCounts(t *testing.T) {
+	g := &gpio.GPIO{}
+	g.Init(make(chan gpio.PinState, 100), make(chan gpio.PinState, 100), make(chan string, 100), map[string]gpio.PinState{})
+	defer g.Close()
+	if err := g.PinInit("P8_07", gpio.Out, gpio.Pull_None, "P8_07"); err != nil {
+		t.Fatal(err)
+	}
+	h := newHub(g)
+	action, err := h.parseAction([]string{"setpin", "P8_07", "high"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		when   string
+		counts []int64
+		fires  bool
+	}{
+		// the low byte of 256 is 0, and of 1000 is 232
+		{"<10", []int64{100, 255, 256, 300}, false},
+		{">=1000", []int64{250, 256, 999}, false},
+		{">=1000", []int64{999, 1000}, true},
+		{"falling", []int64{254, 255, 256, 257}, false},
+		{"falling", []int64{3, 2}, true},
+		{"==-2", []int64{0, -1, -2}, true},
+	}
+	for _, test := range tests {
+		r, err := newRule("count", protocol.Rule{Condition: protocol.Condition{Pin: "P8_08", When: test.when}, Action: action})
+		if err != nil {
+			t.Fatalf("%s: %v", test.when, err)
+		}
+		h.rules = map[string]*rule{"count": r}
+		delete(h.lastStates, "P8_08")
+		if err := g.PinSet("P8_07", 0); err != nil {
+			t.Fatal(err)
+		}
+		for _, count := range test.counts {
+			h.checkRules(newPinEvent(protocol.TypePinState, gpio.PinState{PinId: "P8_08", Dir: gpio.Encoder, Count: count, State: byte(count)}))
+		}
+		states, _ := g.PinStates()
+		if fired := states["P8_07"].State == 1; fired != test.fires {
+			t.Errorf("%s over %v: fired %v, want %v", test.when, test.counts, fired, test.fires)
+		}
+	}
+}
+
+func TestRulesFireOnChanges(t *testing.T) {
+	h, g := newTestHub(t, "P8_07", "P8_08")
+	// the button starts pressed
+	if err := g.PinSet("P8_08", 1); err != nil {
+		t.Fatal(err)
+	}
+	h.seed()
+	button := gpio.PinState{PinId: "P8_08", Dir: gpio.Out, State: 1}
+	released := gpio.PinState{PinId: "P8_08", Dir: gpio.Out}
+	action, err := h.parseAction([]string{"setpin", "P8_07", "high"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newRule("press", protocol.Rule{Condition: protocol.Condition{Pin: "P8_08", When: "==1"}, Action: action})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.rules = map[string]*rule{"press": r}
+
+	tests := []struct {
+		name  string
+		event *event
+		fires bool
+	}{
+		{"state it started with", newPinEvent(protocol.TypePinState, button), false},
+		{"released", newPinEvent(protocol.TypePinState, released), false},
+		{"initialised again pressed", newPinEvent(protocol.TypePinAdded, button), false},
+		{"pressed again", newPinEvent(protocol.TypePinState, button), false},
+		{"removed", newPinRemovedEvent("P8_08"), false},
+		{"added pressed", newPinEvent(protocol.TypePinAdded, button), false},
+		{"released after adding", newPinEvent(protocol.TypePinState, released), false},
+		{"pressed after releasing", newPinEvent(protocol.TypePinState, button), true},
+	}
+	for _, test := range tests {
+		if err := g.PinSet("P8_07", 0); err != nil {
+			t.Fatal(err)
+		}
+		h.checkRules(test.event)
+		if fired := pinState(g, "P8_07") == 1; fired != test.fires {
+			t.Errorf("%s: fired %v, want %v", test.name, fired, test.fires)
+		}
+	}
+}
+
+func TestRulePinsByName(t *testing.T) {
+	pinMap, _ := (&gpio.GPIO{}).PinMap()
+	st := &State{
+		Pins: map[string]gpio.PinState{
+			"P8_07": {PinId: "P8_07", Dir: gpio.Out, Name: "lamp"},
+			"P8_08": {PinId: "P8_08", Dir: gpio.In, Name: "button"},
+			"P8_09": {PinId: "P8_09", Dir: gpio.In, Name: "door"},
+		},
+		Rules: map[string]protocol.Rule{"press": {
+			Condition: protocol.Condition{Pin: "button", When: "rising"},
+			If:        []protocol.Condition{{Pin: "door", When: "==0"}, {Pin: "TIMER4", When: "==0"}},
+		}},
+	}
+	if err := st.canonical(pinMap); err != nil {
+		t.Fatal(err)
+	}
+	r := st.Rules["press"]
+	if got := []string{r.Pin, r.If[0].Pin, r.If[1].Pin}; got[0] != "P8_08" || got[1] != "P8_09" || got[2] != "P8_07" {
+		t.Errorf("resolved pins %v, want P8_08, P8_09 and P8_07", got)
+	}
+}
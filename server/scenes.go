@@ -0,0 +1,133 @@
+package server
+
+import (
+	"sort"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+)
+
+// copyScenes returns a copy of the scenes, safe to hand to other goroutines.
+func (h *hub) copyScenes() map[string]protocol.Scene {
+	scenes := make(map[string]protocol.Scene, len(h.scenes))
+	for name, values := range h.scenes {
+		scene := make(protocol.Scene, len(values))
+		for pin, value := range values {
+			scene[pin] = value
+		}
+		scenes[name] = scene
+	}
+	return scenes
+}
+
+// applyScene writes the pins of a scene as one operation, announced with a
+// SceneApplied event. It must only be called from the hub goroutine.
+func (h *hub) applyScene(cmd string, name string) error {
+	scene, ok := h.scenes[name]
+	if !ok {
+		return gpio.NewError(gpio.CodeNotFound, "", "Unknown scene "+name)
+	}
+	writes := make([]pinWrite, 0, len(scene))
+	for pin, value := range scene {
+		writes = append(writes, pinWrite{pin, value})
+	}
+	// write in a predictable order
+	sort.Slice(writes, func(i, j int) bool { return writes[i].pinId < writes[j].pinId })
+	b := newPinBatch(protocol.TypeSceneApplied, writes)
+	b.changed.Scene = name
+	return h.setPins(cmd, b)
+}
+
+var sceneArg = protocol.ArgSchema{
+	Name:        "scene",
+	Type:        protocol.ArgString,
+	Description: "Scene name",
+}
+
+func init() {
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdSaveScene,
+			Description: "Save the current state of output and PWM pins as a scene, replacing any of the same name",
+			Args: []protocol.ArgSchema{
+				sceneArg,
+				{
+					Name:        "pin",
+					Type:        protocol.ArgPin,
+					Description: "Pins to save, defaults to every output and PWM pin",
+					Optional:    true,
+					Variadic:    true,
+				},
+			},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : savescene scene [pin ...]
+			pinStates, err := h.gpio.PinStates()
+			if err != nil {
+				return err
+			}
+			scene := make(protocol.Scene)
+			if len(args) == 1 {
+				for pinId, ps := range pinStates {
+					if ps.Dir == gpio.Out || ps.Dir == gpio.PWM || ps.Dir == gpio.Servo {
+						scene[pinId] = ps.State
+					}
+				}
+			}
+			for _, arg := range args[1:] {
+				pin, err := h.resolvePin(arg)
+				if err != nil {
+					return err
+				}
+				ps, ok := pinStates[pin]
+				if !ok {
+					return gpio.NewError(gpio.CodeUnknownPin, pin, "Pin "+pin+" is not initialised")
+				}
+				if ps.Dir != gpio.Out && ps.Dir != gpio.PWM && ps.Dir != gpio.Servo {
+					return gpio.NewError(gpio.CodeUnsupported, pin, "Pin "+pin+" is an input")
+				}
+				scene[pin] = ps.State
+			}
+			h.scenes[args[0]] = scene
+			go h.sendMsg(protocol.TypeScenes, h.copyScenes())
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdApplyScene,
+			Description: "Set every pin of a scene at once, rolling all of them back if any fails",
+			Args:        []protocol.ArgSchema{sceneArg},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : applyscene scene
+			return h.applyScene(protocol.CmdApplyScene, args[0])
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdDelScene,
+			Description: "Delete a scene, leaving the pins as they are",
+			Args:        []protocol.ArgSchema{sceneArg},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : delscene scene
+			if _, ok := h.scenes[args[0]]; !ok {
+				return gpio.NewError(gpio.CodeNotFound, "", "Unknown scene "+args[0])
+			}
+			delete(h.scenes, args[0])
+			go h.sendMsg(protocol.TypeScenes, h.copyScenes())
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdGetScenes,
+			Description: "Reply with every scene and its pin values",
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			go h.sendMsg(protocol.TypeScenes, h.copyScenes())
+			return nil
+		},
+	})
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+)
+
+// runCmd runs a command as if a client sent it, and returns the message the
+// hub sends in reply.
+func runCmd(t *testing.T, h *hub, cmd string) *event {
+	t.Helper()
+	h.checkCmd(nil, []byte(cmd))
+	select {
+	case e := <-h.broadcastSys:
+		return e
+	case <-time.After(time.Second):
+		t.Fatalf("%s: no reply", cmd)
+		return nil
+	}
+}
+
+func TestSaveScene(t *testing.T) {
+	h, g := newTestHub(t, "P8_07")
+	g.PinInit("P8_08", gpio.PWM, gpio.Pull_None, "dimmer")
+	g.PinInit("P8_09", gpio.In, gpio.Pull_None, "button")
+	g.PinSet("P8_07", 1)
+	g.PinSet("P8_08", 128)
+
+	tests := []struct {
+		cmd  string
+		want protocol.Scene
+		code gpio.ErrorCode
+	}{
+		// every output and PWM pin, but no input
+		{"savescene evening", protocol.Scene{"P8_07": 1, "P8_08": 128}, ""},
+		{"savescene dim dimmer", protocol.Scene{"P8_08": 128}, ""},
+		{"savescene both P8_08 P8_07", protocol.Scene{"P8_07": 1, "P8_08": 128}, ""},
+		{"savescene pressed button", nil, gpio.CodeUnsupported},
+		{"savescene missing P8_10", nil, gpio.CodeUnknownPin},
+	}
+	for _, test := range tests {
+		e := runCmd(t, h, test.cmd)
+		if test.code != "" {
+			if err, ok := e.payload.(protocol.Error); !ok || err.Code != test.code {
+				t.Errorf("%s: got %s %v, want a %s error", test.cmd, e.Type, e.payload, test.code)
+			}
+			continue
+		}
+		scenes, ok := e.payload.(map[string]protocol.Scene)
+		if !ok {
+			t.Errorf("%s: got %s %v, want Scenes", test.cmd, e.Type, e.payload)
+			continue
+		}
+		if name := strings.Fields(test.cmd)[1]; !reflect.DeepEqual(scenes[name], test.want) {
+			t.Errorf("%s: got scenes %v, want %v", test.cmd, scenes, test.want)
+		}
+	}
+	if _, ok := h.scenes["pressed"]; ok {
+		t.Error("saved a scene that failed")
+	}
+}
+
+func TestApplyScene(t *testing.T) {
+	h, g := newTestHub(t, "P8_07", "P8_09")
+	g.PinInit("P8_08", gpio.PWM, gpio.Pull_None, "dimmer")
+	h.scenes["evening"] = protocol.Scene{"P8_07": 1, "P8_08": 64}
+	h.scenes["broken"] = protocol.Scene{"P8_07": 1, "P8_09": 64}
+
+	// the pump is sent each batch as it starts and again when done
+	batches := make(chan *pinBatch, 4)
+	go func() {
+		for i := 0; i < cap(batches); i++ {
+			batches <- <-h.batches
+		}
+	}()
+	if err := h.applyScene(protocol.CmdApplyScene, "evening"); err != nil {
+		t.Fatal(err)
+	}
+	b := <-batches
+	<-batches
+	if b.typ != protocol.TypeSceneApplied || b.changed.Scene != "evening" {
+		t.Errorf("got a %s batch for scene %q, want SceneApplied for evening", b.typ, b.changed.Scene)
+	}
+	if pinState(g, "P8_07") != 1 || pinState(g, "P8_08") != 64 {
+		t.Errorf("got P8_07 %d and P8_08 %d, want 1 and 64", pinState(g, "P8_07"), pinState(g, "P8_08"))
+	}
+
+	// a scene that can't be written leaves the pins as they were
+	g.PinSet("P8_07", 0)
+	if err := h.applyScene(protocol.CmdApplyScene, "broken"); err != nil {
+		t.Fatal(err)
+	}
+	b = <-batches
+	<-batches
+	if b.err == nil || pinState(g, "P8_07") != 0 || pinState(g, "P8_09") != 0 {
+		t.Errorf("got P8_07 %d and P8_09 %d and error %v, want both 0 and an error", pinState(g, "P8_07"), pinState(g, "P8_09"), b.err)
+	}
+
+	if err := h.applyScene(protocol.CmdApplyScene, "morning"); gpio.CodeOf(err) != gpio.CodeNotFound {
+		t.Errorf("applying an unknown scene: got %v, want a NotFound error", err)
+	}
+}
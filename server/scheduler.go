@@ -0,0 +1,173 @@
+package server
+
+import (
+	"strings"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+)
+
+// job is a scheduled action, and the timer that runs it next.
+type job struct {
+	name string
+	protocol.Job
+	sched schedule
+	timer *time.Timer
+}
+
+// newJob checks a job, which may come from a config file, and parses its
+// schedule.
+func newJob(name string, pj protocol.Job) (*job, error) {
+	sched, err := parseSchedule(pj.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	if sched.next(time.Now()).IsZero() {
+		return nil, gpio.NewError(gpio.CodeInvalidValue, "", "Schedule never runs : "+pj.Schedule)
+	}
+	if err := checkAction(pj.Action); err != nil {
+		return nil, err
+	}
+	pj.Next = nil
+	return &job{name: name, Job: pj, sched: sched}, nil
+}
+
+// addJob schedules j, replacing any job of the same name. It must only be
+// called from the hub goroutine, or before the hub runs.
+func (h *hub) addJob(j *job) {
+	h.removeJob(j.name)
+	h.jobs[j.name] = j
+	h.scheduleJob(j)
+}
+
+// removeJob unschedules the named job, if there is one.
+func (h *hub) removeJob(name string) bool {
+	j, ok := h.jobs[name]
+	if !ok {
+		return false
+	}
+	if j.timer != nil {
+		j.timer.Stop()
+	}
+	delete(h.jobs, name)
+	return true
+}
+
+func (h *hub) scheduleJob(j *job) {
+	next := j.sched.next(time.Now())
+	if next.IsZero() {
+		j.Next = nil
+		return
+	}
+	j.Next = &next
+	j.timer = h.after(time.Until(next), func() {
+		h.runJob(j)
+	})
+}
+
+// runJob runs j's action, announces it with a JobFired event and schedules
+// its next run.
+func (h *hub) runJob(j *job) {
+	if h.jobs[j.name] != j {
+		// removed or replaced since this run was scheduled
+		return
+	}
+	fired := protocol.JobFired{Job: j.name, Action: j.Action, Time: time.Now()}
+	if err := h.runAction(protocol.CmdAddJob, j.Action); err != nil {
+		e := newError(protocol.CmdAddJob, err)
+		fired.Error = &e
+	}
+	go h.sendMsg(protocol.TypeJobFired, fired)
+	h.scheduleJob(j)
+}
+
+// copyJobs returns a copy of the jobs, safe to hand to other goroutines.
+func (h *hub) copyJobs() map[string]protocol.Job {
+	jobs := make(map[string]protocol.Job, len(h.jobs))
+	for name, j := range h.jobs {
+		jobs[name] = j.Job
+	}
+	return jobs
+}
+
+func init() {
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdAddJob,
+			Description: "Schedule an action, replacing any job of the same name",
+			Args: []protocol.ArgSchema{
+				{
+					Name:        "job",
+					Type:        protocol.ArgString,
+					Description: "Job name",
+				},
+				{
+					Name:        "schedule",
+					Type:        protocol.ArgString,
+					Description: "Cron expression (minute hour day month weekday), @hourly, @daily, @weekly, @monthly, @yearly or @every <duration>; may contain spaces",
+				},
+				{
+					Name:        "action",
+					Type:        protocol.ArgString,
+					Description: "The action to run: " + actionUsage,
+					Variadic:    true,
+				},
+			},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : addjob job schedule... action args...
+			split := -1
+			for i := 2; i < len(args); i++ {
+				if isAction(args[i]) {
+					split = i
+					break
+				}
+			}
+			if split < 0 {
+				return gpio.NewError(gpio.CodeInvalidArguments, "", "Missing action, must be "+actionUsage)
+			}
+			action, err := h.parseAction(args[split:])
+			if err != nil {
+				return err
+			}
+			pj := protocol.Job{Schedule: strings.Join(args[1:split], " "), Action: action}
+			j, err := newJob(args[0], pj)
+			if err != nil {
+				return err
+			}
+			h.addJob(j)
+			go h.sendMsg(protocol.TypeJobs, h.copyJobs())
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdDelJob,
+			Description: "Delete a scheduled job",
+			Args: []protocol.ArgSchema{{
+				Name:        "job",
+				Type:        protocol.ArgString,
+				Description: "Job name",
+			}},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : deljob job
+			if !h.removeJob(args[0]) {
+				return gpio.NewError(gpio.CodeNotFound, "", "Unknown job "+args[0])
+			}
+			go h.sendMsg(protocol.TypeJobs, h.copyJobs())
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdGetJobs,
+			Description: "Reply with every scheduled job and when it runs next",
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			go h.sendMsg(protocol.TypeJobs, h.copyJobs())
+			return nil
+		},
+	})
+}
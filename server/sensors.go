@@ -0,0 +1,433 @@
+package server
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+	"github.com/benjamind/gpio-json-server/sensor"
+)
+
+// sensorDriver is a running sensor driver, read by its own goroutine.
+type sensorDriver struct {
+	name     string
+	config   sensor.Config
+	driver   sensor.Driver
+	interval time.Duration
+
+	// Set for the driver added from the server's W1Dir, which isn't saved.
+	builtin bool
+
+	// Ids of the sensors it has reported, and whether its last read failed
+	// as a whole, so failures are only logged once.
+	ids     map[string]bool
+	failing bool
+
+	// Closed to stop reading, then done is closed once the driver is.
+	stop chan struct{}
+	done chan struct{}
+}
+
+// sensorReadings are the results of one read of a driver.
+type sensorReadings struct {
+	d        *sensorDriver
+	readings []sensor.Reading
+	err      error
+}
+
+// addSensor opens a sensor driver and starts reading it, replacing any of
+// the same name, then calls done with the result. The driver replaced is
+// stopped first, as the new one may need its pins or bus, and the new one is
+// only opened once it has closed, which is waited for off the hub goroutine.
+// Should the new one fail, the one it replaced is opened again. It must only
+// be called from the hub goroutine.
+func (h *hub) addSensor(name string, c sensor.Config, builtin bool, done func(error)) {
+	h.replaceSensor(name, c, builtin, h.sensorDrivers[name], done)
+}
+
+// replaceSensor stops any driver of the given name and opens c once it has
+// closed, opening old again should c fail.
+func (h *hub) replaceSensor(name string, c sensor.Config, builtin bool, old *sensorDriver, done func(error)) {
+	h.removeSensor(name)
+	if closing, ok := h.closingSensors[name]; ok {
+		select {
+		case <-closing:
+			delete(h.closingSensors, name)
+		default:
+			go func() {
+				<-closing
+				select {
+				case h.deferred <- func() { h.replaceSensor(name, c, builtin, old, done) }:
+				case <-h.done:
+				}
+			}()
+			return
+		}
+	}
+	err := h.openSensor(name, c, builtin)
+	if err != nil && old != nil {
+		if err := h.openSensor(name, old.config, old.builtin); err != nil {
+			log.Println("Failed to reopen sensor " + name + " : " + err.Error())
+		}
+	}
+	done(err)
+}
+
+// openSensor opens a sensor driver and starts reading it. It must only be
+// called from the hub goroutine, or before the hub runs, when no driver of
+// the same name is open.
+func (h *hub) openSensor(name string, c sensor.Config, builtin bool) error {
+	// nil, when the backend's pins can't be claimed
+	pins, _ := h.gpio.(gpio.Claimer)
+	driver, err := sensor.Open(name, c, pins)
+	if err != nil {
+		return err
+	}
+	interval := h.sensorInterval
+	if c.Interval != "" {
+		// already checked by Open
+		interval, _ = time.ParseDuration(c.Interval)
+	}
+	d := &sensorDriver{
+		name:     name,
+		config:   c,
+		driver:   driver,
+		interval: interval,
+		builtin:  builtin,
+		ids:      make(map[string]bool),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	h.sensorDrivers[name] = d
+	go h.readSensor(d)
+	return nil
+}
+
+// removeSensor stops the named sensor driver, if there is one, and forgets
+// the sensors it reported. The driver is closed by its own goroutine, which
+// closes its done channel, kept in closingSensors, once it has.
+func (h *hub) removeSensor(name string) bool {
+	d, ok := h.sensorDrivers[name]
+	if !ok {
+		return false
+	}
+	close(d.stop)
+	h.closingSensors[name] = d.done
+	for id := range d.ids {
+		delete(h.sensors, id)
+	}
+	delete(h.sensorDrivers, name)
+	return true
+}
+
+// stopSensors stops reading every sensor driver, keeping their last
+// readings, and closes sensorsClosed once every driver has been closed.
+func (h *hub) stopSensors() {
+	var closing []chan struct{}
+	for _, d := range h.sensorDrivers {
+		close(d.stop)
+		closing = append(closing, d.done)
+	}
+	for _, done := range h.closingSensors {
+		closing = append(closing, done)
+	}
+	go func() {
+		for _, done := range closing {
+			<-done
+		}
+		close(h.sensorsClosed)
+	}()
+}
+
+// readSensor reads d every interval and sends the readings to the hub, until
+// d is stopped, then closes it.
+func (h *hub) readSensor(d *sensorDriver) {
+	defer func() {
+		if err := d.driver.Close(); err != nil {
+			log.Println("Failed to close sensor " + d.name + " : " + err.Error())
+		}
+		close(d.done)
+	}()
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		readings, err := d.driver.Read()
+		select {
+		case h.readings <- sensorReadings{d, readings, err}:
+		case <-d.stop:
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// updateSensors records the readings of a driver and sends a SensorReading
+// event for each. A failed sensor keeps its last good value. It must only
+// be called from the hub goroutine.
+func (h *hub) updateSensors(r sensorReadings) {
+	d := r.d
+	if h.sensorDrivers[d.name] != d {
+		// removed or replaced since it was read
+		return
+	}
+	readings := r.readings
+	if r.err != nil {
+		if !d.failing {
+			log.Println("Failed to read sensor " + d.name + " : " + r.err.Error())
+		}
+		d.failing = true
+		// every sensor the driver reported so far is now bad
+		readings = nil
+		for id := range d.ids {
+			reading := h.sensors[id]
+			reading.Quality = sensor.QualityBad
+			reading.Error = r.err.Error()
+			readings = append(readings, reading)
+		}
+	} else if d.failing {
+		log.Println("Sensor " + d.name + " is reading again")
+		d.failing = false
+	}
+
+	for _, reading := range readings {
+		prev, seen := h.sensors[reading.Id]
+		if !seen {
+			log.Println(strings.TrimSpace("Found sensor " + reading.Id + " " + reading.Model))
+		}
+		if reading.Quality == sensor.QualityBad {
+			if seen {
+				reading.Value, reading.Time = prev.Value, prev.Time
+			}
+			if r.err == nil && prev.Quality != sensor.QualityBad {
+				log.Println("Failed to read sensor " + reading.Id + " : " + reading.Error)
+			}
+		} else if prev.Quality == sensor.QualityBad {
+			log.Println("Sensor " + reading.Id + " is reading again")
+		}
+		h.sensors[reading.Id] = reading
+		d.ids[reading.Id] = true
+		go h.sendMsg(protocol.TypeSensorReading, reading)
+	}
+}
+
+// copySensors returns a copy of the last reading of every sensor, safe to
+// hand to other goroutines.
+func (h *hub) copySensors() map[string]sensor.Reading {
+	sensors := make(map[string]sensor.Reading, len(h.sensors))
+	for id, reading := range h.sensors {
+		sensors[id] = reading
+	}
+	return sensors
+}
+
+// copySensorConfigs returns a copy of the configuration of every sensor
+// driver, safe to hand to other goroutines. Unless all is set, the builtin
+// driver is left out.
+func (h *hub) copySensorConfigs(all bool) map[string]sensor.Config {
+	configs := make(map[string]sensor.Config, len(h.sensorDrivers))
+	for name, d := range h.sensorDrivers {
+		if d.builtin && !all {
+			continue
+		}
+		c := d.config
+		c.Options = make(map[string]string, len(d.config.Options))
+		for key, value := range d.config.Options {
+			c.Options[key] = value
+		}
+		configs[name] = c
+	}
+	return configs
+}
+
+// scale returns the named sensor driver, which must be a scale.
+func (h *hub) scale(name string) (*sensorDriver, sensor.Scale, error) {
+	d, ok := h.sensorDrivers[name]
+	if !ok {
+		return nil, nil, gpio.NewError(gpio.CodeNotFound, "", "Unknown sensor driver "+name)
+	}
+	scale, ok := d.driver.(sensor.Scale)
+	if !ok {
+		return nil, nil, gpio.NewError(gpio.CodeUnsupported, "", "Sensor driver "+name+" is not a scale")
+	}
+	return d, scale, nil
+}
+
+// setSensorOptions records options of a running driver, so they are saved
+// with it, and sends the configuration of every driver.
+func (h *hub) setSensorOptions(d *sensorDriver, options map[string]string) {
+	if d.config.Options == nil {
+		d.config.Options = make(map[string]string)
+	}
+	for key, value := range options {
+		d.config.Options[key] = value
+	}
+	go h.sendMsg(protocol.TypeSensorConfigs, h.copySensorConfigs(true))
+}
+
+var sensorNameArg = protocol.ArgSchema{
+	Name:        "name",
+	Type:        protocol.ArgString,
+	Description: "Sensor driver name",
+}
+
+func init() {
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdGetSensors,
+			Description: "Reply with the last reading of every sensor",
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			go h.sendMsg(protocol.TypeSensors, h.copySensors())
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdGetSensor,
+			Description: "Reply with the last reading of one sensor",
+			Args: []protocol.ArgSchema{{
+				Name:        "sensor",
+				Type:        protocol.ArgString,
+				Description: "Sensor id",
+			}},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : getsensor id
+			reading, ok := h.sensors[args[0]]
+			if !ok {
+				return gpio.NewError(gpio.CodeNotFound, "", "Unknown sensor "+args[0])
+			}
+			go h.sendMsg(protocol.TypeSensor, reading)
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdAddSensor,
+			Description: "Start reading sensors with a driver, replacing any of the same name",
+			Args: []protocol.ArgSchema{
+				sensorNameArg,
+				{
+					Name:        "driver",
+					Type:        protocol.ArgString,
+					Description: "Sensor driver, such as w1therm",
+				},
+				{
+					Name:        "option",
+					Type:        protocol.ArgString,
+					Description: "Driver options as key=value, and interval=<duration> to read it more or less often",
+					Optional:    true,
+					Variadic:    true,
+				},
+			},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : addsensor name driver [key=value ...]
+			config := sensor.Config{Driver: strings.ToLower(args[1]), Options: make(map[string]string)}
+			for _, arg := range args[2:] {
+				i := strings.Index(arg, "=")
+				if i <= 0 {
+					return gpio.NewError(gpio.CodeInvalidArguments, "", "Invalid option, must be key=value : "+arg)
+				}
+				if key := strings.ToLower(arg[:i]); key == "interval" {
+					config.Interval = arg[i+1:]
+				} else {
+					config.Options[key] = arg[i+1:]
+				}
+			}
+			h.addSensor(args[0], config, false, func(err error) {
+				if err != nil {
+					go h.sendErr(protocol.CmdAddSensor, err)
+					return
+				}
+				go h.sendMsg(protocol.TypeSensorConfigs, h.copySensorConfigs(true))
+			})
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdDelSensor,
+			Description: "Stop reading sensors with a driver, and forget them",
+			Args:        []protocol.ArgSchema{sensorNameArg},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : delsensor name
+			if !h.removeSensor(args[0]) {
+				return gpio.NewError(gpio.CodeNotFound, "", "Unknown sensor driver "+args[0])
+			}
+			go h.sendMsg(protocol.TypeSensorConfigs, h.copySensorConfigs(true))
+			go h.sendMsg(protocol.TypeSensors, h.copySensors())
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdTare,
+			Description: "Make a scale read its current weight as zero",
+			Args:        []protocol.ArgSchema{sensorNameArg},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : tare name
+			d, scale, err := h.scale(args[0])
+			if err != nil {
+				return err
+			}
+			options, err := scale.Tare()
+			if err != nil {
+				return err
+			}
+			h.setSensorOptions(d, options)
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdCalibrate,
+			Description: "Make a scale read its current weight over the tare as a known weight",
+			Args: []protocol.ArgSchema{
+				sensorNameArg,
+				{
+					Name:        "weight",
+					Type:        protocol.ArgString,
+					Description: "Known weight on the scale, in its unit",
+				},
+			},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : calibrate name weight
+			d, scale, err := h.scale(args[0])
+			if err != nil {
+				return err
+			}
+			weight, err := strconv.ParseFloat(args[1], 64)
+			if err != nil {
+				return gpio.NewError(gpio.CodeInvalidValue, "", "Invalid weight : "+args[1])
+			}
+			options, err := scale.Calibrate(weight)
+			if err != nil {
+				return err
+			}
+			h.setSensorOptions(d, options)
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdGetSensorConfigs,
+			Description: "Reply with the configuration of every sensor driver",
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			go h.sendMsg(protocol.TypeSensorConfigs, h.copySensorConfigs(true))
+			return nil
+		},
+	})
+}
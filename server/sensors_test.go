@@ -0,0 +1,151 @@
+package server
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/sensor"
+)
+
+// busDriver is a sensor driver holding a bus only one driver can have open
+// at a time, as a driver bit-banging pins does.
+type busDriver struct {
+	bus *fakeBus
+}
+
+func (d *busDriver) Read() ([]sensor.Reading, error) {
+	return nil, nil
+}
+
+func (d *busDriver) Close() error {
+	if d.bus.release != nil {
+		<-d.bus.release
+	}
+	d.bus.mu.Lock()
+	defer d.bus.mu.Unlock()
+	d.bus.open = false
+	return nil
+}
+
+type fakeBus struct {
+	mu   sync.Mutex
+	open bool
+	// the options of every driver opened
+	opened []string
+	// if set, drivers only close once it is closed
+	release chan struct{}
+}
+
+// addSensor adds a sensor driver as the hub would, running anything it has
+// the hub run later, and returns the result.
+func addSensor(t *testing.T, h *hub, name string, c sensor.Config) error {
+	t.Helper()
+	result := make(chan error, 1)
+	h.addSensor(name, c, false, func(err error) { result <- err })
+	for {
+		select {
+		case err := <-result:
+			return err
+		case f := <-h.deferred:
+			f()
+		case <-time.After(time.Second):
+			t.Fatal("sensor driver never added")
+		}
+	}
+}
+
+// registerBus registers the testbus sensor driver, opening drivers on bus.
+func registerBus(bus *fakeBus) {
+	sensor.Register("testbus", func(name string, options map[string]string, pins gpio.Claimer) (sensor.Driver, error) {
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+		if options["fail"] != "" {
+			return nil, gpio.NewError(gpio.CodeInvalidValue, "", "Invalid option fail")
+		}
+		if bus.open {
+			return nil, gpio.NewError(gpio.CodeUnsupported, "", "The bus is in use")
+		}
+		bus.open = true
+		bus.opened = append(bus.opened, options["id"])
+		return &busDriver{bus}, nil
+	})
+}
+
+func TestAddSensorReplaces(t *testing.T) {
+	bus := &fakeBus{}
+	registerBus(bus)
+	h := newHub(&gpio.GPIO{})
+	h.sensorInterval = time.Second
+	// readings aren't consumed, so drivers wait to send their first
+	if err := addSensor(t, h, "scale", sensor.Config{Driver: "testbus", Options: map[string]string{"id": "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := addSensor(t, h, "scale", sensor.Config{Driver: "testbus", Options: map[string]string{"id": "2"}}); err != nil {
+		t.Fatalf("replacing a driver: %v", err)
+	}
+	if h.sensorDrivers["scale"].config.Options["id"] != "2" {
+		t.Errorf("got driver %v, want the second", h.sensorDrivers["scale"].config.Options)
+	}
+
+	// a replacement that fails to open leaves the driver it replaced
+	err := addSensor(t, h, "scale", sensor.Config{Driver: "testbus", Options: map[string]string{"id": "3", "fail": "yes"}})
+	if gpio.CodeOf(err) != gpio.CodeInvalidValue {
+		t.Errorf("got %v, want an InvalidValue error", err)
+	}
+	if d, ok := h.sensorDrivers["scale"]; !ok || d.config.Options["id"] != "2" {
+		t.Errorf("got driver %v after a failed replacement, want the second", h.sensorDrivers["scale"])
+	}
+
+	if !h.removeSensor("scale") {
+		t.Fatal("no driver to remove")
+	}
+	h.stopSensors()
+	<-h.sensorsClosed
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	if bus.open {
+		t.Error("removed driver left open")
+	}
+	if want := []string{"1", "2", "2"}; len(bus.opened) != len(want) || bus.opened[0] != want[0] || bus.opened[1] != want[1] || bus.opened[2] != want[2] {
+		t.Errorf("opened %v, want %v", bus.opened, want)
+	}
+}
+
+func TestAddSensorWaitsForClose(t *testing.T) {
+	bus := &fakeBus{release: make(chan struct{})}
+	registerBus(bus)
+	h := newHub(&gpio.GPIO{})
+	h.sensorInterval = time.Second
+	if err := h.openSensor("scale", sensor.Config{Driver: "testbus", Options: map[string]string{"id": "1"}}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// the hub isn't held up while the driver replaced closes
+	result := make(chan error, 1)
+	h.addSensor("scale", sensor.Config{Driver: "testbus", Options: map[string]string{"id": "2"}}, false, func(err error) { result <- err })
+	if _, ok := h.sensorDrivers["scale"]; ok {
+		t.Fatal("replacement opened before the driver it replaces closed")
+	}
+	close(bus.release)
+	runDeferred(t, h)
+	if err := <-result; err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := h.sensorDrivers["scale"]; !ok || d.config.Options["id"] != "2" {
+		t.Errorf("got driver %v, want the second", h.sensorDrivers["scale"])
+	}
+
+	h.stopSensors()
+	select {
+	case <-h.sensorsClosed:
+	case <-time.After(time.Second):
+		t.Fatal("sensors never closed after stopping")
+	}
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	if bus.open {
+		t.Error("stopped driver left open")
+	}
+}
@@ -0,0 +1,372 @@
+// Package server exposes a GPIO backend to websocket clients.
+//
+// A Server owns the hub that all websocket connections are registered with,
+// relays pin events from the backend and sensor readings to every client, and
+// persists pin states, groups, scenes, jobs and rules between runs. Mount Handler on any
+// http server to embed it.
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+	"github.com/benjamind/gpio-json-server/sensor"
+)
+
+// Version is reported to clients when they connect.
+var Version = "1.11"
+
+// DefaultStateFile is where pin states are persisted unless a Server is
+// configured otherwise.
+const DefaultStateFile = "pinstates.json"
+
+// Default connection settings.
+const (
+	DefaultPingInterval   = 50 * time.Second
+	DefaultPongWait       = 60 * time.Second
+	DefaultWriteTimeout   = 10 * time.Second
+	DefaultMaxMessageSize = 8192
+)
+
+// DefaultSensorInterval is how often sensors are read unless a Server is
+// configured otherwise.
+const DefaultSensorInterval = 10 * time.Second
+
+// Server serves a GPIO backend over websockets.
+type Server struct {
+	// StateFile is the file pin states are restored from on Start and saved
+	// to on Close. Leave empty to disable persistence.
+	StateFile string
+
+	// ConfigFile is an optional file, in the same format as the state file,
+	// declaring the pins, groups, scenes, jobs, rules, sensors and steppers
+	// the server starts with. When given, the state file only restores the
+	// values of the pins it declares, and the tare and calibration of its
+	// scales, so anything declared by commands lasts until the server stops.
+	ConfigFile string
+
+	// PingInterval is how often each connection is pinged. A connection that
+	// sends nothing, not even a pong, for PongWait is dropped. Both must be
+	// positive and PingInterval shorter than PongWait, or Start fails.
+	PingInterval time.Duration
+	PongWait     time.Duration
+
+	// WriteTimeout bounds every write to a connection.
+	WriteTimeout time.Duration
+
+	// MaxMessageSize is the largest message accepted from a client; larger
+	// messages drop the connection.
+	MaxMessageSize int64
+
+	// W1Dir is the directory 1-Wire thermometers are discovered in, unless
+	// the config or state file declares a w1therm sensor driver. Leave it
+	// empty to disable them.
+	W1Dir string
+
+	// SensorInterval is how often sensors are read, unless their driver is
+	// configured otherwise. It must be positive.
+	SensorInterval time.Duration
+
+	gpio    gpio.GPIOInterface
+	hub     *hub
+	started bool
+
+	// Drain requests for the event pump, closed once its queue is empty.
+	drain chan chan struct{}
+
+	// Closed once the backend is closed, to stop the event pump.
+	quit chan struct{}
+}
+
+// New creates a server driving the given GPIO backend.
+func New(g gpio.GPIOInterface) *Server {
+	return &Server{
+		StateFile:      DefaultStateFile,
+		PingInterval:   DefaultPingInterval,
+		PongWait:       DefaultPongWait,
+		WriteTimeout:   DefaultWriteTimeout,
+		MaxMessageSize: DefaultMaxMessageSize,
+		W1Dir:          sensor.DefaultW1Dir,
+		SensorInterval: DefaultSensorInterval,
+		gpio:           g,
+		hub:            newHub(g),
+		drain:          make(chan chan struct{}),
+		quit:           make(chan struct{}),
+	}
+}
+
+// Start restores any persisted pin states, starts reading sensors,
+// initialises the GPIO backend with the pin states and launches the hub.
+func (s *Server) Start() error {
+	if err := s.checkConfig(); err != nil {
+		return err
+	}
+	stateChanged := make(chan gpio.PinState)
+	pinRemoved := make(chan string)
+	pinAdded := make(chan gpio.PinState)
+
+	// states saved by older versions, and config files, may use aliases
+	pinMap, _ := s.gpio.PinMap()
+	state, err := s.loadState(pinMap)
+	if err != nil {
+		return err
+	}
+	s.hub.groups = state.Groups
+	s.hub.scenes = state.Scenes
+	for name, pj := range state.Jobs {
+		j, err := newJob(name, pj)
+		if err != nil {
+			log.Println("Invalid job " + name + " : " + err.Error())
+			return err
+		}
+		s.hub.addJob(j)
+	}
+	for name, pr := range state.Rules {
+		r, err := newRule(name, pr)
+		if err != nil {
+			log.Println("Invalid rule " + name + " : " + err.Error())
+			return err
+		}
+		s.hub.rules[name] = r
+	}
+	s.hub.sensorInterval = s.SensorInterval
+	for name, c := range state.Sensors {
+		if err := s.hub.openSensor(name, c, false); err != nil {
+			log.Println("Invalid sensor " + name + " : " + err.Error())
+			return err
+		}
+	}
+	for name, ps := range state.Steppers {
+		st, err := newStepper(name, ps)
+		if err != nil {
+			log.Println("Invalid stepper " + name + " : " + err.Error())
+			return err
+		}
+		s.hub.steppers[name] = st
+	}
+	if s.W1Dir != "" && !hasDriver(state.Sensors, "w1") {
+		c := sensor.Config{Driver: "w1therm", Options: map[string]string{"dir": s.W1Dir}}
+		if err := s.hub.openSensor("w1", c, true); err != nil {
+			return err
+		}
+	}
+
+	// the backend reports the pins it restores as it initialises, before
+	// anyone can connect to hear it, so those events are dropped and the hub
+	// starts from the states the backend ends up with instead
+	initialised := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stateChanged:
+			case <-pinAdded:
+			case <-pinRemoved:
+			case <-initialised:
+				return
+			}
+		}
+	}()
+	err = s.gpio.Init(stateChanged, pinAdded, pinRemoved, state.Pins)
+	close(initialised)
+	if err != nil {
+		return err
+	}
+	go s.pump(stateChanged, pinAdded, pinRemoved)
+	// launch the hub routine which is the singleton for the websocket server
+	go s.hub.run()
+	s.started = true
+	return nil
+}
+
+// checkConfig verifies the server's settings, which would otherwise fail
+// once connections or sensors use them.
+func (s *Server) checkConfig() error {
+	if s.PingInterval <= 0 {
+		return errors.New("ping interval must be positive : " + s.PingInterval.String())
+	}
+	if s.PongWait <= s.PingInterval {
+		return errors.New("pong wait must be longer than the ping interval : " + s.PongWait.String() + " <= " + s.PingInterval.String())
+	}
+	if s.WriteTimeout <= 0 {
+		return errors.New("write timeout must be positive : " + s.WriteTimeout.String())
+	}
+	if s.SensorInterval <= 0 {
+		return errors.New("sensor interval must be positive : " + s.SensorInterval.String())
+	}
+	return nil
+}
+
+// hasDriver reports whether sensors declares a driver named name, or any
+// w1therm driver.
+func hasDriver(sensors map[string]sensor.Config, name string) bool {
+	for n, c := range sensors {
+		if n == name || strings.ToLower(c.Driver) == "w1therm" {
+			return true
+		}
+	}
+	return false
+}
+
+// pump queues the events reported by the GPIO backend and forwards them to
+// the hub in order, so the backend never blocks on a busy hub. While the hub
+// writes a batch of pins, their PinState events are collected into a single
+// PinsChanged event.
+func (s *Server) pump(stateChanged, pinAdded chan gpio.PinState, pinRemoved chan string) {
+	var queue []*event
+	var drained []chan struct{}
+	var batch *pinBatch
+	hubDone := s.hub.done
+	for {
+		if hubDone == nil {
+			// the hub has returned, leaving nobody to deliver events to
+			queue = nil
+		}
+		var out chan *event
+		var next *event
+		if len(queue) > 0 {
+			out = s.hub.broadcastSys
+			next = queue[0]
+		} else {
+			for _, d := range drained {
+				close(d)
+			}
+			drained = nil
+		}
+
+		select {
+		case pinState := <-stateChanged:
+			if batch != nil && batch.add(pinState) {
+				continue
+			}
+			queue = append(queue, newPinEvent(protocol.TypePinState, pinState))
+		case b := <-s.hub.batches:
+			// batches are sent once when they start and again when done
+			if batch == nil {
+				batch = b
+				continue
+			}
+			batch = nil
+			if b.err != nil {
+				queue = append(queue, b.err)
+			}
+			if e := b.event(); e != nil {
+				queue = append(queue, e)
+			}
+		case pinName := <-pinRemoved:
+			queue = append(queue, newPinRemovedEvent(pinName))
+		case pinState := <-pinAdded:
+			queue = append(queue, newPinEvent(protocol.TypePinAdded, pinState))
+		case out <- next:
+			queue = queue[1:]
+		case d := <-s.drain:
+			drained = append(drained, d)
+		case <-hubDone:
+			hubDone = nil
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// Handler returns the http handler serving the test page at /, the
+// websocket at /ws and the command schema at /commands.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.homeHandler)
+	mux.HandleFunc("/ws", s.wsHandler)
+	mux.HandleFunc("/commands", s.commandsHandler)
+	return mux
+}
+
+// Shutdown stops executing commands, delivers pending pin events, sends
+// every connection a close frame and waits for sensor drivers to close, then
+// persists pin states, groups, scenes, jobs and rules and closes the GPIO
+// backend. If ctx expires first the remaining steps still run, but clients
+// may miss events or their close frame, and unless the hub stopped in time
+// nothing is persisted. A server that never started persists nothing either,
+// leaving the state file as it was.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var result error
+	var state *State
+	if s.started {
+		// once the hub stops, sensor drivers close and must be waited for
+		// before the backend is
+		stopped := false
+		states := make(chan *State, 1)
+		select {
+		case s.hub.stop <- states:
+			stopped = true
+			select {
+			case state = <-states:
+			case <-ctx.Done():
+			}
+		case <-ctx.Done():
+		}
+
+		drained := make(chan struct{})
+		select {
+		case s.drain <- drained:
+			select {
+			case <-drained:
+			case <-ctx.Done():
+			}
+		case <-ctx.Done():
+		}
+
+		select {
+		case s.hub.shutdown <- "server shutting down":
+			stopped = true
+			select {
+			case <-s.hub.done:
+			case <-ctx.Done():
+			}
+		case <-ctx.Done():
+		}
+
+		closed := make(chan struct{})
+		go func() {
+			s.hub.writers.Wait()
+			close(closed)
+		}()
+		select {
+		case <-closed:
+		case <-ctx.Done():
+		}
+		if stopped {
+			select {
+			case <-s.hub.sensorsClosed:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			log.Println("Timed out closing connections : " + ctx.Err().Error())
+			result = ctx.Err()
+		}
+	}
+
+	if state != nil {
+		if err := s.saveState(state); err != nil {
+			log.Println("Error saving pin states on close: " + err.Error())
+			result = err
+		}
+	} else if s.started {
+		log.Println("Not saving pin states, the hub didn't stop in time")
+	}
+	if err := s.gpio.Close(); err != nil {
+		log.Println("Error closing gpio : " + err.Error())
+		result = err
+	}
+	close(s.quit)
+	return result
+}
+
+// Close shuts the server down without a deadline.
+func (s *Server) Close() error {
+	return s.Shutdown(context.Background())
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+)
+
+// newTestServer returns a server on the fake backend, keeping its state in
+// a file of its own.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	s := New(&gpio.GPIO{})
+	s.StateFile = filepath.Join(t.TempDir(), "state.json")
+	s.W1Dir = ""
+	return s
+}
+
+func TestShutdownSavesState(t *testing.T) {
+	s := newTestServer(t)
+	saved := []byte(`{"Pins":{"P8_07":{"PinId":"P8_07","Dir":1,"Name":"fan"}},"Groups":{"fans":["fan"]}}`)
+	if err := ioutil.WriteFile(s.StateFile, saved, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-s.hub.done:
+	default:
+		t.Error("hub still running after shutdown")
+	}
+
+	data, err := ioutil.ReadFile(s.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if ps, ok := state.Pins["P8_07"]; !ok || ps.Name != "fan" {
+		t.Errorf("saved pins %v, want P8_07 named fan", state.Pins)
+	}
+	// saved by the server, with the group's pins by id
+	if pins := state.Groups["fans"]; len(pins) != 1 || pins[0] != "P8_07" {
+		t.Errorf("saved group %v, want P8_07", pins)
+	}
+}
+
+func TestCloseAfterFailedStart(t *testing.T) {
+	s := newTestServer(t)
+	saved := []byte(`{"Pins":{"P8_07":{"PinId":"P8_07","Dir":1,"Name":"fan"}}}`)
+	if err := ioutil.WriteFile(s.StateFile, saved, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s.PingInterval = 0
+	if err := s.Start(); err == nil {
+		t.Fatal("started with no ping interval")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(s.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(saved) {
+		t.Errorf("state file overwritten with %s", data)
+	}
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+	"github.com/benjamind/gpio-json-server/sensor"
+)
+
+// State is what the server persists between runs. Config files have the
+// same format.
+type State struct {
+	// Pins are the initialised pins, keyed by pin id.
+	Pins map[string]gpio.PinState
+	// Groups are the pin groups, listing the pin ids of each in bit order.
+	Groups map[string][]string `json:",omitempty"`
+	// Scenes are the saved scenes, each holding pin values by pin id.
+	Scenes map[string]protocol.Scene `json:",omitempty"`
+	// Jobs are the scheduled jobs.
+	Jobs map[string]protocol.Job `json:",omitempty"`
+	// Rules are the rules run when pins change.
+	Rules map[string]protocol.Rule `json:",omitempty"`
+	// Sensors are the sensor drivers to read.
+	Sensors map[string]sensor.Config `json:",omitempty"`
+	// Steppers are the stepper motors. Their positions aren't kept.
+	Steppers map[string]protocol.Stepper `json:",omitempty"`
+}
+
+func newState() *State {
+	return &State{
+		Pins:   make(map[string]gpio.PinState),
+		Groups: make(map[string][]string),
+		Scenes: make(map[string]protocol.Scene),
+		Jobs:   make(map[string]protocol.Job),
+		Rules:  make(map[string]protocol.Rule),
+
+		Sensors:  make(map[string]sensor.Config),
+		Steppers: make(map[string]protocol.Stepper),
+	}
+}
+
+// readState reads a state or config file. State files written by older
+// versions hold just the map of pin states, and are read as such.
+func readState(file string) (*State, error) {
+	dat, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Println("Failed to read state file : " + file + " : " + err.Error())
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(dat, &fields); err != nil {
+		log.Println("Failed to unmarshal json : " + err.Error())
+		return nil, err
+	}
+	state := newState()
+	if legacyState(fields) {
+		err = json.Unmarshal(dat, &state.Pins)
+	} else {
+		err = json.Unmarshal(dat, state)
+	}
+	if err != nil {
+		log.Println("Failed to unmarshal json : " + err.Error())
+		return nil, err
+	}
+	return state, nil
+}
+
+// legacyState reports whether fields are those of an old state file, where
+// every field is a pin state.
+func legacyState(fields map[string]json.RawMessage) bool {
+	for _, raw := range fields {
+		var ps struct{ PinId *string }
+		if json.Unmarshal(raw, &ps) != nil || ps.PinId == nil {
+			return false
+		}
+	}
+	return len(fields) > 0
+}
+
+// overlay applies the runtime values saved in a state file to st, read
+// from a config file, which declares everything else. These are the state of
+// every pin st declares with the same direction, and the offset and scale of
+// sensor drivers st declares with the same driver, as set by tare and
+// calibrate, unless st sets them.
+func (st *State) overlay(saved *State) {
+	for pinId, ps := range st.Pins {
+		sp, ok := saved.Pins[pinId]
+		if !ok || sp.Dir != ps.Dir {
+			continue
+		}
+		ps.State = sp.State
+		st.Pins[pinId] = ps
+	}
+	for name, c := range st.Sensors {
+		sc, ok := saved.Sensors[name]
+		if !ok || !strings.EqualFold(sc.Driver, c.Driver) {
+			continue
+		}
+		for _, key := range []string{"offset", "scale"} {
+			if _, set := c.Options[key]; set {
+				continue
+			}
+			if value, ok := sc.Options[key]; ok {
+				if c.Options == nil {
+					c.Options = make(map[string]string)
+				}
+				c.Options[key] = value
+			}
+		}
+		st.Sensors[name] = c
+	}
+}
+
+// canonical re-keys pins, and the pins of groups, scenes, jobs, rules and
+// steppers, by canonical pin id. Like commands, these may refer to pins by
+// the names st gives them. It fails when two pins saved under different keys
+// are the same pin, or their names collide.
+func (st *State) canonical(pinMap []gpio.PinDef) error {
+	pins, err := gpio.Canonical(pinMap, st.Pins)
+	if err != nil {
+		return err
+	}
+	st.Pins = pins
+	lookup := func(pin string) string {
+		if pin == "" {
+			// such as a stepper without a limit switch
+			return pin
+		}
+		if pinId, err := gpio.Resolve(pinMap, st.Pins, pin); err == nil {
+			return pinId
+		}
+		return pin
+	}
+	for _, pins := range st.Groups {
+		for i, pin := range pins {
+			pins[i] = lookup(pin)
+		}
+	}
+	for scene, values := range st.Scenes {
+		canonical := make(protocol.Scene, len(values))
+		for pin, value := range values {
+			canonical[lookup(pin)] = value
+		}
+		st.Scenes[scene] = canonical
+	}
+	for name, j := range st.Jobs {
+		j.Action.Pin = lookup(j.Action.Pin)
+		st.Jobs[name] = j
+	}
+	for name, r := range st.Rules {
+		r.Pin = lookup(r.Pin)
+		for i := range r.If {
+			r.If[i].Pin = lookup(r.If[i].Pin)
+		}
+		r.Action.Pin = lookup(r.Action.Pin)
+		st.Rules[name] = r
+	}
+	for name, ps := range st.Steppers {
+		for _, pin := range []*string{&ps.Step, &ps.Dir, &ps.Enable, &ps.Limit} {
+			*pin = lookup(*pin)
+		}
+		st.Steppers[name] = ps
+	}
+	return nil
+}
+
+// loadState reads the config file and the state file, re-keying their pins
+// by canonical id. With a config file, the state file only restores runtime
+// values, so that edits to the config file take effect. Without one, it
+// restores everything.
+func (s *Server) loadState(pinMap []gpio.PinDef) (*State, error) {
+	var config, saved *State
+	if s.ConfigFile != "" {
+		log.Println("Reading config file : " + s.ConfigFile)
+		var err error
+		if config, err = readState(s.ConfigFile); err != nil {
+			return nil, err
+		}
+		if err := config.canonical(pinMap); err != nil {
+			log.Println("Invalid pins in " + s.ConfigFile + " : " + err.Error())
+			return nil, err
+		}
+	}
+	if s.StateFile != "" {
+		// read existing pin states
+		if _, err := os.Stat(s.StateFile); err == nil {
+			log.Println("Reading prexisting pinstate file : " + s.StateFile)
+			if saved, err = readState(s.StateFile); err != nil {
+				return nil, err
+			}
+			if err := saved.canonical(pinMap); err != nil {
+				log.Println("Invalid pins in " + s.StateFile + " : " + err.Error())
+				return nil, err
+			}
+		}
+	}
+	switch {
+	case config == nil && saved == nil:
+		return newState(), nil
+	case config == nil:
+		return saved, nil
+	case saved != nil:
+		config.overlay(saved)
+	}
+	return config, nil
+}
+
+// state returns everything the hub keeps that is persisted, but for pin
+// states, which the backend keeps. It must only be called from the hub
+// goroutine.
+func (h *hub) state() *State {
+	jobs := h.copyJobs()
+	for name, j := range jobs {
+		j.Next = nil
+		jobs[name] = j
+	}
+	return &State{
+		Groups: h.copyGroups(),
+		Scenes: h.copyScenes(),
+		Jobs:   jobs,
+		Rules:  h.copyRules(),
+
+		Sensors:  h.copySensorConfigs(false),
+		Steppers: h.copySteppers(true),
+	}
+}
+
+// saveState writes state, taken from the hub, with the backend's pin states
+// to the state file.
+func (s *Server) saveState(state *State) error {
+	if s.StateFile == "" {
+		return nil
+	}
+	pinStates, err := s.gpio.PinStates()
+	if err != nil {
+		return err
+	}
+	state.Pins = pinStates
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.StateFile, data, 0644)
+}
@@ -0,0 +1,727 @@
+package server
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+)
+
+// Stepper defaults, in steps per second and steps per second per second.
+const (
+	DefaultStepperSpeed = 200
+	DefaultStepperAccel = 400
+)
+
+// MaxStepperSpeed bounds the speed of steppers, in steps per second. The
+// board may not keep up with it.
+const MaxStepperSpeed = 10000
+
+// stepperReportInterval is how often a moving stepper reports its position.
+const stepperReportInterval = 100 * time.Millisecond
+
+// maxHomingSteps bounds how far homing runs looking for the limit switch.
+const maxHomingSteps = 1 << 30
+
+// Homing runs towards the limit switch until it is active, then back off it
+// slowly until it is released, which is position 0.
+const (
+	homeNone = iota
+	homeSeek
+	homeBackOff
+)
+
+// stepper is a configured stepper motor.
+type stepper struct {
+	name string
+	protocol.Stepper
+
+	position int64
+	homed    bool
+	// the move under way, nil when idle, and its speed as last reported
+	move  *stepperMove
+	speed float64
+	// why the last move stopped short
+	err *protocol.Error
+}
+
+// stepperMove is a move of a stepper, whose steps are pulsed by its own
+// goroutine. Closing stop brings it to a halt at its acceleration, closing
+// abort halts it at once. The goroutine closes done once it has stopped
+// pulsing.
+type stepperMove struct {
+	s      *stepper
+	cmd    string
+	step   string
+	start  int64
+	dir    int64
+	steps  int64
+	speed  float64
+	accel  float64
+	homing int
+
+	stop     chan struct{}
+	abort    chan struct{}
+	done     chan struct{}
+	stopped  bool
+	aborted  bool
+	limitHit bool
+}
+
+// stepperUpdate is the progress of a move, sent to the hub by its goroutine.
+type stepperUpdate struct {
+	m     *stepperMove
+	moved int64
+	speed float64
+	done  bool
+	err   error
+}
+
+// newStepper checks a stepper, which may come from a config file.
+func newStepper(name string, ps protocol.Stepper) (*stepper, error) {
+	ps.State = nil
+	pins := map[string]bool{}
+	for _, pin := range []string{ps.Step, ps.Dir, ps.Enable, ps.Limit} {
+		if pin == "" {
+			continue
+		}
+		if pins[pin] {
+			return nil, gpio.NewError(gpio.CodeInvalidValue, pin, "Pin "+pin+" is used twice by stepper "+name)
+		}
+		pins[pin] = true
+	}
+	if ps.Step == "" || ps.Dir == "" || ps.Enable == "" {
+		return nil, gpio.NewError(gpio.CodeInvalidArguments, "", "Stepper "+name+" needs step, dir and enable pins")
+	}
+	if ps.Speed < 0 || ps.Speed > MaxStepperSpeed {
+		return nil, gpio.NewError(gpio.CodeInvalidValue, "", "Invalid stepper speed, must be 1-"+strconv.Itoa(MaxStepperSpeed)+" steps per second, or 0 for the default : "+strconv.Itoa(ps.Speed))
+	}
+	if ps.Accel < 0 {
+		return nil, gpio.NewError(gpio.CodeInvalidValue, "", "Stepper acceleration can't be negative")
+	}
+	return &stepper{name: name, Stepper: ps}, nil
+}
+
+// params returns the speed and acceleration of a move, those of s unless
+// given.
+func (s *stepper) params(speed int, accel int) (float64, float64) {
+	if speed == 0 {
+		if speed = s.Speed; speed == 0 {
+			speed = DefaultStepperSpeed
+		}
+	}
+	if accel < 0 {
+		if accel = s.Accel; accel == 0 {
+			accel = DefaultStepperAccel
+		}
+	}
+	return float64(speed), float64(accel)
+}
+
+// enableLevel is the level of the enable pin enabling the driver, or not.
+func (s *stepper) enableLevel(enabled bool) byte {
+	if enabled != s.EnableActiveLow {
+		return 1
+	}
+	return 0
+}
+
+// limitActive reports whether the limit switch is active at state.
+func (s *stepper) limitActive(state byte) bool {
+	return (state != 0) != s.LimitActiveLow
+}
+
+// state reports where s is.
+func (s *stepper) state() *protocol.StepperState {
+	st := &protocol.StepperState{
+		Stepper:  s.name,
+		Position: s.position,
+		Homed:    s.homed,
+		Error:    s.err,
+	}
+	if m := s.move; m != nil {
+		st.Moving = true
+		st.Homing = m.homing != homeNone
+		st.Speed = s.speed
+		if !st.Homing {
+			st.Target = m.start + m.dir*m.steps
+		}
+	}
+	return st
+}
+
+// checkStepperPins verifies the pins of s are initialised as it needs, returning
+// the state of its limit switch.
+func (h *hub) checkStepperPins(s *stepper) (limit byte, err error) {
+	pinStates, err := h.gpio.PinStates()
+	if err != nil {
+		return 0, err
+	}
+	for _, pin := range []string{s.Step, s.Dir, s.Enable} {
+		if ps, ok := pinStates[pin]; !ok || ps.Dir != gpio.Out {
+			return 0, gpio.NewError(gpio.CodeUnsupported, pin, "Pin "+pin+" of stepper "+s.name+" must be initialised as out")
+		}
+	}
+	if s.Limit == "" {
+		return 0, nil
+	}
+	ps, ok := pinStates[s.Limit]
+	if !ok || ps.Dir != gpio.In {
+		return 0, gpio.NewError(gpio.CodeUnsupported, s.Limit, "Limit switch "+s.Limit+" of stepper "+s.name+" must be initialised as in")
+	}
+	return ps.State, nil
+}
+
+// startMove starts moving s by steps, backwards when negative. Unless
+// backing off it while homing, it is refused while the limit switch is
+// active. It must only be called from the hub goroutine.
+func (h *hub) startMove(cmd string, s *stepper, steps int64, speed float64, accel float64, homing int) error {
+	if s.move != nil {
+		return gpio.NewError(gpio.CodeUnsupported, "", "Stepper "+s.name+" is moving")
+	}
+	limit, err := h.checkStepperPins(s)
+	if err != nil {
+		return err
+	}
+	if s.Limit != "" && homing != homeBackOff && s.limitActive(limit) {
+		return gpio.NewError(gpio.CodeUnsupported, s.Limit, "Limit switch "+s.Limit+" of stepper "+s.name+" is active")
+	}
+	s.err = nil
+	if steps == 0 {
+		go h.sendMsg(protocol.TypeStepper, s.state())
+		return nil
+	}
+	m := &stepperMove{
+		s:      s,
+		cmd:    cmd,
+		step:   s.Step,
+		start:  s.position,
+		dir:    1,
+		steps:  steps,
+		speed:  speed,
+		accel:  accel,
+		homing: homing,
+		stop:   make(chan struct{}),
+		abort:  make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	var dir byte = 1
+	if steps < 0 {
+		m.dir, m.steps, dir = -1, -steps, 0
+	}
+	if err := h.gpio.PinSet(s.Dir, dir); err != nil {
+		return err
+	}
+	if err := h.gpio.PinSet(s.Enable, s.enableLevel(true)); err != nil {
+		return err
+	}
+	s.move, s.speed = m, 0
+	go h.runStepper(m)
+	go h.sendMsg(protocol.TypeStepper, s.state())
+	return nil
+}
+
+// home starts homing s. It must only be called from the hub goroutine.
+func (h *hub) home(s *stepper, speed float64) error {
+	if s.move != nil {
+		return gpio.NewError(gpio.CodeUnsupported, "", "Stepper "+s.name+" is moving")
+	}
+	if s.Limit == "" {
+		// nowhere to go, take the current position as home
+		s.position, s.homed, s.err = 0, true, nil
+		go h.sendMsg(protocol.TypeStepper, s.state())
+		return nil
+	}
+	limit, err := h.checkStepperPins(s)
+	if err != nil {
+		return err
+	}
+	var dir int64 = -1
+	if s.HomeForward {
+		dir = 1
+	}
+	s.homed = false
+	if s.limitActive(limit) {
+		return h.backOff(s, dir, speed)
+	}
+	_, accel := s.params(0, -1)
+	return h.startMove(protocol.CmdHome, s, dir*maxHomingSteps, speed, accel, homeSeek)
+}
+
+// backOff moves s slowly away from its limit switch, in the opposite
+// direction to dir, until it is released.
+func (h *hub) backOff(s *stepper, dir int64, speed float64) error {
+	return h.startMove(protocol.CmdHome, s, -dir*maxHomingSteps, math.Max(speed/4, 1), 0, homeBackOff)
+}
+
+// halt stops a moving stepper, at once if abort is set and otherwise at its
+// acceleration.
+func (m *stepperMove) halt(abort bool) {
+	if abort && !m.aborted {
+		m.aborted = true
+		close(m.abort)
+	} else if !abort && !m.stopped {
+		m.stopped = true
+		close(m.stop)
+	}
+}
+
+// runStepper pulses the steps of m, accelerating up to its speed and slowing
+// down again before the end, and sends its progress to the hub until it is
+// done.
+func (h *hub) runStepper(m *stepperMove) {
+	var moved int64
+	var speed float64
+	var err error
+	steps := m.steps
+	stop := m.stop
+	next := time.Now()
+	report := next.Add(stepperReportInterval)
+loop:
+	for moved < steps {
+		select {
+		case <-m.abort:
+			break loop
+		case <-stop:
+			stop = nil
+			if m.accel <= 0 {
+				break loop
+			}
+			if left := int64(math.Ceil(speed * speed / (2 * m.accel))); moved+left < steps {
+				steps = moved + left
+			}
+			continue
+		default:
+		}
+
+		speed = m.speed
+		if m.accel > 0 {
+			speed = math.Min(speed, math.Sqrt(2*m.accel*float64(moved+1)))
+			speed = math.Min(speed, math.Sqrt(2*m.accel*float64(steps-moved)))
+		}
+		if err = h.gpio.PinPulse(m.step); err != nil {
+			break
+		}
+		moved++
+		next = next.Add(time.Duration(float64(time.Second) / speed))
+		if now := time.Now(); !now.Before(report) {
+			report = now.Add(stepperReportInterval)
+			// the hub catches up with the next report if it is busy
+			select {
+			case h.stepperUpdates <- stepperUpdate{m: m, moved: moved, speed: speed}:
+			default:
+			}
+		}
+		time.Sleep(time.Until(next))
+	}
+	close(m.done)
+	select {
+	case h.stepperUpdates <- stepperUpdate{m: m, moved: moved, done: true, err: err}:
+	case <-h.done:
+	}
+}
+
+// updateStepper records the progress of a move and sends a Stepper event.
+// When the move is done it moves on to the next step of homing, or releases
+// the driver. It must only be called from the hub goroutine.
+func (h *hub) updateStepper(u stepperUpdate) {
+	m := u.m
+	s := m.s
+	if h.steppers[s.name] != s || s.move != m {
+		// removed or replaced since
+		return
+	}
+	s.position = m.start + m.dir*u.moved
+	if !u.done {
+		s.speed = u.speed
+		go h.sendMsg(protocol.TypeStepper, s.state())
+		return
+	}
+
+	s.move, s.speed = nil, 0
+	var err error
+	switch {
+	case u.err != nil:
+		err = u.err
+	case m.stopped && !m.limitHit:
+		// halted as asked
+	case m.homing == homeSeek && m.limitHit:
+		if err = h.backOff(s, m.dir, m.speed); err == nil {
+			return
+		}
+	case m.homing == homeBackOff && m.limitHit:
+		s.position, s.homed = 0, true
+	case m.limitHit:
+		err = gpio.NewError(gpio.CodeHardwareFailure, s.Limit, "Stepper "+s.name+" hit its limit switch "+s.Limit)
+	case m.homing != homeNone:
+		err = gpio.NewError(gpio.CodeHardwareFailure, s.Limit, "Stepper "+s.name+" didn't find its limit switch "+s.Limit)
+	}
+	if err != nil {
+		e := newError(m.cmd, err)
+		s.err = &e
+		log.Println("Stepper " + s.name + " stopped : " + e.Message)
+	}
+	if !s.Hold {
+		h.releaseStepper(s)
+	}
+	go h.sendMsg(protocol.TypeStepper, s.state())
+}
+
+// releaseStepper disables the driver of s.
+func (h *hub) releaseStepper(s *stepper) {
+	if err := h.gpio.PinSet(s.Enable, s.enableLevel(false)); err != nil {
+		log.Println("Failed to disable stepper " + s.name + " : " + err.Error())
+	}
+}
+
+// checkLimits stops the steppers whose limit switch pin event e reports as
+// active, or as released when backing off it. It must only be called from
+// the hub goroutine.
+func (h *hub) checkLimits(e *event) {
+	for _, ps := range eventPinStates(e) {
+		for _, s := range h.steppers {
+			m := s.move
+			if m == nil || s.Limit != ps.PinId {
+				continue
+			}
+			if s.limitActive(ps.State) != (m.homing == homeBackOff) {
+				m.limitHit = true
+				m.halt(true)
+			}
+		}
+	}
+}
+
+// stopSteppers halts every moving stepper at once and waits for it to stop
+// pulsing, then disables every driver, so none is left enabled, or saved
+// that way, once the GPIO backend is closed. It must only be called from
+// the hub goroutine.
+func (h *hub) stopSteppers() {
+	pinStates, err := h.gpio.PinStates()
+	if err != nil {
+		log.Println("Failed to disable steppers : " + err.Error())
+	}
+	for _, s := range h.steppers {
+		if m := s.move; m != nil {
+			m.halt(true)
+			<-m.done
+			// its last update is ignored once the hub has stopped
+			s.move, s.speed = nil, 0
+		}
+		if ps, ok := pinStates[s.Enable]; ok && ps.Dir == gpio.Out {
+			h.releaseStepper(s)
+		}
+	}
+}
+
+// removeStepper halts the named stepper, if there is one, releases its
+// driver and forgets it.
+func (h *hub) removeStepper(name string) bool {
+	s, ok := h.steppers[name]
+	if !ok {
+		return false
+	}
+	if s.move != nil {
+		// disable the driver once it has stopped pulsing
+		s.move.halt(true)
+		<-s.move.done
+	}
+	h.releaseStepper(s)
+	delete(h.steppers, name)
+	return true
+}
+
+// copySteppers returns a copy of every stepper, with its state unless
+// config is set, safe to hand to other goroutines.
+func (h *hub) copySteppers(config bool) map[string]protocol.Stepper {
+	steppers := make(map[string]protocol.Stepper, len(h.steppers))
+	for name, s := range h.steppers {
+		ps := s.Stepper
+		if !config {
+			ps.State = s.state()
+		}
+		steppers[name] = ps
+	}
+	return steppers
+}
+
+// stepperNamed returns the named stepper.
+func (h *hub) stepperNamed(name string) (*stepper, error) {
+	s, ok := h.steppers[name]
+	if !ok {
+		return nil, gpio.NewError(gpio.CodeNotFound, "", "Unknown stepper "+name)
+	}
+	return s, nil
+}
+
+// parseMove parses the optional speed and accel arguments of a move.
+func parseMove(s *stepper, args []string) (float64, float64, error) {
+	speed, accel := 0, -1
+	var err error
+	if len(args) > 0 {
+		if speed, err = strconv.Atoi(args[0]); err != nil || speed < 1 || speed > MaxStepperSpeed {
+			return 0, 0, gpio.NewError(gpio.CodeInvalidValue, "", "Invalid speed, must be 1-"+strconv.Itoa(MaxStepperSpeed)+" steps per second : "+args[0])
+		}
+	}
+	if len(args) > 1 {
+		if accel, err = strconv.Atoi(args[1]); err != nil || accel < 0 {
+			return 0, 0, gpio.NewError(gpio.CodeInvalidValue, "", "Invalid acceleration, must be 0 or more steps per second per second : "+args[1])
+		}
+	}
+	fspeed, faccel := s.params(speed, accel)
+	return fspeed, faccel, nil
+}
+
+var (
+	stepperArg = protocol.ArgSchema{
+		Name:        "stepper",
+		Type:        protocol.ArgString,
+		Description: "Stepper name",
+	}
+	stepperSpeedArg = protocol.ArgSchema{
+		Name:        "speed",
+		Type:        protocol.ArgInt,
+		Description: "Top speed in steps per second, the stepper's own unless given",
+		Min:         intPtr(1),
+		Max:         intPtr(MaxStepperSpeed),
+		Optional:    true,
+	}
+	stepperAccelArg = protocol.ArgSchema{
+		Name:        "accel",
+		Type:        protocol.ArgInt,
+		Description: "Acceleration in steps per second per second, 0 for none, the stepper's own unless given",
+		Min:         intPtr(0),
+		Optional:    true,
+	}
+)
+
+func init() {
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdAddStepper,
+			Description: "Drive a stepper motor through the step, dir and enable pins of its driver, replacing any stepper of the same name",
+			Args: []protocol.ArgSchema{
+				stepperArg,
+				{
+					Name:        "step",
+					Type:        protocol.ArgPin,
+					Description: "Output pulsed once per step",
+				},
+				{
+					Name:        "dir",
+					Type:        protocol.ArgPin,
+					Description: "Output high to move forwards",
+				},
+				{
+					Name:        "enable",
+					Type:        protocol.ArgPin,
+					Description: "Output enabling the driver",
+				},
+				{
+					Name:        "option",
+					Type:        protocol.ArgString,
+					Description: "Options as key=value: speed and accel, 0 for the defaults, limit=<input pin> for a limit switch, limitactive=low or enableactive=low for active low pins, home=forward to home forwards, and hold=true to keep the driver enabled between moves",
+					Optional:    true,
+					Variadic:    true,
+				},
+			},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : addstepper name step dir enable [key=value ...]
+			var ps protocol.Stepper
+			var err error
+			for i, pin := range []*string{&ps.Step, &ps.Dir, &ps.Enable} {
+				if *pin, err = h.resolvePin(args[i+1]); err != nil {
+					return err
+				}
+			}
+			for _, arg := range args[4:] {
+				i := strings.Index(arg, "=")
+				if i <= 0 {
+					return gpio.NewError(gpio.CodeInvalidArguments, "", "Invalid option, must be key=value : "+arg)
+				}
+				key, value := strings.ToLower(arg[:i]), strings.ToLower(arg[i+1:])
+				switch {
+				case key == "speed" || key == "accel":
+					field := &ps.Speed
+					if key == "accel" {
+						field = &ps.Accel
+					}
+					if *field, err = strconv.Atoi(value); err != nil {
+						return gpio.NewError(gpio.CodeInvalidValue, "", "Invalid "+key+" : "+value)
+					}
+				case key == "limit":
+					if ps.Limit, err = h.resolvePin(arg[i+1:]); err != nil {
+						return err
+					}
+				case (key == "limitactive" || key == "enableactive") && (value == "low" || value == "high"):
+					if key == "limitactive" {
+						ps.LimitActiveLow = value == "low"
+					} else {
+						ps.EnableActiveLow = value == "low"
+					}
+				case key == "home" && (value == "forward" || value == "backward"):
+					ps.HomeForward = value == "forward"
+				case key == "hold":
+					if ps.Hold, err = strconv.ParseBool(value); err != nil {
+						return gpio.NewError(gpio.CodeInvalidValue, "", "Invalid hold, must be true or false : "+value)
+					}
+				default:
+					return gpio.NewError(gpio.CodeInvalidArguments, "", "Invalid stepper option : "+arg)
+				}
+			}
+			s, err := newStepper(args[0], ps)
+			if err != nil {
+				return err
+			}
+			if old, ok := h.steppers[s.name]; ok && old.move != nil {
+				return gpio.NewError(gpio.CodeUnsupported, "", "Stepper "+s.name+" is moving")
+			}
+			if _, err := h.checkStepperPins(s); err != nil {
+				return err
+			}
+			h.steppers[s.name] = s
+			if !s.Hold {
+				h.releaseStepper(s)
+			}
+			go h.sendMsg(protocol.TypeSteppers, h.copySteppers(false))
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdDelStepper,
+			Description: "Halt a stepper, disable its driver and forget it",
+			Args:        []protocol.ArgSchema{stepperArg},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : delstepper name
+			if !h.removeStepper(args[0]) {
+				return gpio.NewError(gpio.CodeNotFound, "", "Unknown stepper "+args[0])
+			}
+			go h.sendMsg(protocol.TypeSteppers, h.copySteppers(false))
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdGetSteppers,
+			Description: "Reply with every stepper and where it is",
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			go h.sendMsg(protocol.TypeSteppers, h.copySteppers(false))
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdMove,
+			Description: "Move a stepper by a number of steps, backwards when negative",
+			Args: []protocol.ArgSchema{
+				stepperArg,
+				{
+					Name:        "steps",
+					Type:        protocol.ArgInt,
+					Description: "Steps to move",
+				},
+				stepperSpeedArg,
+				stepperAccelArg,
+			},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : move name steps [speed] [accel]
+			s, err := h.stepperNamed(args[0])
+			if err != nil {
+				return err
+			}
+			steps, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil || steps > maxHomingSteps || steps < -maxHomingSteps {
+				return gpio.NewError(gpio.CodeInvalidValue, "", "Invalid number of steps : "+args[1])
+			}
+			speed, accel, err := parseMove(s, args[2:])
+			if err != nil {
+				return err
+			}
+			return h.startMove(protocol.CmdMove, s, steps, speed, accel, homeNone)
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdMoveTo,
+			Description: "Move a stepper to a position, in steps from home",
+			Args: []protocol.ArgSchema{
+				stepperArg,
+				{
+					Name:        "position",
+					Type:        protocol.ArgInt,
+					Description: "Position to move to",
+				},
+				stepperSpeedArg,
+				stepperAccelArg,
+			},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : moveto name position [speed] [accel]
+			s, err := h.stepperNamed(args[0])
+			if err != nil {
+				return err
+			}
+			position, err := strconv.ParseInt(args[1], 10, 64)
+			if err != nil || position > maxHomingSteps || position < -maxHomingSteps {
+				return gpio.NewError(gpio.CodeInvalidValue, "", "Invalid position : "+args[1])
+			}
+			speed, accel, err := parseMove(s, args[2:])
+			if err != nil {
+				return err
+			}
+			return h.startMove(protocol.CmdMoveTo, s, position-s.position, speed, accel, homeNone)
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdStop,
+			Description: "Bring a moving stepper to a halt at its acceleration",
+			Args:        []protocol.ArgSchema{stepperArg},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : stop name
+			s, err := h.stepperNamed(args[0])
+			if err != nil {
+				return err
+			}
+			if s.move == nil {
+				go h.sendMsg(protocol.TypeStepper, s.state())
+				return nil
+			}
+			// the Stepper event follows once it has halted
+			s.move.halt(false)
+			return nil
+		},
+	})
+	registerCommand(&command{
+		CommandSchema: protocol.CommandSchema{
+			Name:        protocol.CmdHome,
+			Description: "Run a stepper towards its limit switch, then back off it slowly to position 0. Without a limit switch, take the current position as 0",
+			Args: []protocol.ArgSchema{
+				stepperArg,
+				stepperSpeedArg,
+			},
+		},
+		run: func(h *hub, c *connection, args []string) error {
+			// format : home name [speed]
+			s, err := h.stepperNamed(args[0])
+			if err != nil {
+				return err
+			}
+			speed, _, err := parseMove(s, args[1:])
+			if err != nil {
+				return err
+			}
+			return h.home(s, speed)
+		},
+	})
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+)
+
+// newTestStepper returns a hub with a stepper on P8_07, P8_08 and P8_09,
+// and a limit switch on P8_10, which is low and so active when activeLow is
+// set.
+func newTestStepper(t *testing.T, activeLow bool) (*hub, *stepper) {
+	t.Helper()
+	h, g := newTestHub(t, "P8_07", "P8_08", "P8_09")
+	if err := g.PinInit("P8_10", gpio.In, gpio.Pull_None, "P8_10"); err != nil {
+		t.Fatal(err)
+	}
+	s, err := newStepper("x", protocol.Stepper{Step: "P8_07", Dir: "P8_08", Enable: "P8_09", Limit: "P8_10", LimitActiveLow: activeLow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.steppers = map[string]*stepper{"x": s}
+	return h, s
+}
+
+// setLimit passes the hub a change of the limit switch of s to state.
+func setLimit(h *hub, s *stepper, state byte) {
+	h.checkLimits(newPinEvent(protocol.TypePinState, gpio.PinState{PinId: s.Limit, Dir: gpio.In, State: state}))
+}
+
+// finishMove hands the hub the progress of the move of s until it is done.
+func finishMove(t *testing.T, h *hub, s *stepper) {
+	t.Helper()
+	m := s.move
+	if m == nil {
+		t.Fatal("stepper isn't moving")
+	}
+	for {
+		select {
+		case u := <-h.stepperUpdates:
+			h.updateStepper(u)
+			if u.m == m && u.done {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatal("move didn't finish")
+		}
+	}
+}
+
+func TestStepperLimit(t *testing.T) {
+	h, s := newTestStepper(t, true)
+	if err := h.startMove(protocol.CmdMove, s, 100, 1000, 0, homeNone); gpio.CodeOf(err) != gpio.CodeUnsupported {
+		t.Errorf("moving with the limit switch active: got %v, want an Unsupported error", err)
+	}
+
+	h, s = newTestStepper(t, false)
+	if err := h.startMove(protocol.CmdMove, s, 1000000, 1000, 0, homeNone); err != nil {
+		t.Fatal(err)
+	}
+	setLimit(h, s, 1)
+	finishMove(t, h, s)
+	if s.move != nil || s.err == nil || s.err.Code != gpio.CodeHardwareFailure || s.err.Command != protocol.CmdMove {
+		t.Errorf("got move %v and error %+v, want it halted with a HardwareFailure error", s.move, s.err)
+	}
+	if s.position >= 1000000 {
+		t.Errorf("halted at %d, want short of 1000000", s.position)
+	}
+}
+
+func TestStepperHome(t *testing.T) {
+	h, s := newTestStepper(t, false)
+	s.position = 500
+	if err := h.home(s, 1000); err != nil {
+		t.Fatal(err)
+	}
+	seek := s.move
+	if seek == nil || seek.homing != homeSeek || seek.dir != -1 {
+		t.Fatalf("got move %+v, want to seek backwards", seek)
+	}
+	setLimit(h, s, 1)
+	finishMove(t, h, s)
+
+	// then back off it slowly, in the opposite direction
+	backOff := s.move
+	if backOff == nil || backOff.homing != homeBackOff || backOff.dir != 1 || backOff.speed >= seek.speed {
+		t.Fatalf("got move %+v, want to back off forwards more slowly", backOff)
+	}
+	if s.homed {
+		t.Error("homed before backing off the limit switch")
+	}
+	setLimit(h, s, 0)
+	finishMove(t, h, s)
+	if s.move != nil || !s.homed || s.position != 0 || s.err != nil {
+		t.Errorf("got move %v at %d, homed %v with error %+v, want homed at 0", s.move, s.position, s.homed, s.err)
+	}
+}
+
+func TestStopSteppers(t *testing.T) {
+	h, g := newTestHub(t, "P8_07", "P8_08", "P8_09", "P8_10")
+	// one moving, and one idle holding its position, both active low
+	moving, err := newStepper("x", protocol.Stepper{Step: "P8_07", Dir: "P8_08", Enable: "P8_09", EnableActiveLow: true, Hold: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idle, err := newStepper("y", protocol.Stepper{Step: "P8_11", Dir: "P8_12", Enable: "P8_10", EnableActiveLow: true, Hold: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.steppers = map[string]*stepper{"x": moving, "y": idle}
+	if err := g.PinSet("P8_10", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.startMove(protocol.CmdMove, moving, 1000000, 1000, 0, homeNone); err != nil {
+		t.Fatal(err)
+	}
+	m := moving.move
+
+	h.stopSteppers()
+	select {
+	case <-m.done:
+	default:
+		t.Error("stepper still pulsing once stopped")
+	}
+	if moving.move != nil {
+		t.Error("stepper still moving once stopped")
+	}
+	states, _ := g.PinStates()
+	for _, pin := range []string{"P8_09", "P8_10"} {
+		if states[pin].State != 1 {
+			t.Errorf("enable pin %s left at %d, want it disabled at 1", pin, states[pin].State)
+		}
+	}
+}
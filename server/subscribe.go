@@ -0,0 +1,151 @@
+package server
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/benjamind/gpio-json-server/protocol"
+)
+
+// subscription limits the pin events delivered to a connection. An event
+// matches when its type is one of types (or types is empty) and its pin is
+// one of pins or its name matches one of names (or both are empty). Messages
+// that aren't about a pin, like command replies, are always delivered.
+type subscription struct {
+	pins  map[string]bool
+	names []string
+	types map[string]bool
+}
+
+func newSubscription() *subscription {
+	return &subscription{
+		pins:  make(map[string]bool),
+		types: make(map[string]bool),
+	}
+}
+
+// eventTypes are the message types subscriptions filter on, by lower case
+// name.
+var eventTypes = map[string]string{
+	strings.ToLower(protocol.TypePinState):   protocol.TypePinState,
+	strings.ToLower(protocol.TypePinAdded):   protocol.TypePinAdded,
+	strings.ToLower(protocol.TypePinRemoved): protocol.TypePinRemoved,
+
+	strings.ToLower(protocol.TypePinsChanged):  protocol.TypePinsChanged,
+	strings.ToLower(protocol.TypeSceneApplied): protocol.TypeSceneApplied,
+}
+
+// parseFilter classifies a subscribe argument. Arguments may be prefixed with
+// pin:, name: or type:, otherwise anything containing glob characters is a
+// name, any event type is a type, and everything else is a pin id.
+func parseFilter(arg string) (kind string, value string) {
+	if i := strings.Index(arg, ":"); i > 0 {
+		switch kind = strings.ToLower(arg[:i]); kind {
+		case "pin", "name":
+			return kind, arg[i+1:]
+		case "type":
+			if typ, ok := eventTypes[strings.ToLower(arg[i+1:])]; ok {
+				return kind, typ
+			}
+			return kind, arg[i+1:]
+		}
+	}
+	if strings.ContainsAny(arg, "*?[") {
+		return "name", arg
+	}
+	if typ, ok := eventTypes[strings.ToLower(arg)]; ok {
+		return "type", typ
+	}
+	return "pin", arg
+}
+
+func (s *subscription) add(kind, value string) {
+	switch kind {
+	case "pin":
+		s.pins[value] = true
+	case "name":
+		for _, n := range s.names {
+			if n == value {
+				return
+			}
+		}
+		s.names = append(s.names, value)
+	case "type":
+		s.types[value] = true
+	}
+}
+
+func (s *subscription) remove(kind, value string) {
+	switch kind {
+	case "pin":
+		delete(s.pins, value)
+	case "name":
+		for i, n := range s.names {
+			if n == value {
+				s.names = append(s.names[:i], s.names[i+1:]...)
+				break
+			}
+		}
+	case "type":
+		delete(s.types, value)
+	}
+}
+
+func (s *subscription) empty() bool {
+	return len(s.pins) == 0 && len(s.names) == 0 && len(s.types) == 0
+}
+
+// matches reports whether e should be delivered. name is the pin's last
+// known name, for events that don't carry one. Events about several pins
+// match if any of their pins do.
+func (s *subscription) matches(e *event, name string) bool {
+	if !e.isPin() {
+		return true
+	}
+	if len(s.types) > 0 && !s.types[e.Type] {
+		return false
+	}
+	if len(s.pins) == 0 && len(s.names) == 0 {
+		return true
+	}
+	if len(e.Pins) > 0 {
+		for pinId, name := range e.Pins {
+			if s.matchesPin(pinId, name) {
+				return true
+			}
+		}
+		return false
+	}
+	return s.matchesPin(e.PinId, name)
+}
+
+func (s *subscription) matchesPin(pinId string, name string) bool {
+	if s.pins[pinId] {
+		return true
+	}
+	for _, pattern := range s.names {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// info describes the subscription to the client.
+func (s *subscription) info() protocol.Subscriptions {
+	info := protocol.Subscriptions{
+		Pins:  make([]string, 0, len(s.pins)),
+		Names: append([]string{}, s.names...),
+		Types: make([]string, 0, len(s.types)),
+	}
+	for pin := range s.pins {
+		info.Pins = append(info.Pins, pin)
+	}
+	for typ := range s.types {
+		info.Types = append(info.Types, typ)
+	}
+	sort.Strings(info.Pins)
+	sort.Strings(info.Types)
+	return info
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/benjamind/gpio-json-server/gpio"
+	"github.com/benjamind/gpio-json-server/protocol"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		arg         string
+		kind, value string
+	}{
+		{"P8_07", "pin", "P8_07"},
+		{"pin:P8_07", "pin", "P8_07"},
+		{"PIN:pinstate", "pin", "pinstate"},
+		{"name:fan", "name", "fan"},
+		{"fan*", "name", "fan*"},
+		{"led[12]", "name", "led[12]"},
+		{"pinstate", "type", protocol.TypePinState},
+		{"type:PinsChanged", "type", protocol.TypePinsChanged},
+		{"type:other", "type", "other"},
+		{"host:port", "pin", "host:port"},
+	}
+	for _, test := range tests {
+		if kind, value := parseFilter(test.arg); kind != test.kind || value != test.value {
+			t.Errorf("%s: got %s %s, want %s %s", test.arg, kind, value, test.kind, test.value)
+		}
+	}
+}
+
+func TestSubscriptionMatches(t *testing.T) {
+	fan := newPinEvent(protocol.TypePinState, gpio.PinState{PinId: "P8_07", Name: "fan"})
+	lamp := newPinEvent(protocol.TypePinState, gpio.PinState{PinId: "P8_08", Name: "lamp"})
+	added := newPinEvent(protocol.TypePinAdded, gpio.PinState{PinId: "P8_08", Name: "lamp"})
+	removed := newPinRemovedEvent("P8_07")
+	both := newPinsEvent(protocol.TypePinsChanged, protocol.PinsChanged{PinStates: map[string]gpio.PinState{
+		"P8_07": {PinId: "P8_07", Name: "fan"},
+		"P8_08": {PinId: "P8_08", Name: "lamp"},
+	}})
+	lamps := newPinsEvent(protocol.TypePinsChanged, protocol.PinsChanged{PinStates: map[string]gpio.PinState{
+		"P8_08": {PinId: "P8_08", Name: "lamp"},
+	}})
+	failed := newErrorEvent(protocol.CmdSetPin, gpio.NewError(gpio.CodeInvalidValue, "P8_07", "Invalid value"))
+	groups := newEvent(protocol.TypeGroups, map[string][]string{})
+
+	tests := []struct {
+		filters []string
+		event   *event
+		want    bool
+	}{
+		{nil, fan, true},
+		{[]string{"P8_07"}, fan, true},
+		{[]string{"P8_07"}, lamp, false},
+		{[]string{"fa?"}, fan, true},
+		{[]string{"name:lamp"}, fan, false},
+		{[]string{"fan"}, removed, false},
+		{[]string{"name:fan"}, removed, true},
+		{[]string{"pinadded"}, added, true},
+		{[]string{"pinadded"}, lamp, false},
+		{[]string{"pinstate", "P8_08"}, lamp, true},
+		{[]string{"pinstate", "P8_08"}, added, false},
+		{[]string{"pinstate", "P8_08"}, fan, false},
+		{[]string{"fan"}, both, false},
+		{[]string{"name:fan"}, both, true},
+		{[]string{"P8_07"}, lamps, false},
+		{[]string{"pinsChanged", "lamp*"}, lamps, true},
+		// errors and replies aren't pin events, so pass every filter
+		{[]string{"P8_08", "pinstate"}, failed, true},
+		{[]string{"P8_08", "pinstate"}, groups, true},
+	}
+	for _, test := range tests {
+		s := newSubscription()
+		for _, filter := range test.filters {
+			s.add(parseFilter(filter))
+		}
+		// the hub knows the names of the pins, as events that don't carry
+		// one are matched against it
+		h := newHub(nil)
+		h.pinNames = map[string]string{"P8_07": "fan", "P8_08": "lamp"}
+		if got := s.matches(test.event, h.trackName(test.event)); got != test.want {
+			t.Errorf("%v on %s %s: got %v, want %v", test.filters, test.event.Type, test.event.PinId, got, test.want)
+		}
+	}
+}
+
+func TestSubscriptionRemove(t *testing.T) {
+	s := newSubscription()
+	for _, filter := range []string{"P8_07", "fan*", "fan*", "pinstate"} {
+		s.add(parseFilter(filter))
+	}
+	if info := s.info(); len(info.Pins) != 1 || len(info.Names) != 1 || len(info.Types) != 1 {
+		t.Errorf("got %+v, want one of each filter", info)
+	}
+	for _, filter := range []string{"P8_07", "fan*", "type:pinstate"} {
+		s.remove(parseFilter(filter))
+	}
+	if !s.empty() {
+		t.Errorf("got %+v after removing every filter, want none", s.info())
+	}
+}